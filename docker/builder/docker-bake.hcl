@@ -18,6 +18,9 @@ group "all" {
         "flutter-only",
         "flet-only",
         "full-stack",
+        "docker-proxy",
+        "egress-proxy",
+        "pkg-cache",
         "builder"
     ]
 }
@@ -39,10 +42,43 @@ variable "PLATFORMS" {
     default = "linux/amd64,linux/arm64"
 }
 
+# Toolchain versions (kept in sync with the Dockerfile ARGs by scripts/bump-versions.sh)
+variable "RUNNER_VERSION" {
+    default = "2.331.0"
+}
+
+variable "GO_VERSION" {
+    default = "1.22.7"
+}
+
+variable "NODE_VERSION" {
+    default = "20"
+}
+
+variable "FLUTTER_VERSION" {
+    default = "3.19.5"
+}
+
+variable "FLET_VERSION" {
+    default = "0.22.0"
+}
+
+# Compiler versions the C++ pack installs side by side (space-separated majors)
+variable "GCC_VERSIONS" {
+    default = "11 12"
+}
+
+variable "CLANG_VERSIONS" {
+    default = "14 15"
+}
+
 # Base image
 target "base" {
     context = "."
     dockerfile = "docker/linux/base/Dockerfile.base"
+    args = {
+        RUNNER_VERSION = RUNNER_VERSION
+    }
     tags = [
         "${REGISTRY}/${ORG}/gh-runner:base-${VERSION}",
         "${REGISTRY}/${ORG}/gh-runner:base-latest"
@@ -60,6 +96,10 @@ target "base" {
 target "cpp" {
     context = "."
     dockerfile = "docker/linux/language-packs/cpp/Dockerfile.cpp"
+    args = {
+        GCC_VERSIONS = GCC_VERSIONS
+        CLANG_VERSIONS = CLANG_VERSIONS
+    }
     tags = [
         "${REGISTRY}/${ORG}/gh-runner:cpp-pack-${VERSION}",
         "${REGISTRY}/${ORG}/gh-runner:cpp-pack-latest"
@@ -92,6 +132,9 @@ target "python" {
 target "nodejs" {
     context = "."
     dockerfile = "docker/linux/language-packs/nodejs/Dockerfile.nodejs"
+    args = {
+        NODE_VERSION = NODE_VERSION
+    }
     tags = [
         "${REGISTRY}/${ORG}/gh-runner:nodejs-pack-${VERSION}",
         "${REGISTRY}/${ORG}/gh-runner:nodejs-pack-latest"
@@ -108,6 +151,9 @@ target "nodejs" {
 target "go" {
     context = "."
     dockerfile = "docker/linux/language-packs/go/Dockerfile.go"
+    args = {
+        GO_VERSION = GO_VERSION
+    }
     tags = [
         "${REGISTRY}/${ORG}/gh-runner:go-pack-${VERSION}",
         "${REGISTRY}/${ORG}/gh-runner:go-pack-latest"
@@ -124,6 +170,10 @@ target "go" {
 target "flutter" {
     context = "."
     dockerfile = "docker/linux/language-packs/flutter/Dockerfile.flutter"
+    args = {
+        FLUTTER_VERSION = FLUTTER_VERSION
+        NODE_VERSION = NODE_VERSION
+    }
     tags = [
         "${REGISTRY}/${ORG}/gh-runner:flutter-pack-${VERSION}",
         "${REGISTRY}/${ORG}/gh-runner:flutter-pack-latest"
@@ -140,6 +190,9 @@ target "flutter" {
 target "flet" {
     context = "."
     dockerfile = "docker/linux/language-packs/flet/Dockerfile.flet"
+    args = {
+        FLET_VERSION = FLET_VERSION
+    }
     tags = [
         "${REGISTRY}/${ORG}/gh-runner:flet-pack-${VERSION}",
         "${REGISTRY}/${ORG}/gh-runner:flet-pack-latest"
@@ -157,6 +210,10 @@ target "flet" {
 target "cpp-only" {
     context = "."
     dockerfile = "docker/linux/composite/Dockerfile.cpp-only"
+    args = {
+        GCC_VERSIONS = GCC_VERSIONS
+        CLANG_VERSIONS = CLANG_VERSIONS
+    }
     tags = [
         "${REGISTRY}/${ORG}/gh-runner:cpp-only-${VERSION}",
         "${REGISTRY}/${ORG}/gh-runner:cpp-only-latest"
@@ -237,6 +294,10 @@ target "flet-only" {
 target "full-stack" {
     context = "."
     dockerfile = "docker/linux/composite/Dockerfile.full-stack"
+    args = {
+        GCC_VERSIONS = GCC_VERSIONS
+        CLANG_VERSIONS = CLANG_VERSIONS
+    }
     tags = [
         "${REGISTRY}/${ORG}/gh-runner:full-stack-${VERSION}",
         "${REGISTRY}/${ORG}/gh-runner:full-stack-latest"
@@ -250,10 +311,61 @@ target "full-stack" {
     ]
 }
 
+# Filtering Docker API proxy the compose files put in front of the daemon socket
+target "docker-proxy" {
+    context = "."
+    dockerfile = "docker/docker-proxy/Dockerfile.docker-proxy"
+    tags = [
+        "${REGISTRY}/${ORG}/gh-runner:docker-proxy-${VERSION}",
+        "${REGISTRY}/${ORG}/gh-runner:docker-proxy-latest"
+    ]
+    platforms = split(",", PLATFORMS)
+    cache_from = [
+        "type=registry,ref=${REGISTRY}/${ORG}/gh-runner:cache-docker-proxy"
+    ]
+    cache_to = [
+        "type=registry,ref=${REGISTRY}/${ORG}/gh-runner:cache-docker-proxy,mode=max"
+    ]
+}
+
+# Forward proxy that enforces the per-image egress policies
+target "egress-proxy" {
+    context = "."
+    dockerfile = "docker/egress-proxy/Dockerfile.egress-proxy"
+    tags = [
+        "${REGISTRY}/${ORG}/gh-runner:egress-proxy-${VERSION}",
+        "${REGISTRY}/${ORG}/gh-runner:egress-proxy-latest"
+    ]
+    platforms = split(",", PLATFORMS)
+    cache_from = [
+        "type=registry,ref=${REGISTRY}/${ORG}/gh-runner:cache-egress-proxy"
+    ]
+    cache_to = [
+        "type=registry,ref=${REGISTRY}/${ORG}/gh-runner:cache-egress-proxy,mode=max"
+    ]
+}
+
+# Package cache the runners of a host share
+target "pkg-cache" {
+    context = "."
+    dockerfile = "docker/pkg-cache/Dockerfile.pkg-cache"
+    tags = [
+        "${REGISTRY}/${ORG}/gh-runner:pkg-cache-${VERSION}",
+        "${REGISTRY}/${ORG}/gh-runner:pkg-cache-latest"
+    ]
+    platforms = split(",", PLATFORMS)
+    cache_from = [
+        "type=registry,ref=${REGISTRY}/${ORG}/gh-runner:cache-pkg-cache"
+    ]
+    cache_to = [
+        "type=registry,ref=${REGISTRY}/${ORG}/gh-runner:cache-pkg-cache,mode=max"
+    ]
+}
+
 # Builder image (for building other images)
 target "builder" {
-    context = "docker/builder"
-    dockerfile = "Dockerfile.builder"
+    context = "."
+    dockerfile = "docker/builder/Dockerfile.builder"
     tags = [
         "${REGISTRY}/${ORG}/gh-builder:${VERSION}",
         "${REGISTRY}/${ORG}/gh-builder:latest"
@@ -62,7 +62,7 @@ Image Types:
   python            Build Python language pack
   nodejs            Build Node.js language pack
   go                Build Go language pack
-  ruby              Build Ruby language pack (with rbenv)
+  ruby              Build Ruby language pack (ruby-build, tool cache)
   flutter           Build Flutter language pack
   flet              Build Flet language pack
   android-sdk       Build Android SDK language pack
@@ -99,6 +99,9 @@ Environment Variables:
   REGISTRY          Registry URL
   REGISTRY_USERNAME Registry username (for authentication)
   REGISTRY_PASSWORD Registry password/token
+  REGISTRY_USERNAME_FILE, REGISTRY_PASSWORD_FILE
+                    Read the credential from a file instead; /run/secrets/registry_username
+                    and /run/secrets/registry_password are used when present
   ORG               Organization name
   VERSION           Image version tag
 EOF
@@ -126,14 +129,44 @@ command_exists() {
     command -v "$1" >/dev/null 2>&1
 }
 
+# Read a credential from NAME, NAME_FILE or /run/secrets/<name> (Docker secrets)
+read_secret() {
+    local name="$1"
+    local file_var="${name}_FILE"
+    local file="${!file_var:-}"
+
+    if [[ -n "${!name:-}" && -n "${file}" ]]; then
+        log_error "Both ${name} and ${file_var} are set; use only one" >&2
+        return 1
+    fi
+    if [[ -n "${!name:-}" ]]; then
+        printf '%s' "${!name}"
+        return 0
+    fi
+
+    if [[ -z "${file}" && -f "/run/secrets/${name,,}" ]]; then
+        file="/run/secrets/${name,,}"
+    fi
+    if [[ -n "${file}" ]]; then
+        if [[ ! -r "${file}" ]]; then
+            log_error "Cannot read ${name} from ${file}" >&2
+            return 1
+        fi
+        printf '%s' "$(cat "${file}")"
+    fi
+}
+
 # Authenticate to registry
 authenticate_registry() {
+    REGISTRY_USERNAME="$(read_secret REGISTRY_USERNAME)" || return 1
+    REGISTRY_PASSWORD="$(read_secret REGISTRY_PASSWORD)" || return 1
+
     if [[ -n "${REGISTRY_PASSWORD}" && -n "${REGISTRY_USERNAME}" ]]; then
         log_info "Authenticating to registry: ${REGISTRY}"
         if [[ "${DRY_RUN}" == "true" ]]; then
-            echo "docker login ${REGISTRY} -u ${REGISTRY_USERNAME} -p ***"
+            echo "docker login ${REGISTRY} -u ${REGISTRY_USERNAME} --password-stdin"
         else
-            echo "${REGISTRY_PASSWORD}" | docker login "${REGISTRY}" -u "${REGISTRY_USERNAME}" --password-stdin
+            printf '%s\n' "${REGISTRY_PASSWORD}" | docker login "${REGISTRY}" -u "${REGISTRY_USERNAME}" --password-stdin
             if [[ $? -eq 0 ]]; then
                 log_success "Successfully authenticated to ${REGISTRY}"
             else
@@ -204,7 +237,6 @@ build_standard() {
             ;;
         builder)
             dockerfile="docker/builder/Dockerfile.builder"
-            build_context="${BUILDER_DIR}"
             ;;
         *)
             log_error "Unknown image type: ${image_type}"
@@ -325,7 +357,6 @@ build_buildx() {
             ;;
         builder)
             dockerfile="docker/builder/Dockerfile.builder"
-            build_context="${BUILDER_DIR}"
             ;;
         *)
             log_error "Unknown image type: ${image_type}"
@@ -0,0 +1,565 @@
+#!/bin/bash
+# docker/builder/scripts/bump-versions.sh
+# Discover toolchain version ARGs across Dockerfiles, compose files and bake,
+# compare them with upstream releases and rewrite them consistently
+
+set -euo pipefail
+
+# Colors for output
+RED='\033[0;31m'
+GREEN='\033[0;32m'
+YELLOW='\033[1;33m'
+BLUE='\033[0;34m'
+NC='\033[0m' # No Color
+
+# Configuration
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+PROJECT_ROOT="$(cd "${SCRIPT_DIR}/../../.." && pwd)"
+BAKE_FILE="${PROJECT_ROOT}/docker/builder/docker-bake.hcl"
+CHANGELOG="${PROJECT_ROOT}/CHANGELOG.md"
+GITHUB_API_URL="${GITHUB_API_URL:-https://api.github.com}"
+
+# Tracked version variables
+VERSION_VARS=(RUNNER_VERSION GO_VERSION NODE_VERSION RUBY_VERSION FLUTTER_VERSION DART_VERSION FLET_VERSION SCCACHE_VERSION)
+
+# Lockfile entry names for variables whose downloads are pinned (see update-lock.sh)
+declare -A LOCK_NAMES=(
+    [RUNNER_VERSION]="actions-runner"
+    [GO_VERSION]="go"
+    [NODE_VERSION]="node"
+    [FLUTTER_VERSION]="flutter"
+    [SCCACHE_VERSION]="sccache"
+)
+
+# Tool cache lists installed next to a tracked version. Go and Ruby install
+# the tracked version on top of their list; NODE_VERSION is a major line that
+# must have a release in NODE_CACHE_VERSIONS, because that is all the pack installs.
+declare -A CACHE_LISTS=(
+    [GO_VERSION]="GO_CACHE_VERSIONS"
+    [NODE_VERSION]="NODE_CACHE_VERSIONS"
+    [RUBY_VERSION]="RUBY_CACHE_VERSIONS"
+)
+
+# Options
+CHECK_ONLY="false"
+DRY_RUN="false"
+UPDATE_LOCK="true"
+FEED_FILE=""
+ONLY_VARS=()
+declare -A OVERRIDES=()
+
+# Print usage
+usage() {
+    cat << EOF
+Usage: $(basename "$0") [OPTIONS]
+
+Find every toolchain version across Dockerfiles, docker-compose files and the
+bake file, compare with the upstream release feed and rewrite them so all
+files agree. Tool cache lists (${CACHE_LISTS[*]}) move with them: a new
+NODE_VERSION major gets its newest release added to NODE_CACHE_VERSIONS, and a
+bump is refused if that release cannot be found. Bumped versions are recorded
+in CHANGELOG.md, and the lockfile entries are rewritten to match the new
+versions and lists and refreshed with update-lock.sh.
+
+Tracked variables:
+  ${VERSION_VARS[*]}
+
+Upstream feed (per variable):
+  RUNNER_VERSION    latest actions/runner release
+  GO_VERSION        latest patch of the current Go minor series
+  NODE_VERSION      latest Node.js LTS major
+  RUBY_VERSION      latest patch of the current Ruby series
+  FLUTTER_VERSION   current Flutter stable release
+  DART_VERSION      Dart SDK shipped with the current Flutter stable release
+  FLET_VERSION      latest flet release on PyPI
+  SCCACHE_VERSION   latest mozilla/sccache release
+  *_CACHE_VERSIONS  unchanged, plus for NODE_CACHE_VERSIONS the newest release
+                    of a new NODE_VERSION major (--set or the feed replace the list)
+
+Options:
+  -h, --help            Show this help message
+  --check               Report only; exit 1 if versions are inconsistent or outdated
+  --dry-run             Show the rewrites without changing files
+  --feed <file>         Read target versions from a JSON fixture instead of upstream
+                        (e.g. {"RUNNER_VERSION": "2.332.0"}, see docker/builder/fixtures/)
+  --only <VAR>          Limit to one variable (repeatable)
+  --set <VAR=VERSION>   Force a target version or cache list (repeatable, overrides the feed)
+  --no-lock             Do not refresh lockfiles after bumping
+
+Examples:
+  $(basename "$0") --check
+  $(basename "$0") --only GO_VERSION
+  $(basename "$0") --feed docker/builder/fixtures/version-feed.json --dry-run
+  $(basename "$0") --set RUNNER_VERSION=2.332.0
+  $(basename "$0") --set NODE_VERSION=22 --set NODE_CACHE_VERSIONS="20.17.0 22.9.0"
+EOF
+}
+
+# Log functions
+log_info() {
+    echo -e "${BLUE}[INFO]${NC} $*"
+}
+
+log_success() {
+    echo -e "${GREEN}[SUCCESS]${NC} $*"
+}
+
+log_warning() {
+    echo -e "${YELLOW}[WARNING]${NC} $*"
+}
+
+log_error() {
+    echo -e "${RED}[ERROR]${NC} $*"
+}
+
+# Check if command exists
+command_exists() {
+    command -v "$1" >/dev/null 2>&1
+}
+
+github_api() {
+    local auth=()
+    if [[ -n "${GITHUB_TOKEN:-}" ]]; then
+        auth=(-H "Authorization: token ${GITHUB_TOKEN}")
+    fi
+    curl -fsSL "${auth[@]}" -H "Accept: application/vnd.github.v3+json" "${GITHUB_API_URL}$1"
+}
+
+# Print "<file>\t<line>\t<value>" for every occurrence of a variable.
+# Matches ARG/ENV assignments and compose args/defaults (VAR=x, VAR: x, ${VAR:-x})
+# plus bake variable defaults.
+discover() {
+    local var="$1"
+    local files=()
+
+    mapfile -t files < <(find "${PROJECT_ROOT}/docker" -name 'Dockerfile*' -type f | sort)
+    files+=("${PROJECT_ROOT}"/docker-compose/*.yml)
+
+    local file
+    for file in "${files[@]}"; do
+        grep -noE "\\b${var}(=|: |:-)[0-9][0-9A-Za-z.+-]*" "${file}" 2>/dev/null |
+            sed -E "s/^([0-9]+):${var}(=|: |:-)/\1\t/" |
+            awk -F'\t' -v f="${file}" '{ print f "\t" $1 "\t" $2 }' || true
+    done
+
+    if [[ -f "${BAKE_FILE}" ]]; then
+        awk -v var="${var}" -v f="${BAKE_FILE}" '
+            $0 ~ "^variable \"" var "\"" { inblock = 1; next }
+            inblock && /default *=/ { match($0, /"[^"]*"/); print f "\t" NR "\t" substr($0, RSTART + 1, RLENGTH - 2); inblock = 0 }
+            /^}/ { inblock = 0 }
+        ' "${BAKE_FILE}"
+    fi
+}
+
+# Print "<file>\t<line>\t<list>" for every occurrence of a cache list variable,
+# quoted ("1.21.13 1.22.7") or a single unquoted version
+discover_list() {
+    local var="$1"
+    local files=()
+
+    mapfile -t files < <(find "${PROJECT_ROOT}/docker" -name 'Dockerfile*' -type f | sort)
+    files+=("${PROJECT_ROOT}"/docker-compose/*.yml)
+
+    local file
+    for file in "${files[@]}"; do
+        grep -noE "\\b${var}(=|: |:-)(\"[0-9][0-9A-Za-z. +-]*\"|[0-9][0-9A-Za-z.+-]*)" "${file}" 2>/dev/null |
+            sed -E "s/^([0-9]+):${var}(=|: |:-)\"?/\1\t/; s/\"$//" |
+            awk -F'\t' -v f="${file}" '{ print f "\t" $1 "\t" $2 }' || true
+    done
+}
+
+# Most common value among occurrences (ties broken by highest version)
+primary_value() {
+    cut -f3 | sort | uniq -c | sort -k1,1nr -k2,2Vr | awk 'NR == 1 { print $2 }'
+}
+
+# Most common cache list among occurrences
+primary_list() {
+    cut -f3 | sort | uniq -c | sort -k1,1nr | awk 'NR == 1 { sub(/^ *[0-9]+ /, ""); print }'
+}
+
+# Current major.minor of a version string
+series_of() {
+    awk -F. '{ print $1 "." $2 }' <<< "$1"
+}
+
+# Query upstream for one variable; prints the version or nothing
+fetch_upstream() {
+    local var="$1" current="$2"
+    local series
+    series=$(series_of "${current}")
+
+    case "${var}" in
+        RUNNER_VERSION)
+            github_api "/repos/actions/runner/releases/latest" | jq -r '.tag_name' | sed 's/^v//'
+            ;;
+        GO_VERSION)
+            curl -fsSL "https://go.dev/dl/?mode=json&include=all" |
+                jq -r --arg s "go${series}." '[.[] | select(.stable) | .version | select(startswith($s))][0] // empty' |
+                sed 's/^go//'
+            ;;
+        NODE_VERSION)
+            curl -fsSL "https://nodejs.org/dist/index.json" |
+                jq -r '[.[] | select(.lts != false)][0].version // empty' | sed -E 's/^v([0-9]+).*/\1/'
+            ;;
+        RUBY_VERSION)
+            curl -fsSL "https://endoflife.date/api/ruby.json" |
+                jq -r --arg c "${series}" '.[] | select(.cycle == $c) | .latest'
+            ;;
+        FLUTTER_VERSION)
+            curl -fsSL "https://storage.googleapis.com/flutter_infra_release/releases/releases_linux.json" |
+                jq -r '.current_release.stable as $h | [.releases[] | select(.hash == $h)][0].version // empty'
+            ;;
+        DART_VERSION)
+            curl -fsSL "https://storage.googleapis.com/flutter_infra_release/releases/releases_linux.json" |
+                jq -r '.current_release.stable as $h | [.releases[] | select(.hash == $h)][0].dart_sdk_version // empty' |
+                cut -d' ' -f1
+            ;;
+        FLET_VERSION)
+            curl -fsSL "https://pypi.org/pypi/flet/json" | jq -r '.info.version'
+            ;;
+        SCCACHE_VERSION)
+            github_api "/repos/mozilla/sccache/releases/latest" | jq -r '.tag_name' | sed 's/^v//'
+            ;;
+    esac
+}
+
+# Newest release of a Node.js major line
+node_release() {
+    curl -fsSL "https://nodejs.org/dist/index.json" |
+        jq -r --arg m "v$1." '[.[] | .version | select(startswith($m))][0] // empty' | sed 's/^v//'
+}
+
+# Target version for a variable: --set, then --feed, then upstream
+target_version() {
+    local var="$1" current="$2"
+
+    if [[ -n "${OVERRIDES[${var}]:-}" ]]; then
+        echo "${OVERRIDES[${var}]}"
+    elif [[ -n "${FEED_FILE}" ]]; then
+        jq -r --arg v "${var}" '.[$v] // empty' "${FEED_FILE}"
+    else
+        fetch_upstream "${var}" "${current}" 2>/dev/null || true
+    fi
+}
+
+# Cache list a bumped version needs: --set/--feed for the list itself, else
+# the current list plus, for Node, the newest release of the new major.
+# Prints nothing when the Node release cannot be found.
+cache_list_target() {
+    local var="$1" target="$2" list="$3"
+    local list_var="${CACHE_LISTS[${var}]}"
+    local new_list release
+
+    new_list=$(target_version "${list_var}" "${list}")
+    if [[ -z "${new_list}" ]]; then
+        new_list="${list}"
+    fi
+
+    if [[ "${var}" == "NODE_VERSION" && " ${new_list} " != *" ${target}."* ]]; then
+        if [[ -n "${OVERRIDES[${list_var}]:-}" || -n "${FEED_FILE}" ]]; then
+            return 0
+        fi
+        release=$(node_release "${target}" 2>/dev/null || true)
+        if [[ -z "${release}" ]]; then
+            return 0
+        fi
+        new_list=$(tr ' ' '\n' <<< "${new_list} ${release}" | sed '/^$/d' | sort -uV | paste -sd' ' -)
+    fi
+
+    echo "${new_list}"
+}
+
+# Rewrite one occurrence in place
+rewrite_occurrence() {
+    local file="$1" line="$2" var="$3" new="$4"
+
+    if [[ "${file}" == "${BAKE_FILE}" ]]; then
+        sed -i -E "${line}s/(default *= *\")[^\"]*\"/\1${new}\"/" "${file}"
+    else
+        sed -i -E "${line}s/\\b${var}(=|: |:-)[0-9][0-9A-Za-z.+-]*/${var}\1${new}/g" "${file}"
+    fi
+}
+
+# Rewrite one cache list occurrence in place, always quoted
+rewrite_list_occurrence() {
+    local file="$1" line="$2" var="$3" new="$4"
+
+    sed -i -E "${line}s/\\b${var}(=|: |:-)(\"[0-9][0-9A-Za-z. +-]*\"|[0-9][0-9A-Za-z.+-]*)/${var}\1\"${new}\"/" "${file}"
+}
+
+# Make the lockfile entries named $1 exactly the versions $2...: entries for
+# other versions are dropped, kept ones keep their digest and new ones get
+# digest "-" for update-lock.sh. Prints the lockfiles that changed.
+sync_lock_entries() {
+    local name="$1"
+    shift
+    local want="$*"
+    local lockfile
+
+    while IFS= read -r lockfile; do
+        awk -v n="${name}" '$1 == n { found = 1 } END { exit !found }' "${lockfile}" || continue
+        awk -v n="${name}" -v want="${want}" '
+            BEGIN { count = split(want, versions, " ") }
+            function add_missing(  i) {
+                for (i = 1; i <= count; i++) {
+                    if (!(versions[i] in seen)) {
+                        printf "%-19s %-11s %-15s %s\n", n, versions[i], platform, "-"
+                    }
+                }
+                added = 1
+            }
+            $1 == n {
+                platform = $3
+                if (index(" " want " ", " " $2 " ")) { seen[$2] = 1; print }
+                next
+            }
+            platform && !added { add_missing() }
+            { print }
+            END { if (platform && !added) add_missing() }
+        ' "${lockfile}" > "${lockfile}.tmp"
+        if cmp -s "${lockfile}.tmp" "${lockfile}"; then
+            rm -f "${lockfile}.tmp"
+            continue
+        fi
+        cat "${lockfile}.tmp" > "${lockfile}"
+        rm -f "${lockfile}.tmp"
+        echo "${lockfile}"
+    done < <(find "${PROJECT_ROOT}/docker" -name '*.lock' -type f | sort)
+}
+
+# Prepend an entry to CHANGELOG.md
+write_changelog() {
+    local entries="$1"
+    local tmp
+    tmp=$(mktemp)
+
+    {
+        echo "# Changelog"
+        echo
+        echo "## $(date '+%Y-%m-%d') - Toolchain version bump"
+        echo
+        echo "${entries}"
+        echo
+        if [[ -f "${CHANGELOG}" ]]; then
+            tail -n +3 "${CHANGELOG}"
+        fi
+    } > "${tmp}"
+
+    cat "${tmp}" > "${CHANGELOG}"
+    rm -f "${tmp}"
+}
+
+# Main execution
+main() {
+    # Parse arguments
+    while [[ $# -gt 0 ]]; do
+        case $1 in
+            -h|--help)
+                usage
+                exit 0
+                ;;
+            --check)
+                CHECK_ONLY="true"
+                shift
+                ;;
+            --dry-run)
+                DRY_RUN="true"
+                shift
+                ;;
+            --feed)
+                FEED_FILE="$2"
+                shift 2
+                ;;
+            --only)
+                ONLY_VARS+=("$2")
+                shift 2
+                ;;
+            --set)
+                OVERRIDES["${2%%=*}"]="${2#*=}"
+                shift 2
+                ;;
+            --no-lock)
+                UPDATE_LOCK="false"
+                shift
+                ;;
+            *)
+                log_error "Unknown option: $1"
+                usage
+                exit 1
+                ;;
+        esac
+    done
+
+    if ! command_exists jq; then
+        log_error "Required command not found: jq"
+        exit 1
+    fi
+
+    if [[ -n "${FEED_FILE}" && ! -f "${FEED_FILE}" ]]; then
+        log_error "Feed file not found: ${FEED_FILE}"
+        exit 1
+    fi
+
+    local vars=("${VERSION_VARS[@]}")
+    if [[ ${#ONLY_VARS[@]} -gt 0 ]]; then
+        vars=("${ONLY_VARS[@]}")
+    fi
+
+    local var occurrences current target values
+    local list_var list_occurrences list new_list
+    local drift=0 refused=0
+    local changelog_entries=""
+    local lockfiles=()
+
+    for var in "${vars[@]}"; do
+        if [[ ! " ${VERSION_VARS[*]} " =~ " ${var} " ]]; then
+            log_error "Unknown version variable: ${var}"
+            exit 1
+        fi
+
+        occurrences=$(discover "${var}")
+        if [[ -z "${occurrences}" ]]; then
+            log_warning "${var}: no occurrences found"
+            continue
+        fi
+
+        current=$(primary_value <<< "${occurrences}")
+        values=$(cut -f3 <<< "${occurrences}" | sort -uV | paste -sd, - | sed 's/,/, /g')
+        target=$(target_version "${var}" "${current}")
+
+        if [[ -z "${target}" ]]; then
+            log_warning "${var}: no upstream version available, aligning on ${current}"
+            target="${current}"
+        fi
+
+        # A bump that would leave its cache list behind is refused
+        list_var="${CACHE_LISTS[${var}]:-}"
+        list_occurrences=""
+        list=""
+        new_list=""
+        if [[ -n "${list_var}" ]]; then
+            list_occurrences=$(discover_list "${list_var}")
+            list=$(primary_list <<< "${list_occurrences}")
+            new_list=$(cache_list_target "${var}" "${target}" "${list}")
+            if [[ -z "${new_list}" ]]; then
+                echo
+                log_error "${var}: ${target} needs a ${target}.x release in ${list_var} (\"${list}\"), and none was found;" \
+                    "pass --set ${list_var}=\"...\" to bump it"
+                refused=$((refused + 1))
+                continue
+            fi
+        fi
+
+        echo
+        log_info "${var}: current ${values}, target ${target}"
+
+        local file line value rel files_changed=()
+        while IFS=$'\t' read -r file line value; do
+            rel="${file#"${PROJECT_ROOT}"/}"
+            if [[ "${value}" == "${target}" ]]; then
+                echo "  ${rel}:${line} ${value}"
+                continue
+            fi
+
+            drift=$((drift + 1))
+            log_warning "  ${rel}:${line} ${value} -> ${target}"
+            if [[ "${CHECK_ONLY}" != "true" && "${DRY_RUN}" != "true" ]]; then
+                rewrite_occurrence "${file}" "${line}" "${var}" "${target}"
+            fi
+            if [[ ! " ${files_changed[*]} " =~ " ${rel} " ]]; then
+                files_changed+=("${rel}")
+            fi
+        done <<< "${occurrences}"
+
+        if [[ ${#files_changed[@]} -gt 0 ]]; then
+            local old_values
+            old_values=$(cut -f3 <<< "${occurrences}" | grep -vxF "${target}" | sort -uV | paste -sd, - | sed 's/,/, /g')
+            changelog_entries+="- \`${var}\`: ${old_values} -> ${target} ($(printf '%s, ' "${files_changed[@]}" | sed 's/, $//'))"$'\n'
+        fi
+
+        local list_files_changed=()
+        if [[ -n "${list_occurrences}" ]]; then
+            log_info "${list_var}: current \"${list}\", target \"${new_list}\""
+            while IFS=$'\t' read -r file line value; do
+                rel="${file#"${PROJECT_ROOT}"/}"
+                if [[ "${value}" == "${new_list}" ]]; then
+                    echo "  ${rel}:${line} \"${value}\""
+                    continue
+                fi
+
+                drift=$((drift + 1))
+                log_warning "  ${rel}:${line} \"${value}\" -> \"${new_list}\""
+                if [[ "${CHECK_ONLY}" != "true" && "${DRY_RUN}" != "true" ]]; then
+                    rewrite_list_occurrence "${file}" "${line}" "${list_var}" "${new_list}"
+                fi
+                if [[ ! " ${list_files_changed[*]} " =~ " ${rel} " ]]; then
+                    list_files_changed+=("${rel}")
+                fi
+            done <<< "${list_occurrences}"
+
+            if [[ ${#list_files_changed[@]} -gt 0 ]]; then
+                changelog_entries+="- \`${list_var}\`: \"${list}\" -> \"${new_list}\" ($(printf '%s, ' "${list_files_changed[@]}" | sed 's/, $//'))"$'\n'
+            fi
+        fi
+
+        if [[ ${#files_changed[@]} -eq 0 && ${#list_files_changed[@]} -eq 0 ]]; then
+            continue
+        fi
+
+        # Lock entries for exactly what the pack now installs: the cache list
+        # and the tracked version, which for Node is a major line, not a release
+        if [[ "${CHECK_ONLY}" != "true" && "${DRY_RUN}" != "true" && -n "${LOCK_NAMES[${var}]:-}" ]]; then
+            local lock_versions="${new_list}"
+            if [[ "${var}" != "NODE_VERSION" ]]; then
+                lock_versions+=" ${target}"
+            fi
+            # shellcheck disable=SC2086  # one version per word
+            while IFS= read -r file; do
+                [[ -n "${file}" ]] && lockfiles+=("${file}")
+            done < <(sync_lock_entries "${LOCK_NAMES[${var}]}" $(tr ' ' '\n' <<< "${lock_versions}" | sed '/^$/d' | sort -uV))
+        fi
+    done
+
+    echo
+    if [[ ${refused} -gt 0 ]]; then
+        log_error "${refused} bump(s) refused because their cache list could not follow"
+    fi
+
+    if [[ ${drift} -eq 0 ]]; then
+        if [[ ${refused} -gt 0 ]]; then
+            exit 1
+        fi
+        log_success "All versions are consistent and current"
+        return 0
+    fi
+
+    if [[ "${CHECK_ONLY}" == "true" ]]; then
+        log_error "${drift} version occurrences are inconsistent or outdated"
+        exit 1
+    fi
+
+    if [[ "${DRY_RUN}" == "true" ]]; then
+        log_info "DRY RUN: ${drift} occurrences would be rewritten"
+        [[ ${refused} -eq 0 ]] || exit 1
+        return 0
+    fi
+
+    write_changelog "${changelog_entries%$'\n'}"
+    log_success "Rewrote ${drift} occurrences; changelog entry added to CHANGELOG.md"
+
+    if [[ ${#lockfiles[@]} -gt 0 ]]; then
+        if [[ "${UPDATE_LOCK}" == "true" ]]; then
+            log_info "Refreshing lockfiles for bumped versions"
+            "${SCRIPT_DIR}/update-lock.sh" $(printf '%s\n' "${lockfiles[@]}" | sort -u) ||
+                log_warning "Some lock entries are unresolved; run update-lock.sh before building"
+        else
+            log_warning "Lock entries reset to '-'; run update-lock.sh before building"
+        fi
+    fi
+
+    [[ ${refused} -eq 0 ]] || exit 1
+}
+
+# Run main function
+main "$@"
@@ -0,0 +1,425 @@
+#!/bin/bash
+# docker/builder/scripts/update-lock.sh
+# Refresh the per-pack lockfiles (digests and checksums) and pin parent images
+# Reports every entry that changed so the diff can be reviewed before commit
+
+set -euo pipefail
+
+# Colors for output
+RED='\033[0;31m'
+GREEN='\033[0;32m'
+YELLOW='\033[1;33m'
+BLUE='\033[0;34m'
+NC='\033[0m' # No Color
+
+# Configuration
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+PROJECT_ROOT="$(cd "${SCRIPT_DIR}/../../.." && pwd)"
+GITHUB_API_URL="${GITHUB_API_URL:-https://api.github.com}"
+
+# Options
+CHECK_ONLY="false"
+
+# Counters
+CHANGED=0
+FAILED=0
+
+# Print usage
+usage() {
+    cat << EOF
+Usage: $(basename "$0") [OPTIONS] [LOCKFILE...]
+
+Resolve the digest of every entry in the pack lockfiles (*.lock under docker/),
+rewrite them in place and pin matching FROM lines in Dockerfiles to the
+resolved image digests.
+
+Lockfile format (one entry per line, '#' starts a comment):
+  <name> <version> <platform> <digest>
+
+  platform 'image' entries are parent images (digest from the registry),
+  platform 'git' entries are release tags (digest is the tagged commit),
+  Android SDK packages ('platform-tools', 'platforms;android-34', ...) are
+  pinned to the sha1 Google's repository lists for the revision,
+  apt archive keys (toolchain-r-key, llvm-key) to the sha256 of the key,
+  anything else is a download verified by sha256. A digest of '-' means
+  unresolved; image builds fail until it is filled in.
+
+Options:
+  -h, --help        Show this help message
+  --check           Report drift only; exit 1 if anything would change
+
+Examples:
+  $(basename "$0")
+  $(basename "$0") --check
+  $(basename "$0") docker/linux/language-packs/go/go.lock
+
+Environment Variables:
+  GITHUB_TOKEN      Optional token to avoid GitHub API rate limits
+  GITHUB_API_URL    GitHub API endpoint (default: https://api.github.com)
+EOF
+}
+
+# Log functions
+log_info() {
+    echo -e "${BLUE}[INFO]${NC} $*"
+}
+
+log_success() {
+    echo -e "${GREEN}[SUCCESS]${NC} $*"
+}
+
+log_warning() {
+    echo -e "${YELLOW}[WARNING]${NC} $*"
+}
+
+log_error() {
+    echo -e "${RED}[ERROR]${NC} $*"
+}
+
+# Check if command exists
+command_exists() {
+    command -v "$1" >/dev/null 2>&1
+}
+
+# Download a URL and print its sha256 digest
+sha256_of_url() {
+    local sum
+    sum=$(curl -fsSL "$1" | sha256sum | awk '{print $1}')
+    # sha256 of empty input means the download produced nothing
+    [[ "${sum}" != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" ]] || return 1
+    echo "sha256:${sum}"
+}
+
+github_api() {
+    local auth=()
+    if [[ -n "${GITHUB_TOKEN:-}" ]]; then
+        auth=(-H "Authorization: token ${GITHUB_TOKEN}")
+    fi
+    curl -fsSL "${auth[@]}" -H "Accept: application/vnd.github.v3+json" "${GITHUB_API_URL}$1"
+}
+
+# Parent images: manifest list digest from the registry
+resolve_image() {
+    local name="$1" version="$2"
+    command_exists docker || return 1
+    docker buildx imagetools inspect "${name}:${version}" --format '{{json .Manifest}}' | jq -er '.digest'
+}
+
+# Runner releases publish checksums in the release notes
+resolve_actions_runner() {
+    local version="$1" platform="$2"
+    local sha
+    sha=$(github_api "/repos/actions/runner/releases/tags/v${version}" | jq -r '.body' |
+        sed -n "s/.*<!-- BEGIN SHA ${platform} -->\([0-9a-f]\{64\}\)<!-- END SHA ${platform} -->.*/\1/p" | head -n 1)
+    if [[ -n "${sha}" ]]; then
+        echo "sha256:${sha}"
+    else
+        sha256_of_url "https://github.com/actions/runner/releases/download/v${version}/actions-runner-${platform}-${version}.tar.gz"
+    fi
+}
+
+resolve_go() {
+    local version="$1" platform="$2"
+    local sha
+    sha=$(curl -fsSL "https://go.dev/dl/?mode=json&include=all" |
+        jq -r --arg f "go${version}.${platform}.tar.gz" '.[].files[] | select(.filename == $f) | .sha256' | head -n 1)
+    [[ -n "${sha}" ]] || return 1
+    echo "sha256:${sha}"
+}
+
+# Node.js releases publish SHASUMS256.txt next to the archives
+resolve_node() {
+    local version="$1" platform="$2"
+    local sha
+    sha=$(curl -fsSL "https://nodejs.org/dist/v${version}/SHASUMS256.txt" |
+        awk -v f="node-v${version}-${platform}.tar.gz" '$2 == f { print $1 }')
+    [[ -n "${sha}" ]] || return 1
+    echo "sha256:${sha}"
+}
+
+# Flutter is installed from a git tag; pin the commit it points to
+resolve_flutter() {
+    local version="$1"
+    local refs commit
+    refs=$(git ls-remote --tags https://github.com/flutter/flutter.git "refs/tags/${version}" "refs/tags/${version}^{}")
+    # Annotated tags list the peeled commit as <tag>^{}
+    commit=$(awk '$2 ~ /\^\{\}$/ { print $1 }' <<< "${refs}")
+    [[ -n "${commit}" ]] || commit=$(awk 'NR == 1 { print $1 }' <<< "${refs}")
+    [[ -n "${commit}" ]] || return 1
+    echo "git:${commit}"
+}
+
+resolve_cmdline_tools() {
+    local version="$1" platform="$2"
+    sha256_of_url "https://dl.google.com/android/repository/commandlinetools-${platform}-${version}_latest.zip"
+}
+
+# SDK packages are installed by sdkmanager, which checks each archive against
+# the sha1 in Google's repository manifest; pin that checksum, for the revision
+# the manifest currently lists
+resolve_android_package() {
+    local name="$1" version="$2"
+    local base="https://dl.google.com/android/repository" url tag xml revision="" part checksum
+
+    if ! command_exists xmllint; then
+        log_error "xmllint is needed to resolve Android SDK packages" >&2
+        return 1
+    fi
+    case "${name}" in
+        system-images\;*)
+            tag=$(cut -d';' -f3 <<< "${name}")
+            [[ "${tag}" == "default" ]] && tag="android"
+            url="${base}/sys-img/${tag}/sys-img2-3.xml"
+            ;;
+        add-ons\;*|extras\;google\;*)
+            url="${base}/addon2-3.xml"
+            ;;
+        *)
+            url="${base}/repository2-3.xml"
+            ;;
+    esac
+
+    xml=$(mktemp)
+    if ! curl -fsSL "${url}" -o "${xml}"; then
+        rm -f "${xml}"
+        return 1
+    fi
+    for part in major minor micro; do
+        part=$(xmllint --xpath "string(//remotePackage[@path='${name}']/revision/${part})" "${xml}")
+        [[ -n "${part}" ]] || break
+        revision="${revision:+${revision}.}${part}"
+    done
+    checksum=$(xmllint --xpath "string(//remotePackage[@path='${name}']/archives/archive[not(host-os) or host-os='linux'][not(host-arch) or host-arch='x64']/complete/checksum)" "${xml}")
+    rm -f "${xml}"
+
+    if [[ "${revision}" != "${version}" ]]; then
+        log_error "  ${name} is at revision ${revision:-none} upstream; set the version column to it" >&2
+        return 1
+    fi
+    [[ -n "${checksum}" ]] || return 1
+    echo "sha1:${checksum}"
+}
+
+# Signing keys of the extra apt archives the C++ pack may add (see
+# cpp-toolchains-install.sh); the digest is the sha256 of the key as served
+resolve_apt_key() {
+    local name="$1"
+    case "${name}" in
+        toolchain-r-key)
+            sha256_of_url "https://keyserver.ubuntu.com/pks/lookup?op=get&options=mr&search=0x60C317803A41BA51845E371A1E9377A2BA9EF27F"
+            ;;
+        llvm-key)
+            sha256_of_url "https://apt.llvm.org/llvm-snapshot.gpg.key"
+            ;;
+    esac
+}
+
+# sccache releases publish a .sha256 next to each archive
+resolve_sccache() {
+    local version="$1" platform="$2"
+    local url="https://github.com/mozilla/sccache/releases/download/v${version}/sccache-v${version}-${platform}.tar.gz"
+    local sha
+    sha=$(curl -fsSL "${url}.sha256" | awk '{ print $1 }')
+    if [[ "${sha}" =~ ^[0-9a-f]{64}$ ]]; then
+        echo "sha256:${sha}"
+    else
+        sha256_of_url "${url}"
+    fi
+}
+
+resolve_buildx() {
+    local version="$1" platform="$2"
+    local sha
+    sha=$(curl -fsSL "https://github.com/docker/buildx/releases/download/v${version}/checksums.txt" |
+        awk -v f="buildx-v${version}.${platform}" '{ sub(/^\*/, "", $2) } $2 == f { print $1 }')
+    if [[ -n "${sha}" ]]; then
+        echo "sha256:${sha}"
+    else
+        sha256_of_url "https://github.com/docker/buildx/releases/download/v${version}/buildx-v${version}.${platform}"
+    fi
+}
+
+# Resolve one lockfile entry to its current digest
+resolve_entry() {
+    local name="$1" version="$2" platform="$3"
+
+    if [[ "${platform}" == "image" ]]; then
+        resolve_image "${name}" "${version}"
+        return
+    fi
+
+    case "${name}" in
+        actions-runner)
+            resolve_actions_runner "${version}" "${platform}"
+            ;;
+        go)
+            resolve_go "${version}" "${platform}"
+            ;;
+        node)
+            resolve_node "${version}" "${platform}"
+            ;;
+        flutter)
+            resolve_flutter "${version}"
+            ;;
+        cmdline-tools)
+            resolve_cmdline_tools "${version}" "${platform}"
+            ;;
+        platform-tools|emulator|*\;*)
+            resolve_android_package "${name}" "${version}"
+            ;;
+        toolchain-r-key|llvm-key)
+            resolve_apt_key "${name}"
+            ;;
+        sccache)
+            resolve_sccache "${version}" "${platform}"
+            ;;
+        buildx)
+            resolve_buildx "${version}" "${platform}"
+            ;;
+        *)
+            log_error "No resolver for lock entry '${name}'"
+            return 1
+            ;;
+    esac
+}
+
+# Resolve every entry in a lockfile and rewrite it if anything changed
+update_lockfile() {
+    local lockfile="$1"
+    local rel="${lockfile#"${PROJECT_ROOT}"/}"
+    local tmp
+    tmp=$(mktemp)
+
+    log_info "Resolving ${rel}"
+
+    local line name version platform digest resolved
+    while IFS= read -r line || [[ -n "${line}" ]]; do
+        if [[ -z "${line// }" || "${line}" =~ ^[[:space:]]*# ]]; then
+            echo "${line}" >> "${tmp}"
+            continue
+        fi
+
+        read -r name version platform digest <<< "${line}"
+
+        if ! resolved=$(resolve_entry "${name}" "${version}" "${platform}") || [[ -z "${resolved}" ]]; then
+            log_error "  ${name} ${version} (${platform}): could not resolve, keeping ${digest:--}"
+            FAILED=$((FAILED + 1))
+            resolved="${digest:--}"
+        elif [[ "${resolved}" != "${digest}" ]]; then
+            log_warning "  ${name} ${version} (${platform}): ${digest:--} -> ${resolved}"
+            CHANGED=$((CHANGED + 1))
+        else
+            echo "  ${name} ${version} (${platform}): unchanged"
+        fi
+
+        # Long names (platforms;android-34) still get a separating space
+        printf '%-19s %-11s %-15s %s\n' "${name}" "${version}" "${platform}" "${resolved}" >> "${tmp}"
+    done < "${lockfile}"
+
+    if [[ "${CHECK_ONLY}" != "true" ]] && ! cmp -s "${tmp}" "${lockfile}"; then
+        cat "${tmp}" > "${lockfile}"
+    fi
+    rm -f "${tmp}"
+}
+
+# Rewrite FROM lines to the pinned image digests from all lockfiles
+pin_dockerfiles() {
+    local pins
+    pins=$(find "${PROJECT_ROOT}/docker" -name '*.lock' -exec \
+        awk '$1 !~ /^#/ && $3 == "image" && $4 ~ /^sha256:/ { print $1, $2, $4 }' {} +)
+
+    if [[ -z "${pins}" ]]; then
+        log_warning "No resolved image digests; Dockerfiles left unpinned"
+        return 0
+    fi
+
+    log_info "Pinning parent images in Dockerfiles"
+
+    local dockerfile tmp name version digest
+    while IFS= read -r dockerfile; do
+        tmp=$(mktemp)
+        cp "${dockerfile}" "${tmp}"
+        while read -r name version digest; do
+            sed -E -i "s#^(FROM[[:space:]]+)${name}:${version//./\\.}(@sha256:[0-9a-f]+)?([[:space:]]|\$)#\1${name}:${version}@${digest}\3#" "${tmp}"
+        done <<< "${pins}"
+
+        if ! cmp -s "${tmp}" "${dockerfile}"; then
+            log_warning "  ${dockerfile#"${PROJECT_ROOT}"/}: FROM pin updated"
+            CHANGED=$((CHANGED + 1))
+            if [[ "${CHECK_ONLY}" != "true" ]]; then
+                cp "${tmp}" "${dockerfile}"
+            fi
+        fi
+        rm -f "${tmp}"
+    done < <(find "${PROJECT_ROOT}/docker" -name 'Dockerfile*' -type f | sort)
+}
+
+# Main execution
+main() {
+    local lockfiles=()
+
+    # Parse arguments
+    while [[ $# -gt 0 ]]; do
+        case $1 in
+            -h|--help)
+                usage
+                exit 0
+                ;;
+            --check)
+                CHECK_ONLY="true"
+                shift
+                ;;
+            -*)
+                log_error "Unknown option: $1"
+                usage
+                exit 1
+                ;;
+            *)
+                lockfiles+=("$(cd "$(dirname "$1")" && pwd)/$(basename "$1")")
+                shift
+                ;;
+        esac
+    done
+
+    for cmd in curl jq git sha256sum; do
+        if ! command_exists "${cmd}"; then
+            log_error "Required command not found: ${cmd}"
+            exit 1
+        fi
+    done
+
+    if [[ ${#lockfiles[@]} -eq 0 ]]; then
+        mapfile -t lockfiles < <(find "${PROJECT_ROOT}/docker" -name '*.lock' -type f | sort)
+    fi
+
+    for lockfile in "${lockfiles[@]}"; do
+        update_lockfile "${lockfile}"
+    done
+
+    pin_dockerfiles
+
+    echo
+    if [[ ${FAILED} -gt 0 ]]; then
+        log_error "${FAILED} entries could not be resolved"
+    fi
+
+    if [[ "${CHECK_ONLY}" == "true" ]]; then
+        if [[ ${CHANGED} -gt 0 || ${FAILED} -gt 0 ]]; then
+            log_error "Lockfiles are out of date (${CHANGED} pending changes, ${FAILED} unresolved)"
+            exit 1
+        fi
+        log_success "Lockfiles are up to date"
+        return 0
+    fi
+
+    if [[ ${CHANGED} -gt 0 ]]; then
+        log_success "Updated ${CHANGED} entries; review with: git diff -- '*.lock' '*Dockerfile*'"
+    elif [[ ${FAILED} -eq 0 ]]; then
+        log_success "Lockfiles already up to date"
+    fi
+
+    [[ ${FAILED} -eq 0 ]]
+}
+
+# Run main function
+main "$@"
@@ -0,0 +1,14 @@
+# docker/linux/base/hooks.d/completed/10-job-metadata.sh
+# Log the finished job and how long it ran
+
+JOB_STATE_FILE="/run/gh-runner/job.json"
+
+duration="unknown"
+if [[ -f "${JOB_STATE_FILE}" ]]; then
+    started=$(jq -r '.started_at // empty' "${JOB_STATE_FILE}" 2>/dev/null || true)
+    if [[ -n "${started}" ]]; then
+        duration="$(( $(date +%s) - started ))s"
+    fi
+fi
+
+hook_log "Runner ${RUNNER_NAME:-unknown} finished job ${GITHUB_JOB:-unknown} (${GITHUB_REPOSITORY:-unknown}, run ${GITHUB_RUN_ID:-?}) in ${duration}"
@@ -0,0 +1,15 @@
+# docker/linux/base/hooks.d/completed/20-egress-report.sh
+# List the requests the egress policy refused during the job in the job log
+
+if [[ -n "${EGRESS_PROXY:-}" ]]; then
+    if denied=$(hook_supervisor egress-proxy completed); then
+        if [[ -n "${denied}" ]]; then
+            hook_warn "The egress policy refused $(wc -l <<< "${denied}") host(s); see docker/egress-proxy/README.md to allow more"
+            while IFS= read -r line; do
+                hook_log "  denied: ${line}"
+            done <<< "${denied}"
+        fi
+    else
+        hook_log "Could not fetch denied requests from the egress proxy at ${EGRESS_PROXY}: ${denied}"
+    fi
+fi
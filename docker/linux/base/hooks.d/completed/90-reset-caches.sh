@@ -0,0 +1,15 @@
+# docker/linux/base/hooks.d/completed/90-reset-caches.sh
+# Reset per-job caches so the next job starts clean
+# Removes the runner user's files in /tmp and empties every directory in
+# HOOK_RESET_CACHE_DIRS (colon-separated)
+
+find /tmp -mindepth 1 -maxdepth 1 -user "$(id -u)" -exec rm -rf {} + 2>/dev/null || true
+
+IFS=':' read -r -a reset_dirs <<< "${HOOK_RESET_CACHE_DIRS:-}"
+for dir in "${reset_dirs[@]}"; do
+    [[ -n "${dir}" && -d "${dir}" ]] || continue
+    hook_log "Resetting cache ${dir}"
+    find "${dir}" -mindepth 1 -maxdepth 1 -exec rm -rf {} + 2>/dev/null || hook_warn "Could not fully reset ${dir}"
+done
+
+rm -f /run/gh-runner/job.json
@@ -0,0 +1,13 @@
+# docker/linux/base/hooks.d/completed/95-scrub-workspace.sh
+# Scrub the workspace, stray processes, job containers and caches so the next
+# job on a persistent runner starts clean. Disable with RUNNER_SCRUB=false.
+
+if [[ "${RUNNER_SCRUB:-true}" == "true" ]]; then
+    # Stop whatever still writes to the workspace before wiping it
+    scrub_parts=()
+    [[ "${SCRUB_DOCKER:-true}" == "true" ]] && scrub_parts+=(--only docker)
+    [[ "${SCRUB_PROCESSES:-true}" == "true" ]] && scrub_parts+=(--only processes)
+    scrub_parts+=(--only workdir --only caches)
+
+    scrub-workspace "${scrub_parts[@]}" || hook_warn "Workspace scrub failed on runner ${RUNNER_NAME:-}"
+fi
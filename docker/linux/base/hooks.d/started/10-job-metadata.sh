@@ -0,0 +1,19 @@
+# docker/linux/base/hooks.d/started/10-job-metadata.sh
+# Log the job being picked up and record its start time for the completed hook
+
+JOB_STATE_FILE="/run/gh-runner/job.json"
+
+hook_log "Runner ${RUNNER_NAME:-unknown} starting job ${GITHUB_JOB:-unknown}"
+hook_log "  repository: ${GITHUB_REPOSITORY:-unknown}"
+hook_log "  workflow:   ${GITHUB_WORKFLOW:-unknown} (run ${GITHUB_RUN_ID:-?}, attempt ${GITHUB_RUN_ATTEMPT:-1})"
+hook_log "  ref:        ${GITHUB_REF:-unknown} @ ${GITHUB_SHA:-unknown}"
+hook_log "  actor:      ${GITHUB_ACTOR:-unknown} (${GITHUB_EVENT_NAME:-unknown})"
+
+jq -n \
+    --arg repository "${GITHUB_REPOSITORY:-}" \
+    --arg workflow "${GITHUB_WORKFLOW:-}" \
+    --arg job "${GITHUB_JOB:-}" \
+    --arg run_id "${GITHUB_RUN_ID:-}" \
+    --arg started "$(date +%s)" \
+    '{repository: $repository, workflow: $workflow, job: $job, run_id: $run_id, started_at: ($started | tonumber)}' \
+    > "${JOB_STATE_FILE}" 2>/dev/null || hook_log "Could not write ${JOB_STATE_FILE}"
@@ -0,0 +1,9 @@
+# docker/linux/base/hooks.d/started/15-egress-job.sh
+# Have the supervisor tell the egress proxy which job this runner is running,
+# so its log lines and 20-egress-report.sh attribute denied requests to the job
+
+if [[ -n "${EGRESS_PROXY:-}" ]]; then
+    if ! reply=$(hook_supervisor egress-proxy started "${GITHUB_REPOSITORY:-unknown} run ${GITHUB_RUN_ID:-?} job ${GITHUB_JOB:-unknown}"); then
+        hook_warn "Could not name this job to the egress proxy at ${EGRESS_PROXY} (${reply}); its log will not name this job"
+    fi
+fi
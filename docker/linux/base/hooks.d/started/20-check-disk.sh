@@ -0,0 +1,22 @@
+# docker/linux/base/hooks.d/started/20-check-disk.sh
+# Check free disk space in the workspace before the job starts
+# HOOK_MIN_FREE_DISK_MB sets the threshold; HOOK_DISK_CHECK_ENFORCE=true fails the job
+
+min_free_mb="${HOOK_MIN_FREE_DISK_MB:-2048}"
+check_path="${GITHUB_WORKSPACE:-${PWD}}"
+
+# The workspace may not exist yet on the first job
+while [[ ! -d "${check_path}" && "${check_path}" != "/" ]]; do
+    check_path="$(dirname "${check_path}")"
+done
+
+free_mb=$(df -Pm "${check_path}" | awk 'NR == 2 { print $4 }')
+hook_log "Free disk space at ${check_path}: ${free_mb}MB (minimum ${min_free_mb}MB)"
+
+if [[ "${free_mb}" -lt "${min_free_mb}" ]]; then
+    if [[ "${HOOK_DISK_CHECK_ENFORCE:-false}" == "true" ]]; then
+        hook_log "ERROR: Not enough free disk space to start the job"
+        exit 1
+    fi
+    hook_warn "Low disk space on runner ${RUNNER_NAME:-}: ${free_mb}MB free, ${min_free_mb}MB recommended"
+fi
@@ -0,0 +1,82 @@
+#!/bin/bash
+# docker/linux/base/scripts/lock-verify.sh
+# Verify downloaded toolchains against a pack lockfile
+# Installed into the base image as /usr/local/bin/lock-verify
+
+set -euo pipefail
+
+usage() {
+    cat << EOF
+Usage: $(basename "$0") <mode> <lockfile> <name> <version> <platform> [target]
+
+Verify an artifact against the digest recorded in a pack lockfile.
+Fails if the entry is missing, unresolved ('-') or does not match.
+
+Modes:
+  file    Compare the sha256 of <target> (a downloaded file)
+  git     Compare the HEAD commit of <target> (a git checkout)
+
+Examples:
+  $(basename "$0") file /tmp/go.lock go 1.22.7 linux-amd64 /tmp/go.tar.gz
+  $(basename "$0") git /tmp/flutter.lock flutter 3.19.5 git /opt/flutter
+EOF
+}
+
+fail() {
+    echo "[lock-verify] ERROR: $*" >&2
+    exit 1
+}
+
+# Print the digest column for an entry, or nothing if absent
+lock_lookup() {
+    local lockfile="$1" name="$2" version="$3" platform="$4"
+    awk -v n="${name}" -v v="${version}" -v p="${platform}" \
+        '$1 !~ /^#/ && $1 == n && $2 == v && $3 == p { print $4; exit }' "${lockfile}"
+}
+
+main() {
+    if [[ $# -lt 6 ]]; then
+        usage
+        exit 2
+    fi
+
+    local mode="$1" lockfile="$2" name="$3" version="$4" platform="$5" target="$6"
+    local entry="${name} ${version} (${platform})"
+
+    [[ -f "${lockfile}" ]] || fail "Lockfile not found: ${lockfile}"
+
+    local expected
+    expected=$(lock_lookup "${lockfile}" "${name}" "${version}" "${platform}")
+
+    if [[ -z "${expected}" ]]; then
+        fail "No entry for ${entry} in $(basename "${lockfile}"); add it with digest '-' and run docker/builder/scripts/update-lock.sh"
+    fi
+    if [[ "${expected}" == "-" ]]; then
+        fail "No digest recorded for ${entry} in $(basename "${lockfile}"); run docker/builder/scripts/update-lock.sh"
+    fi
+
+    local actual
+    case "${mode}" in
+        file)
+            actual="sha256:$(sha256sum "${target}" | awk '{print $1}')"
+            ;;
+        git)
+            actual="git:$(git -C "${target}" rev-parse HEAD)"
+            ;;
+        *)
+            usage
+            exit 2
+            ;;
+    esac
+
+    if [[ "${expected%%:*}" != "${actual%%:*}" ]]; then
+        fail "Expected a ${actual%%:*} digest for ${entry}, got ${expected}"
+    fi
+    if [[ "${actual}" != "${expected}" ]]; then
+        fail "Digest mismatch for ${entry}: expected ${expected}, got ${actual}"
+    fi
+
+    echo "[lock-verify] OK ${entry} ${actual}"
+}
+
+main "$@"
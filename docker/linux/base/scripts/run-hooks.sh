@@ -0,0 +1,86 @@
+#!/bin/bash
+# docker/linux/base/scripts/run-hooks.sh
+# Job lifecycle hook dispatcher for GitHub Actions runners
+# Installed as ACTIONS_RUNNER_HOOK_JOB_STARTED/COMPLETED (via job-started.sh and
+# job-completed.sh symlinks) and runs /etc/gh-runner/hooks.d/<phase>/NN-*.sh in order
+
+set -euo pipefail
+
+HOOKS_DIR="${GH_RUNNER_HOOKS_DIR:-/etc/gh-runner/hooks.d}"
+
+# Function to log messages from the dispatcher and from hooks
+hook_log() {
+    echo "[hooks:${HOOK_PHASE}] $*"
+}
+
+# Function to report a problem as a workflow warning annotation
+hook_warn() {
+    echo "::warning title=Runner ${HOOK_PHASE} hook::$*"
+}
+
+# Function to send one request to the supervisor's job socket and print the
+# answer. The supervisor calls the stack's servers for the hooks, with tokens
+# the job cannot read.
+hook_supervisor() {
+    if [[ ! -S "${RUNNER_JOB_SOCKET:-}" ]]; then
+        echo "the supervisor's job socket is not available"
+        return 1
+    fi
+
+    local reply
+    if ! reply=$(printf '%s\n' "$*" | socat -t 10 - "UNIX-CONNECT:${RUNNER_JOB_SOCKET}" 2>&1); then
+        echo "${reply}"
+        return 1
+    fi
+    if [[ "${reply}" == ERROR* ]]; then
+        echo "${reply#ERROR }"
+        return 1
+    fi
+    if [[ -n "${reply}" ]]; then
+        echo "${reply}"
+    fi
+}
+
+# Phase comes from the symlink name the runner invoked, or the first argument
+case "$(basename "$0")" in
+    job-started*)
+        HOOK_PHASE="started"
+        ;;
+    job-completed*)
+        HOOK_PHASE="completed"
+        ;;
+    *)
+        HOOK_PHASE="${1:-}"
+        ;;
+esac
+
+if [[ "${HOOK_PHASE}" != "started" && "${HOOK_PHASE}" != "completed" ]]; then
+    echo "Usage: $(basename "$0") started|completed" >&2
+    exit 2
+fi
+
+export HOOK_PHASE
+
+failed=0
+for hook in "${HOOKS_DIR}/${HOOK_PHASE}"/*.sh; do
+    [[ -f "${hook}" ]] || continue
+
+    # Hooks run in a subshell so one hook cannot change another's environment
+    if ( set -euo pipefail; source "${hook}" ); then
+        continue
+    fi
+
+    # A failing started hook fails the job before any step runs;
+    # completed hooks are best effort so cleanup always runs to the end
+    if [[ "${HOOK_PHASE}" == "started" ]]; then
+        hook_log "ERROR: $(basename "${hook}") failed, aborting job"
+        exit 1
+    fi
+    hook_warn "$(basename "${hook}") failed"
+    failed=$((failed + 1))
+done
+
+if [[ ${failed} -gt 0 ]]; then
+    hook_log "${failed} completed hook(s) failed"
+fi
+exit 0
@@ -0,0 +1,249 @@
+#!/bin/bash
+# docker/linux/base/scripts/runner-priv.sh
+# Privilege broker for hardened runners (RUNNER_HARDENED=true)
+# Jobs have no sudo; they run `runner-priv <operation> ...` instead. The request
+# goes over a socket to the root supervisor, which checks it against
+# /etc/gh-runner/priv-policy.conf, logs the decision and runs only that operation.
+
+set -euo pipefail
+
+PRIV_SOCKET="/run/gh-runner-priv/priv.sock"
+PRIV_POLICY="${RUNNER_PRIV_POLICY:-/etc/gh-runner/priv-policy.conf}"
+EXIT_MARKER="__RUNNER_PRIV_EXIT__"
+MAX_CERT_BYTES=65536
+
+# Exit code for requests the policy refuses
+EXIT_DENIED=77
+
+usage() {
+    cat << EOF
+Usage: runner-priv <operation> [arguments]
+
+Run an allow-listed privileged operation on a hardened runner.
+
+Operations:
+  apt-install PACKAGE...   apt-get install -y --no-install-recommends PACKAGE...
+  ca-cert-add FILE         Add a PEM CA certificate to the system trust store
+
+The runner's policy (${PRIV_POLICY}) lists the packages, repositories and
+certificate fingerprints allowed; anything else is refused. Every request is
+logged in the runner's container log.
+EOF
+}
+
+# ---------------------------------------------------------------------------
+# Client (runs as the runner user inside a job)
+# ---------------------------------------------------------------------------
+
+client() {
+    local op="${1:-}"
+    shift || true
+
+    case "${op}" in
+        apt-install)
+            if [ $# -eq 0 ]; then
+                usage >&2
+                exit 2
+            fi
+            ;;
+        ca-cert-add)
+            if [ $# -ne 1 ] || [ ! -r "$1" ]; then
+                echo "runner-priv: ca-cert-add needs one readable PEM file" >&2
+                exit 2
+            fi
+            ;;
+        -h|--help|"")
+            usage
+            exit 0
+            ;;
+        *)
+            echo "runner-priv: unknown operation '${op}'" >&2
+            usage >&2
+            exit 2
+            ;;
+    esac
+
+    if [ ! -S "${PRIV_SOCKET}" ]; then
+        echo "runner-priv: no privilege broker on this runner (it only runs with RUNNER_HARDENED=true)" >&2
+        exit 1
+    fi
+
+    # The operation, context for the audit log, then the certificate if any
+    local cert=""
+    if [ "${op}" = "ca-cert-add" ]; then
+        cert="$1"
+        set --
+    fi
+
+    local code=1 line
+    while IFS= read -r line; do
+        if [[ "${line}" =~ ^${EXIT_MARKER}\ ([0-9]+)$ ]]; then
+            code="${BASH_REMATCH[1]}"
+        else
+            printf '%s\n' "${line}"
+        fi
+    done < <(
+        {
+            printf '%s\n' "${op} $*"
+            printf '%s\n' "repository=${GITHUB_REPOSITORY:-} run=${GITHUB_RUN_ID:-} job=${GITHUB_JOB:-}"
+            if [ -n "${cert}" ]; then
+                head -c "${MAX_CERT_BYTES}" "${cert}"
+            fi
+        } | socat -t 3600 - "UNIX-CONNECT:${PRIV_SOCKET}"
+    )
+    exit "${code}"
+}
+
+# ---------------------------------------------------------------------------
+# Broker (runs as root, one process per request, started by socat)
+# ---------------------------------------------------------------------------
+
+# Audit lines go to stderr, which the entrypoint logs
+audit() {
+    echo "runner-priv: $*" >&2
+}
+
+finish() {
+    echo "${EXIT_MARKER} $1"
+    exit 0
+}
+
+# Function to normalize a SHA-256 fingerprint: no colons, lower case
+normalize_fingerprint() {
+    local fingerprint="${1//:/}"
+    echo "${fingerprint,,}"
+}
+
+# Function to check an argument against the allow/deny rules for an operation.
+# Nothing is allowed without a matching allow rule. ca-cert-add rules name
+# fingerprints, compared exactly; the others are shell globs.
+policy_allows() {
+    local op="$1"
+    local arg="$2"
+    local allowed=1 rule rule_op pattern matched
+
+    [ -r "${PRIV_POLICY}" ] || return 1
+    while read -r rule rule_op pattern; do
+        [ "${rule_op}" = "${op}" ] || continue
+        if [ "${op}" = "ca-cert-add" ]; then
+            [ "$(normalize_fingerprint "${pattern}")" = "${arg}" ] && matched=0 || matched=1
+        else
+            # shellcheck disable=SC2053  # the pattern is a glob
+            [[ "${arg}" == ${pattern} ]] && matched=0 || matched=1
+        fi
+        if [ ${matched} -eq 0 ]; then
+            case "${rule}" in
+                deny) return 1 ;;
+                allow) allowed=0 ;;
+            esac
+        fi
+    done < "${PRIV_POLICY}"
+    return ${allowed}
+}
+
+apt_install() {
+    local context="$1"
+    shift
+
+    local pkg name
+    for pkg in "$@"; do
+        if [[ ! "${pkg}" =~ ^[a-z0-9][a-z0-9+.-]*(:[a-z0-9]+)?(=[A-Za-z0-9.+:~-]+)?$ ]]; then
+            audit "DENY apt-install ${pkg}: not a package name (${context})"
+            echo "runner-priv: '${pkg}' is not a package name"
+            finish ${EXIT_DENIED}
+        fi
+        name="${pkg%%=*}"
+        name="${name%%:*}"
+        if ! policy_allows apt-install "${name}"; then
+            audit "DENY apt-install ${name} (${context})"
+            echo "runner-priv: installing '${name}' is not allowed by ${PRIV_POLICY}"
+            finish ${EXIT_DENIED}
+        fi
+    done
+
+    # Only the repositories the policy approves, never the image's own, which
+    # include whatever the language packs added
+    local sources
+    sources="$(sed -n 's/^apt-source[[:space:]]\{1,\}//p' "${PRIV_POLICY}")"
+    if [ -z "${sources}" ]; then
+        audit "DENY apt-install $*: no apt-source in the policy (${context})"
+        echo "runner-priv: ${PRIV_POLICY} allows no repositories (apt-source)"
+        finish ${EXIT_DENIED}
+    fi
+    audit "ALLOW apt-install $* (${context})"
+
+    printf '%s\n' "${sources}" > /run/gh-runner-priv/sources.list
+    local apt_opts=(-o DPkg::Lock::Timeout=300
+        -o Dir::Etc::SourceList=/run/gh-runner-priv/sources.list -o Dir::Etc::SourceParts=/nonexistent)
+
+    local code=0
+    {
+        DEBIAN_FRONTEND=noninteractive apt-get "${apt_opts[@]}" update -qq &&
+            DEBIAN_FRONTEND=noninteractive apt-get "${apt_opts[@]}" install -y --no-install-recommends "$@"
+    } 2>&1 || code=$?
+
+    audit "DONE apt-install $* exit=${code}"
+    finish ${code}
+}
+
+ca_cert_add() {
+    local context="$1"
+    local pem="/run/gh-runner-priv/request-$$.pem"
+
+    head -c "${MAX_CERT_BYTES}" > "${pem}"
+    local subject fingerprint
+    if ! subject="$(openssl x509 -in "${pem}" -noout -subject -nameopt RFC2253 2>/dev/null)"; then
+        rm -f "${pem}"
+        audit "DENY ca-cert-add: not a PEM certificate (${context})"
+        echo "runner-priv: the file is not a PEM certificate"
+        finish ${EXIT_DENIED}
+    fi
+    subject="${subject#subject=}"
+    fingerprint="$(normalize_fingerprint "$(openssl x509 -in "${pem}" -noout -fingerprint -sha256 | sed 's/.*=//')")"
+
+    if ! policy_allows ca-cert-add "${fingerprint}"; then
+        rm -f "${pem}"
+        audit "DENY ca-cert-add ${subject} sha256:${fingerprint} (${context})"
+        echo "runner-priv: adding '${subject}' (sha256:${fingerprint}) is not allowed by ${PRIV_POLICY}"
+        finish ${EXIT_DENIED}
+    fi
+    audit "ALLOW ca-cert-add ${subject} sha256:${fingerprint} (${context})"
+
+    local code=0
+    openssl x509 -in "${pem}" -out "/usr/local/share/ca-certificates/runner-priv-${fingerprint:0:16}.crt" &&
+        update-ca-certificates 2>&1 || code=$?
+    rm -f "${pem}"
+
+    audit "DONE ca-cert-add ${subject} exit=${code}"
+    finish ${code}
+}
+
+serve() {
+    local request="" context=""
+    IFS= read -r request || true
+    IFS= read -r context || true
+
+    local op args=()
+    read -r op _ <<< "${request}"
+    read -r -a args <<< "${request#"${op}"}"
+
+    case "${op}" in
+        apt-install)
+            apt_install "${context}" "${args[@]}"
+            ;;
+        ca-cert-add)
+            ca_cert_add "${context}"
+            ;;
+        *)
+            audit "DENY unknown operation '${op}' (${context})"
+            echo "runner-priv: unknown operation '${op}'"
+            finish 2
+            ;;
+    esac
+}
+
+if [ "${1:-}" = "--serve" ]; then
+    serve
+else
+    client "$@"
+fi
@@ -0,0 +1,234 @@
+#!/bin/bash
+# docker/linux/base/scripts/scrub-workspace.sh
+# Post-job cleanup for persistent runners
+# Installed as /usr/local/bin/scrub-workspace and called from the job hooks
+
+set -euo pipefail
+
+# docker-proxy labels everything a job creates with the runner's name
+RUNNER_LABEL="gh-runner.runner"
+
+# Configuration (see usage)
+RUNNER_HOME="${RUNNER_HOME:-/actions-runner}"
+WORKDIR="${RUNNER_WORKDIR:-_work}"
+WORKDIR_KEEP="${SCRUB_WORKDIR_KEEP:-_tool,_temp}"
+CACHE_ROOTS="${SCRUB_CACHE_ROOTS:-${HOME}/.cache:${HOME}/.venv}"
+CACHE_ALLOWLIST="${SCRUB_CACHE_ALLOWLIST:-pip}"
+# socat (control and job sockets) and busybox (status endpoint) belong to the
+# supervisor, which runs as this user when the container does not start as root
+KEEP_PROCESSES="${SCRUB_KEEP_PROCESSES:-Runner.Listener,Runner.Worker,run.sh,run-helper.sh,entrypoint.sh,socat,busybox}"
+
+DRY_RUN="false"
+PARTS=()
+
+usage() {
+    cat << EOF
+Usage: $(basename "$0") [OPTIONS]
+
+Remove everything a job left behind so the next job on a persistent runner
+starts clean. Runs from the completed job hook when RUNNER_SCRUB=true.
+
+Parts:
+  workdir       Wipe RUNNER_WORKDIR except SCRUB_WORKDIR_KEEP entries
+  caches        In each SCRUB_CACHE_ROOTS directory, keep only SCRUB_CACHE_ALLOWLIST entries
+  processes     Kill processes owned by this user except the runner itself
+  docker        Remove every container, network and volume docker-proxy
+                labelled with this runner's name (${RUNNER_LABEL}=\$RUNNER_NAME);
+                skipped when RUNNER_NAME is unset
+
+Options:
+  -h, --help        Show this help message
+  --only <part>     Run a single part (repeatable)
+  --dry-run         Show what would be removed
+
+Environment Variables:
+  RUNNER_WORKDIR          Runner work directory (default: _work, relative to ${RUNNER_HOME})
+  SCRUB_WORKDIR_KEEP      Comma-separated entries of the work directory to keep (default: _tool,_temp)
+  SCRUB_CACHE_ROOTS       Colon-separated cache directories to scrub (default: ~/.cache:~/.venv)
+  SCRUB_CACHE_ALLOWLIST   Comma-separated entry names kept in every cache root (default: pip)
+  SCRUB_KEEP_PROCESSES    Comma-separated process names never killed
+EOF
+}
+
+log() {
+    echo "[scrub] $*"
+}
+
+# Remove a path, or just report it in dry-run mode
+remove_path() {
+    if [[ "${DRY_RUN}" == "true" ]]; then
+        log "would remove $1"
+        return 0
+    fi
+    rm -rf -- "$1" 2>/dev/null || log "WARNING: could not remove $1"
+}
+
+# True if $1 is in the comma-separated list $2
+in_list() {
+    [[ ",$2," == *",$1,"* ]]
+}
+
+scrub_workdir() {
+    local work_root="${WORKDIR}"
+    if [[ "${work_root}" != /* ]]; then
+        work_root="${RUNNER_HOME}/${work_root}"
+    fi
+
+    if [[ ! -d "${work_root}" ]]; then
+        return 0
+    fi
+
+    log "Wiping ${work_root} (keeping ${WORKDIR_KEEP})"
+    local entry
+    for entry in "${work_root}"/* "${work_root}"/.[!.]*; do
+        [[ -e "${entry}" ]] || continue
+        in_list "$(basename "${entry}")" "${WORKDIR_KEEP}" && continue
+        remove_path "${entry}"
+    done
+}
+
+scrub_caches() {
+    local roots root entry
+    IFS=':' read -r -a roots <<< "${CACHE_ROOTS}"
+
+    for root in "${roots[@]}"; do
+        [[ -n "${root}" && -d "${root}" ]] || continue
+        log "Scrubbing ${root} (keeping ${CACHE_ALLOWLIST})"
+        for entry in "${root}"/* "${root}"/.[!.]*; do
+            [[ -e "${entry}" ]] || continue
+            in_list "$(basename "${entry}")" "${CACHE_ALLOWLIST}" && continue
+            remove_path "${entry}"
+        done
+    done
+}
+
+# PIDs of this process and its ancestors (the hook, the worker and the listener)
+ancestor_pids() {
+    local pid=$$
+    while [[ -n "${pid}" && "${pid}" -gt 0 ]]; do
+        echo "${pid}"
+        pid=$(awk '{ print $4 }' "/proc/${pid}/stat" 2>/dev/null || true)
+    done
+}
+
+scrub_processes() {
+    if [[ "$(id -u)" -eq 0 ]]; then
+        log "Running as root; skipping process cleanup"
+        return 0
+    fi
+
+    local ancestors procs
+    ancestors=" $(ancestor_pids | tr '\n' ' ') "
+    procs=$(ps -u "$(id -u)" -o pid=,comm=)
+
+    local pid comm stray=()
+    while read -r pid comm; do
+        [[ "${ancestors}" == *" ${pid} "* ]] && continue
+        # Skip processes that already exited (including the ps above)
+        [[ -d "/proc/${pid}" ]] || continue
+        in_list "${comm}" "${KEEP_PROCESSES}" && continue
+        stray+=("${pid}")
+        log "Stray process ${pid} (${comm}): $(tr '\0' ' ' < "/proc/${pid}/cmdline" 2>/dev/null | cut -c1-120)"
+    done <<< "${procs}"
+
+    if [[ ${#stray[@]} -eq 0 || "${DRY_RUN}" == "true" ]]; then
+        return 0
+    fi
+
+    kill -TERM "${stray[@]}" 2>/dev/null || true
+    local i
+    for i in 1 2 3 4 5; do
+        kill -0 "${stray[@]}" 2>/dev/null || return 0
+        sleep 1
+    done
+    kill -KILL "${stray[@]}" 2>/dev/null || true
+}
+
+docker_available() {
+    command -v docker >/dev/null 2>&1 && docker info >/dev/null 2>&1
+}
+
+# Function to list the IDs of containers, networks or volumes docker-proxy
+# labelled for this runner. Objects without the label may belong to other
+# runners sharing the daemon, so they are never listed.
+job_objects() {
+    local kind="$1"
+    local list=(docker container ls -aq --no-trunc)
+    case "${kind}" in
+        networks) list=(docker network ls -q --no-trunc) ;;
+        volumes) list=(docker volume ls -q) ;;
+    esac
+
+    "${list[@]}" --filter "label=${RUNNER_LABEL}=${RUNNER_NAME}"
+}
+
+scrub_docker() {
+    if [[ -z "${RUNNER_NAME:-}" ]]; then
+        log "RUNNER_NAME is not set; skipping Docker cleanup"
+        return 0
+    fi
+    docker_available || return 0
+
+    local id
+    while read -r id; do
+        [[ -n "${id}" ]] || continue
+        log "Removing container ${id:0:12} ($(docker inspect -f '{{.Name}} {{.Config.Image}}' "${id}" 2>/dev/null))"
+        [[ "${DRY_RUN}" == "true" ]] || docker rm -f -v "${id}" >/dev/null 2>&1 || log "WARNING: could not remove container ${id:0:12}"
+    done < <(job_objects containers)
+
+    while read -r id; do
+        [[ -n "${id}" ]] || continue
+        log "Removing network ${id:0:12} ($(docker network inspect -f '{{.Name}}' "${id}" 2>/dev/null))"
+        [[ "${DRY_RUN}" == "true" ]] || docker network rm "${id}" >/dev/null 2>&1 || log "WARNING: could not remove network ${id:0:12}"
+    done < <(job_objects networks)
+
+    while read -r id; do
+        [[ -n "${id}" ]] || continue
+        log "Removing volume ${id}"
+        [[ "${DRY_RUN}" == "true" ]] || docker volume rm "${id}" >/dev/null 2>&1 || log "WARNING: could not remove volume ${id}"
+    done < <(job_objects volumes)
+}
+
+main() {
+    while [[ $# -gt 0 ]]; do
+        case $1 in
+            -h|--help)
+                usage
+                exit 0
+                ;;
+            --only)
+                PARTS+=("$2")
+                shift 2
+                ;;
+            --dry-run)
+                DRY_RUN="true"
+                shift
+                ;;
+            *)
+                echo "Unknown option: $1" >&2
+                usage
+                exit 2
+                ;;
+        esac
+    done
+
+    if [[ ${#PARTS[@]} -eq 0 ]]; then
+        PARTS=(docker processes workdir caches)
+    fi
+
+    local part
+    for part in "${PARTS[@]}"; do
+        case "${part}" in
+            workdir)   scrub_workdir ;;
+            caches)    scrub_caches ;;
+            processes) scrub_processes ;;
+            docker)    scrub_docker ;;
+            *)
+                echo "Unknown part: ${part}" >&2
+                exit 2
+                ;;
+        esac
+    done
+}
+
+main "$@"
@@ -0,0 +1,144 @@
+#!/bin/bash
+# docker/linux/base/scripts/toolcache.sh
+# Install toolchains into the hosted tool cache layout actions/setup-* use
+# Installed into the base image as /usr/local/bin/toolcache
+
+set -euo pipefail
+
+TOOL_CACHE="${RUNNER_TOOL_CACHE:-/opt/hostedtoolcache}"
+
+usage() {
+    cat << EOF
+Usage: $(basename "$0") install <tool> <version> <url> <lockfile> <lock-name> <lock-platform>
+       $(basename "$0") path <tool> <version>
+       $(basename "$0") mark <tool> <version>
+       $(basename "$0") link <tool> <version-prefix> <path> [bindir]
+       $(basename "$0") list [tool]
+
+Packs bake toolchains into ${TOOL_CACHE}/<tool>/<version>/<arch> with an
+<arch>.complete marker, the layout @actions/tool-cache reads, so
+actions/setup-node, setup-go, ... find them without downloading.
+
+Commands:
+  install  Download <url>, check it against <lockfile> with lock-verify, unpack
+           it without its top-level directory and mark the version complete
+  path     Print the cache directory of <tool> <version>, for toolchains built
+           from source straight into the cache (their prefix is baked in)
+  mark     Mark a version built into its cache directory complete
+  link     Point <path> at the newest cached <tool> matching <version-prefix>
+           (20 matches 20.17.0, 1.22 matches 1.22.7) and link the executables
+           in its bin/ into <bindir>; this is the default outside setup-*
+  list     Print the complete versions of one tool, or of every tool
+
+Examples:
+  $(basename "$0") install go 1.22.7 https://go.dev/dl/go1.22.7.linux-amd64.tar.gz /tmp/go.lock go linux-amd64
+  ruby-build 3.3.6 "\$($(basename "$0") path Ruby 3.3.6)" && $(basename "$0") mark Ruby 3.3.6
+  $(basename "$0") link node 20 /usr/local/node /usr/local/bin
+  $(basename "$0") link go 1.22 /usr/local/go
+EOF
+}
+
+fail() {
+    echo "[toolcache] ERROR: $*" >&2
+    exit 1
+}
+
+# Tool cache architecture name (matches os.arch() in Node.js)
+cache_arch() {
+    case "$(uname -m)" in
+        x86_64) echo "x64" ;;
+        aarch64) echo "arm64" ;;
+        *) uname -m ;;
+    esac
+}
+
+# Print complete versions of a tool, oldest first
+complete_versions() {
+    local tool="$1" arch
+    arch=$(cache_arch)
+    local marker
+    for marker in "${TOOL_CACHE}/${tool}"/*/"${arch}.complete"; do
+        [[ -f "${marker}" ]] || continue
+        basename "$(dirname "${marker}")"
+    done | sort -V
+}
+
+cmd_install() {
+    [[ $# -eq 6 ]] || { usage; exit 2; }
+    local tool="$1" version="$2" url="$3" lockfile="$4" lock_name="$5" lock_platform="$6"
+    local arch dest archive
+    arch=$(cache_arch)
+    dest="${TOOL_CACHE}/${tool}/${version}/${arch}"
+    archive=$(mktemp)
+
+    curl -fsSL -o "${archive}" "${url}"
+    lock-verify file "${lockfile}" "${lock_name}" "${version}" "${lock_platform}" "${archive}"
+
+    rm -rf "${dest}" "${dest}.complete"
+    mkdir -p "${dest}"
+    tar -xf "${archive}" -C "${dest}" --strip-components=1
+    rm -f "${archive}"
+    touch "${dest}.complete"
+
+    echo "[toolcache] Installed ${tool} ${version} in ${dest}"
+}
+
+cmd_path() {
+    [[ $# -eq 2 ]] || { usage; exit 2; }
+    echo "${TOOL_CACHE}/$1/$2/$(cache_arch)"
+}
+
+cmd_mark() {
+    [[ $# -eq 2 ]] || { usage; exit 2; }
+    local dest
+    dest=$(cmd_path "$1" "$2")
+    [[ -d "${dest}" ]] || fail "${dest} does not exist"
+    touch "${dest}.complete"
+    echo "[toolcache] Marked $1 $2 complete"
+}
+
+cmd_link() {
+    [[ $# -eq 3 || $# -eq 4 ]] || { usage; exit 2; }
+    local tool="$1" prefix="$2" path="$3" bindir="${4:-}"
+    local version
+    version=$(complete_versions "${tool}" | awk -v p="${prefix}" '$0 == p || index($0, p ".") == 1' | tail -n 1)
+    [[ -n "${version}" ]] || fail "No cached ${tool} version matches ${prefix} (have: $(complete_versions "${tool}" | paste -sd ' '))"
+
+    ln -sfn "${TOOL_CACHE}/${tool}/${version}/$(cache_arch)" "${path}"
+    if [[ -n "${bindir}" ]]; then
+        local bin
+        for bin in "${path}"/bin/*; do
+            [[ -x "${bin}" ]] && ln -sf "${path}/bin/$(basename "${bin}")" "${bindir}/"
+        done
+    fi
+
+    echo "[toolcache] ${path} -> ${tool} ${version}"
+}
+
+cmd_list() {
+    local tools=("$@") tool
+    if [[ ${#tools[@]} -eq 0 ]]; then
+        for tool in "${TOOL_CACHE}"/*/; do
+            [[ -d "${tool}" ]] && tools+=("$(basename "${tool}")")
+        done
+    fi
+    for tool in "${tools[@]}"; do
+        complete_versions "${tool}" | sed "s/^/${tool} /"
+    done
+}
+
+main() {
+    local command="${1:-}"
+    shift || true
+    case "${command}" in
+        install) cmd_install "$@" ;;
+        path) cmd_path "$@" ;;
+        mark) cmd_mark "$@" ;;
+        link) cmd_link "$@" ;;
+        list) cmd_list "$@" ;;
+        -h|--help) usage ;;
+        *) usage; exit 2 ;;
+    esac
+}
+
+main "$@"
@@ -0,0 +1,19 @@
+# docker/linux/composite/hooks.d/cpp-only/completed/55-compiler-cache.sh
+# Report the job's ccache and sccache hits, and stop the sccache server so the
+# next job starts its own
+
+read -r hits misses < <(ccache --print-stats 2>/dev/null | awk -F'\t' '
+    $1 == "direct_cache_hit" || $1 == "preprocessed_cache_hit" { hits += $2 }
+    $1 == "cache_miss" { misses += $2 }
+    END { print hits + 0, misses + 0 }')
+if [[ $((hits + misses)) -gt 0 ]]; then
+    hook_log "ccache: ${hits} hit(s), ${misses} miss(es)"
+fi
+
+if pgrep -u "$(id -u)" -x sccache >/dev/null; then
+    read -r hits misses < <(sccache --stop-server 2>/dev/null | awk '
+        $1 == "Cache" && $2 == "hits" && NF == 3 { hits = $3 }
+        $1 == "Cache" && $2 == "misses" && NF == 3 { misses = $3 }
+        END { print hits + 0, misses + 0 }')
+    hook_log "sccache: ${hits} hit(s), ${misses} miss(es)"
+fi
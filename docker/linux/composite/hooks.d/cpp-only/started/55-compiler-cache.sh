@@ -0,0 +1,8 @@
+# docker/linux/composite/hooks.d/cpp-only/started/55-compiler-cache.sh
+# Reset the ccache counters so the completed hook reports this job's hits
+
+if ! ccache --zero-stats >/dev/null 2>&1; then
+    hook_warn "ccache cannot use ${CCACHE_DIR:-~/.cache/ccache}; compilations through it will fail"
+    exit 0
+fi
+hook_log "ccache: $(ccache --get-config max_size) max in ${CCACHE_DIR:-~/.cache/ccache}"
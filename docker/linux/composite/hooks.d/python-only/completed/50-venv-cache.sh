@@ -0,0 +1,13 @@
+# docker/linux/composite/hooks.d/python-only/completed/50-venv-cache.sh
+# Report the virtualenvs the job reused (hit) or had to build (miss)
+
+job_log=/run/gh-runner/venv-cache.log
+[[ -f "${job_log}" ]] || exit 0
+
+hits=$(grep -c '^hit ' "${job_log}" || true)
+misses=$(grep -c '^miss ' "${job_log}" || true)
+hook_log "venv-cache: ${hits} hit(s), ${misses} miss(es)"
+while read -r result key dir took; do
+    hook_log "venv-cache: ${result} ${key} ${dir}${took:+ (built in ${took})}"
+done < "${job_log}"
+rm -f "${job_log}"
@@ -0,0 +1,7 @@
+# docker/linux/composite/hooks.d/python-only/started/50-python-info.sh
+# Log the Python toolchain available to the job
+
+hook_log "Python: $(python3 --version 2>&1), $(pip3 --version 2>/dev/null | awk '{print "pip " $2}')"
+if [[ -n "${VIRTUAL_ENV:-}" ]]; then
+    hook_log "Active virtualenv: ${VIRTUAL_ENV}"
+fi
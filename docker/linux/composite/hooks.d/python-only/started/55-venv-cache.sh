@@ -0,0 +1,8 @@
+# docker/linux/composite/hooks.d/python-only/started/55-venv-cache.sh
+# Evict the least recently used cached virtualenvs before the job can add one
+# (VENV_CACHE_MAX_MB, see venv-cache --help)
+
+rm -f /run/gh-runner/venv-cache.log
+venv-cache prune 2>&1 | sed 's/^\[venv-cache\] //' | while IFS= read -r line; do
+    hook_log "venv-cache: ${line}"
+done
@@ -153,6 +153,15 @@ main() {
     log_info "Starting GitHub Actions Runner"
     log_info "================================="
 
+    # Send all outbound traffic through the egress proxy (the runner's only way out)
+    if [ -n "${EGRESS_PROXY:-}" ]; then
+        export HTTP_PROXY="$EGRESS_PROXY" HTTPS_PROXY="$EGRESS_PROXY"
+        export http_proxy="$EGRESS_PROXY" https_proxy="$EGRESS_PROXY"
+        export NO_PROXY="localhost,127.0.0.1,::1,egress-proxy,docker,docker-proxy${NO_PROXY:+,$NO_PROXY}"
+        export no_proxy="$NO_PROXY"
+        log_info "Outbound traffic goes through the egress proxy at $EGRESS_PROXY"
+    fi
+
     # Change to work directory
     cd "$WORK_DIR" || {
         log_error "Failed to change to work directory: $WORK_DIR"
@@ -186,6 +195,20 @@ main() {
         fi
     fi
 
+    # Wait for the daemon in DOCKER_HOST (docker-proxy or a Docker-in-Docker sidecar)
+    if [ -n "${DOCKER_HOST:-}" ] && [ "${DOCKER_WAIT_SECONDS:-60}" -gt 0 ] && command -v docker &> /dev/null; then
+        log_info "Waiting for Docker at $DOCKER_HOST..."
+        local waited=0
+        until docker version &> /dev/null; do
+            if [ "$waited" -ge "${DOCKER_WAIT_SECONDS:-60}" ]; then
+                log_warn "Docker at $DOCKER_HOST did not answer within ${DOCKER_WAIT_SECONDS:-60}s"
+                break
+            fi
+            sleep 2
+            waited=$((waited + 2))
+        done
+    fi
+
     log_info "================================="
     log_info "Starting runner process..."
     log_info "Runner Name: $RUNNER_NAME"
@@ -4,9 +4,434 @@
 
 set -e
 
-# Function to log messages with timestamp
+# Logging: LOG_LEVEL filters messages, LOG_FORMAT=json emits one JSON object per line
+LOG_LEVEL="${LOG_LEVEL:-INFO}"
+LOG_FORMAT="${LOG_FORMAT:-text}"
+LOG_PHASE="startup"
+
+# Values that must never reach the logs (see mark_secret)
+SECRET_VALUES=()
+
+# Token formats redacted even when the value was never marked: classic, OAuth,
+# user-to-server, server-to-server and refresh tokens, and fine-grained PATs
+TOKEN_PATTERN='(gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})'
+
+# Function to register a value for redaction
+mark_secret() {
+    local value="$1"
+    # Short values would redact ordinary words
+    if [ ${#value} -ge 8 ]; then
+        SECRET_VALUES+=("${value}")
+    fi
+}
+
+# Function to list exported variables that look like credentials
+secret_env_names() {
+    local name
+    for name in $(compgen -e); do
+        case "${name}" in
+            *_TOKEN|*_PAT|*_PASSWORD|*_SECRET|*_PRIVATE_KEY)
+                echo "${name}"
+                ;;
+        esac
+    done
+}
+
+# Function to mark every variable that looks like a credential as secret
+mark_secret_env() {
+    local name
+    for name in $(secret_env_names); do
+        mark_secret "${!name}"
+    done
+}
+
+# Function to strip secrets from text
+redact() {
+    local text="$*"
+    local secret
+    for secret in "${SECRET_VALUES[@]}"; do
+        text="${text//"${secret}"/[REDACTED]}"
+    done
+    printf '%s\n' "${text}" | sed -E \
+        -e "s/${TOKEN_PATTERN}/[REDACTED]/g" \
+        -e 's/("token"[[:space:]]*:[[:space:]]*")[^"]*"/\1[REDACTED]"/g' \
+        -e 's/((Authorization: *(token|Bearer|Basic)|--token)[[:space:]]+)[^[:space:]]+/\1[REDACTED]/g'
+}
+
+# Credentials that can also be read from NAME_FILE or /run/secrets/<name>
+SECRET_VARS=(GITHUB_TOKEN GITHUB_APP_PRIVATE_KEY)
+SECRETS_DIR="/run/secrets"
+
+# Function to read a credential from NAME, NAME_FILE or the Docker secrets directory
+load_secret() {
+    local name="$1"
+    local file_var="${name}_FILE"
+    local file="${!file_var:-}"
+
+    if [ -n "${!name:-}" ] && [ -n "${file}" ]; then
+        log_error "Both ${name} and ${file_var} are set; use only one"
+        return 1
+    fi
+
+    if [ -z "${!name:-}" ] && [ -z "${file}" ] && [ -f "${SECRETS_DIR}/${name,,}" ]; then
+        file="${SECRETS_DIR}/${name,,}"
+    fi
+
+    if [ -n "${file}" ]; then
+        if [ ! -r "${file}" ]; then
+            log_error "Cannot read ${name} from ${file}"
+            return 1
+        fi
+        # Command substitution drops the trailing newline editors add
+        printf -v "${name}" '%s' "$(cat "${file}")"
+        log "Read ${name} from ${file}"
+    fi
+
+    mark_secret "${!name:-}"
+    unset "${file_var}"
+}
+
+# Function to keep credentials in this shell only, out of every child's environment
+scrub_secret_env() {
+    local name
+    for name in "${SECRET_VARS[@]}" $(secret_env_names); do
+        export -n "${name}" 2>/dev/null || true
+    done
+}
+
+# Function to map a level name to a number for filtering
+log_level_value() {
+    case "${1^^}" in
+        DEBUG) echo 10 ;;
+        WARN|WARNING) echo 30 ;;
+        ERROR) echo 40 ;;
+        *) echo 20 ;;
+    esac
+}
+
+# Function to log a redacted message at a level
+log_at() {
+    local level="$1"
+    shift
+
+    if [ "$(log_level_value "${level}")" -lt "$(log_level_value "${LOG_LEVEL}")" ]; then
+        return 0
+    fi
+
+    local message
+    message="$(redact "$*")"
+    if [ "${LOG_FORMAT}" = "json" ]; then
+        jq -cn \
+            --arg time "$(date -u '+%Y-%m-%dT%H:%M:%SZ')" \
+            --arg level "${level}" \
+            --arg runner "${RUNNER_NAME:-}" \
+            --arg phase "${LOG_PHASE}" \
+            --arg msg "${message}" \
+            '{time: $time, level: $level, runner: $runner, phase: $phase, msg: $msg}'
+    elif [ "${level}" = "INFO" ]; then
+        echo "[$(date '+%Y-%m-%d %H:%M:%S')] ${message}"
+    else
+        echo "[$(date '+%Y-%m-%d %H:%M:%S')] ${level}: ${message}"
+    fi
+}
+
+# Functions to log messages with timestamp
 log() {
-    echo "[$(date '+%Y-%m-%d %H:%M:%S')] $*"
+    log_at INFO "$@"
+}
+
+log_debug() {
+    log_at DEBUG "$@"
+}
+
+log_warn() {
+    log_at WARN "$@"
+}
+
+log_error() {
+    log_at ERROR "$@"
+}
+
+# Status document served by the status endpoint (www/). Only the supervisor
+# writes here; /run/gh-runner is the job state the runner user's hooks write
+STATUS_DIR="/run/gh-runner-status"
+STATUS_PORT="${STATUS_PORT:-8080}"
+
+# Supervisor state only root can reach: the runner's pid and exit code, the
+# deprecation flag and the deregistration control socket
+SUPERVISOR_DIR="/run/gh-runner-supervisor"
+CONTROL_SOCKET="${SUPERVISOR_DIR}/control.sock"
+
+# Privilege broker for hardened runners: root-owned, runner may connect
+PRIV_DIR="/run/gh-runner-priv"
+PRIV_SOCKET="${PRIV_DIR}/priv.sock"
+
+# Job socket: root-owned, runner may connect. The job hooks report job starts
+# and ends here, and the supervisor calls the servers' /job endpoints for them
+# with the tokens in CONTROL_TOKEN_DIR (<service>.token), which jobs cannot read
+JOB_DIR="/run/gh-runner-job"
+JOB_SOCKET="${JOB_DIR}/job.sock"
+CONTROL_TOKEN_DIR="/run/gh-runner-control"
+JOB_SERVICES=(egress-proxy)
+
+# Exit code used when GitHub no longer accepts the baked RUNNER_VERSION.
+# Restarting the same image cannot recover; orchestration should pull a newer one.
+EXIT_RUNNER_DEPRECATED=78
+
+# Runner output that means the baked version must be replaced: the listener's
+# own messages, after its "<date> <time>Z: " prefix and "An error occurred: ",
+# never the job names it prints after "Running job: "
+RUNNER_DEPRECATION_PATTERN='^([0-9]{4}-[0-9]{2}-[0-9]{2} [0-9]{2}:[0-9]{2}:[0-9]{2}Z: )?(An error occurred: )?Runner (version v?[0-9][0-9.]* is deprecated|update is required|(auto-?)?updates? (is|are) disabled)'
+
+# Labels the image adds to RUNNER_LABELS: comma-separated, one file per pack
+LABELS_DIR="/etc/gh-runner/labels.d"
+
+# Function to create the supervisor's state directories. As root they are
+# recreated root-owned on every start, so nothing left in them (a symlink, a
+# pid) is trusted, and only www/ is readable by other users. Started as
+# another user there is no boundary to keep, and they go to a private /tmp
+# directory instead.
+prepare_state_dirs() {
+    if [ "$(id -u)" -eq 0 ]; then
+        rm -rf "${STATUS_DIR}" "${SUPERVISOR_DIR}"
+        install -d -o root -g root -m 0700 "${SUPERVISOR_DIR}"
+        install -d -o root -g root -m 0755 "${STATUS_DIR}" "${STATUS_DIR}/www" "${JOB_DIR}"
+        return 0
+    fi
+
+    local state_dir
+    state_dir=$(mktemp -d /tmp/gh-runner-state.XXXXXX) || return 1
+    STATUS_DIR="${state_dir}/status"
+    SUPERVISOR_DIR="${state_dir}/supervisor"
+    CONTROL_SOCKET="${SUPERVISOR_DIR}/control.sock"
+    JOB_DIR="${state_dir}/job"
+    JOB_SOCKET="${JOB_DIR}/job.sock"
+    mkdir -p "${STATUS_DIR}/www" "${SUPERVISOR_DIR}" "${JOB_DIR}"
+}
+
+# Function to write the status document served on STATUS_PORT
+write_status() {
+    local state="$1"
+    local message="${2:-}"
+
+    LOG_PHASE="${state}"
+    mkdir -p "${STATUS_DIR}/www" 2>/dev/null || return 0
+
+    jq -n \
+        --arg runner "${RUNNER_NAME}" \
+        --arg state "${state}" \
+        --arg message "${message}" \
+        --arg version "${RUNNER_VERSION:-unknown}" \
+        --arg latest "${RUNNER_LATEST_VERSION:-}" \
+        --arg disable_update "${RUNNER_DISABLE_AUTO_UPDATE:-true}" \
+        --arg updated "$(date -u '+%Y-%m-%dT%H:%M:%SZ')" \
+        '{
+            runner: $runner,
+            state: $state,
+            message: $message,
+            runner_version: $version,
+            latest_version: (($latest | select(. != "")) // null),
+            update_available: ($latest != "" and $latest != $version),
+            deprecated: ($state == "deprecated"),
+            auto_update: ($disable_update != "true"),
+            updated_at: $updated
+        }' > "${STATUS_DIR}/www/status.json.tmp" 2>/dev/null && \
+        mv "${STATUS_DIR}/www/status.json.tmp" "${STATUS_DIR}/www/status.json"
+}
+
+# Function to serve the status document (curl http://localhost:${STATUS_PORT}/)
+start_status_server() {
+    if [ "${STATUS_PORT}" = "0" ]; then
+        return 0
+    fi
+
+    if ! command -v busybox >/dev/null 2>&1; then
+        log_warn "busybox not found, status endpoint disabled"
+        return 0
+    fi
+
+    ln -sf status.json "${STATUS_DIR}/www/index.html"
+    if busybox httpd -p "${STATUS_PORT}" -h "${STATUS_DIR}/www"; then
+        log "Status endpoint listening on port ${STATUS_PORT}"
+    else
+        log_warn "Could not start status endpoint on port ${STATUS_PORT}"
+    fi
+}
+
+# Function to return the API path of the runner's repository or organization
+runner_api_path() {
+    if [ -n "${GITHUB_REPOSITORY}" ]; then
+        echo "repos/${GITHUB_REPOSITORY}"
+    else
+        echo "orgs/${GITHUB_OWNER}"
+    fi
+}
+
+# Function to call the GitHub API; prints the body followed by the HTTP status on
+# its own line. The token reaches curl on stdin, never on its command line, where
+# any process could read it from /proc/<pid>/cmdline.
+github_api() {
+    local method="$1"
+    local path="$2"
+
+    curl -s --max-time "${TIMEOUT_SECONDS:-30}" -w "\n%{http_code}" -X "${method}" \
+        -H "Accept: application/vnd.github.v3+json" \
+        --config - \
+        "https://api.github.com/${path}" <<< "header = \"Authorization: token ${GITHUB_TOKEN}\""
+}
+
+# Function to print a tool's label and its versioned label (node-20, go-1.22):
+# the major version for Node.js and Java, major.minor for everything else
+tool_labels() {
+    local tool="$1" version="$2"
+    [ -n "${version}" ] || return 0
+    case "${tool}" in
+        node|java) version="${version%%.*}" ;;
+        *) version=$(cut -d. -f1,2 <<< "${version}") ;;
+    esac
+    echo "${tool}"
+    echo "${tool}-${version}"
+}
+
+# Function to print the labels the image supports, one per line: OS, distribution,
+# architecture, BUILD_STACK, the toolchains on PATH and in the hosted tool cache,
+# Docker access, and what the packs list in LABELS_DIR (gcc-12, clang-15, ...)
+detect_labels() {
+    local arch version tool file
+    echo linux
+    if [ -r /etc/os-release ]; then
+        # shellcheck disable=SC1091
+        (. /etc/os-release && echo "${ID}-${VERSION_ID}")
+    fi
+    case "$(uname -m)" in
+        x86_64) arch=x64 ;;
+        aarch64|arm64) arch=arm64 ;;
+        armv7l) arch=arm ;;
+        *) arch=$(uname -m) ;;
+    esac
+    echo "${arch}"
+    [ -z "${BUILD_STACK:-}" ] || echo "${BUILD_STACK}"
+
+    if command -v node >/dev/null 2>&1; then
+        version=$(node --version 2>/dev/null) || version=""
+        tool_labels node "${version#v}"
+    fi
+    if command -v go >/dev/null 2>&1; then
+        version=$(go env GOVERSION 2>/dev/null) || version=""
+        tool_labels go "${version#go}"
+    fi
+    # Only with pip: the distribution's python3 alone is not a Python toolchain
+    if python3 -m pip --version >/dev/null 2>&1; then
+        version=$(python3 -c 'import sys; print("%d.%d" % sys.version_info[:2])' 2>/dev/null) || version=""
+        tool_labels python "${version}"
+    fi
+    if command -v ruby >/dev/null 2>&1; then
+        version=$(ruby -e 'print RUBY_VERSION' 2>/dev/null) || version=""
+        tool_labels ruby "${version}"
+    fi
+    if command -v java >/dev/null 2>&1; then
+        version=$(java -version 2>&1 | awk -F'"' '/version/ { print $2; exit }')
+        tool_labels java "${version#1.}"
+    fi
+    if command -v flutter-sdk >/dev/null 2>&1; then
+        while read -r version; do
+            tool_labels flutter "${version}"
+        done < <(flutter-sdk list 2>/dev/null | awk '{ print $NF }')
+    fi
+    if command -v dart >/dev/null 2>&1; then
+        version=$(dart --version 2>&1 | sed -n 's/^Dart SDK version: \([0-9.]*\).*/\1/p')
+        tool_labels dart "${version}"
+    fi
+    if command -v sdkmanager >/dev/null 2>&1; then
+        echo android
+    fi
+
+    # Versions actions/setup-* find offline
+    if command -v toolcache >/dev/null 2>&1; then
+        while read -r tool version; do
+            tool_labels "$(tr '[:upper:]' '[:lower:]' <<< "${tool}")" "${version}"
+        done < <(toolcache list 2>/dev/null)
+    fi
+
+    if command -v docker >/dev/null 2>&1 && { [ -n "${DOCKER_HOST:-}" ] || [ -S /var/run/docker.sock ]; }; then
+        echo docker
+    fi
+
+    for file in "${LABELS_DIR}"/*; do
+        [ -f "${file}" ] || continue
+        tr ',' '\n' < "${file}" | tr -d '[:blank:]'
+    done
+}
+
+# Function to print RUNNER_LABELS merged with the detected labels (unless
+# RUNNER_AUTO_LABELS=false), comma-separated and without duplicates. GitHub
+# compares labels case-insensitively, so only the first spelling is kept.
+runner_labels() {
+    {
+        tr ',' '\n' <<< "${RUNNER_LABELS}"
+        if [ "${RUNNER_AUTO_LABELS:-true}" = "true" ]; then
+            detect_labels
+        fi
+    } | tr -d '[:blank:]' | awk 'NF && !seen[tolower($0)]++' | paste -sd, -
+}
+
+# Function to compare the baked runner version with the one GitHub currently ships
+check_runner_version() {
+    local latest
+    latest=$(github_api GET "$(runner_api_path)/actions/runners/downloads" | head -n -1 |
+        jq -r '.[]? | select(.os == "linux" and .architecture == "x64") | .filename' 2>/dev/null |
+        sed -n 's/^actions-runner-linux-x64-\(.*\)\.tar\.gz$/\1/p' | head -n 1)
+
+    if [ -z "${latest}" ]; then
+        log "Could not determine the latest runner version from GitHub"
+        return 0
+    fi
+
+    RUNNER_LATEST_VERSION="${latest}"
+    if [ "${latest}" != "${RUNNER_VERSION}" ]; then
+        log "Image ships runner ${RUNNER_VERSION}, GitHub currently ships ${latest}; rebuild the image to upgrade"
+    fi
+}
+
+# Function to pass runner output through while watching for deprecation notices
+watch_runner_output() {
+    local line service
+    while IFS= read -r line; do
+        line="$(redact "${line}")"
+        if [ "${LOG_FORMAT}" = "json" ]; then
+            log "${line}"
+        else
+            echo "${line}"
+        fi
+        case "${line}" in
+            *": Running job: "*)
+                # Before any of its steps run: the started hooks may name it once
+                for service in "${JOB_SERVICES[@]}"; do
+                    touch "${SUPERVISOR_DIR}/${service}.starting"
+                done
+                ;;
+        esac
+        if [[ "${line}" =~ ${RUNNER_DEPRECATION_PATTERN} ]]; then
+            touch "${SUPERVISOR_DIR}/deprecated"
+            write_status "deprecated" "${line}"
+            stop_runner
+        fi
+    done
+}
+
+# Function to stop the runner listener if it is running
+stop_runner() {
+    if [ -f "${SUPERVISOR_DIR}/runner.pid" ]; then
+        kill -TERM "$(cat "${SUPERVISOR_DIR}/runner.pid")" 2>/dev/null || true
+    fi
+}
+
+# Function to exit when GitHub has reported the runner version as deprecated
+exit_if_deprecated() {
+    if [ -f "${SUPERVISOR_DIR}/deprecated" ]; then
+        log_error "GitHub no longer accepts runner ${RUNNER_VERSION}; pull a newer image"
+        exit ${EXIT_RUNNER_DEPRECATED}
+    fi
 }
 
 # Function to validate required environment variables
@@ -14,7 +439,7 @@ validate_environment() {
     local missing_vars=()
 
     if [ -z "${GITHUB_TOKEN}" ]; then
-        missing_vars+=("GITHUB_TOKEN")
+        missing_vars+=("GITHUB_TOKEN (or GITHUB_TOKEN_FILE)")
     fi
 
     if [ -z "${GITHUB_REPOSITORY}" ] && [ -z "${GITHUB_OWNER}" ]; then
@@ -26,9 +451,9 @@ validate_environment() {
     fi
 
     if [ ${#missing_vars[@]} -gt 0 ]; then
-        log "ERROR: Missing required environment variables:"
+        log_error "Missing required environment variables:"
         for var in "${missing_vars[@]}"; do
-            echo "  - $var"
+            log_error "  - $var"
         done
         return 1
     fi
@@ -48,46 +473,29 @@ configure_runner() {
 
     log "Configuring GitHub Actions runner for: ${runner_url}"
 
-    # Determine runner scope (repository or organization)
-    local runner_scope_arg
-    if [ -n "${GITHUB_REPOSITORY}" ]; then
-        runner_scope_arg="--url ${runner_url}"
-    else
-        runner_scope_arg="--url ${runner_url}"
-    fi
-
     # Generate registration token
     log "Generating registration token..."
     local registration_token_response
-    if [ -n "${GITHUB_REPOSITORY}" ]; then
-        registration_token_response=$(curl -s -w "\n%{http_code}" -X POST \
-            -H "Authorization: token ${GITHUB_TOKEN}" \
-            -H "Accept: application/vnd.github.v3+json" \
-            "https://api.github.com/repos/${GITHUB_REPOSITORY}/actions/runners/registration-token")
-    else
-        registration_token_response=$(curl -s -w "\n%{http_code}" -X POST \
-            -H "Authorization: token ${GITHUB_TOKEN}" \
-            -H "Accept: application/vnd.github.v3+json" \
-            "https://api.github.com/orgs/${GITHUB_OWNER}/actions/runners/registration-token")
-    fi
+    registration_token_response=$(github_api POST "$(runner_api_path)/actions/runners/registration-token")
 
     local registration_token
     local response_body=$(echo "$registration_token_response" | head -n -1)
     local http_code=$(echo "$registration_token_response" | tail -n 1)
 
-    # Debug: show raw response
-    log "Raw API Response: $response_body"
-    log "HTTP Status Code: $http_code"
-
     registration_token=$(echo "$response_body" | jq -r '.token' 2>/dev/null)
+    if [ -n "${registration_token}" ] && [ "${registration_token}" != "null" ]; then
+        mark_secret "${registration_token}"
+    fi
+
+    log_debug "Registration token response (HTTP ${http_code}): ${response_body}"
 
     if [ -z "${registration_token}" ] || [ "${registration_token}" = "null" ]; then
-        log "ERROR: Failed to generate registration token. HTTP Status: ${http_code}"
+        log_error "Failed to generate registration token. HTTP Status: ${http_code}"
         # Try to extract error message with multiple fallbacks
         local error_msg=$(echo "$response_body" | jq -r '.message // .detail // .error // .errors[0].message // "Unknown error"' 2>/dev/null)
-        log "API Error: $error_msg"
-        log "Full response: $response_body"
-        log "Check GITHUB_TOKEN permissions and ensure it has 'repo' scope (classic PAT) or 'Actions: Read/Write' (fine-grained)."
+        log_error "API Error: $error_msg"
+        log_debug "Full response: $response_body"
+        log_error "Check GITHUB_TOKEN permissions and ensure it has 'repo' scope (classic PAT) or 'Actions: Read/Write' (fine-grained)."
         return 1
     fi
 
@@ -99,8 +507,11 @@ configure_runner() {
     local config_args=()
 
     # Add runner labels
-    if [ -n "${RUNNER_LABELS}" ]; then
-        config_args+=(--labels "${RUNNER_LABELS}")
+    local labels
+    labels=$(runner_labels)
+    if [ -n "${labels}" ]; then
+        log "Runner labels: ${labels}"
+        config_args+=(--labels "${labels}")
     fi
 
     # Add runner group if specified
@@ -118,85 +529,122 @@ configure_runner() {
         config_args+=(--replace)
     fi
 
-    # Run config.sh
-    ./config.sh \
+    # Disable self-update: updates are lost when the container restarts
+    if [ "${RUNNER_DISABLE_AUTO_UPDATE:-true}" = "true" ]; then
+        config_args+=(--disableupdate)
+    fi
+
+    # Run config.sh as the runner user; it writes .runner and .credentials for run.sh
+    as_runner ./config.sh \
         --url "${runner_url}" \
         --token "${registration_token}" \
         --name "${RUNNER_NAME}" \
         --unattended \
-        "${config_args[@]}"
+        "${config_args[@]}" 2>&1 | watch_runner_output
 
-    if [ $? -eq 0 ]; then
+    if [ "${PIPESTATUS[0]}" -eq 0 ]; then
         log "Runner configured successfully"
         return 0
     else
-        log "ERROR: Failed to configure runner"
+        log_error "Failed to configure runner"
         return 1
     fi
 }
 
+# Function to print the environment the runner and its jobs get: everything
+# exported except credentials (already unexported) and *_FILE pointers,
+# NUL-separated so values may contain newlines
+runner_environment() {
+    local name
+    for name in $(compgen -e); do
+        case "${name}" in
+            *_FILE|HOME|USER|LOGNAME)
+                continue
+                ;;
+        esac
+        printf '%s=%s\0' "${name}" "${!name}"
+    done
+
+    if [ "$(id -u)" -eq 0 ] && [ "${RUNNER_AS_ROOT}" != "true" ]; then
+        printf '%s\0' "HOME=/home/runner" "USER=runner" "LOGNAME=runner"
+    else
+        printf '%s\0' "HOME=${HOME}" "USER=$(id -un)" "LOGNAME=$(id -un)"
+    fi
+}
+
+# Function to run a command as the runner user with the sanitized environment.
+# When the supervisor runs as root the command gets a different UID, so it
+# cannot read the supervisor's /proc/<pid>/environ or memory.
+as_runner() {
+    local env_args=()
+    mapfile -d '' -t env_args < <(runner_environment)
+
+    if [ "$(id -u)" -eq 0 ] && [ "${RUNNER_AS_ROOT}" != "true" ]; then
+        setpriv --reuid=runner --regid=runner --init-groups -- env -i "${env_args[@]}" "$@"
+    else
+        env -i "${env_args[@]}" "$@"
+    fi
+}
+
 # Function to start the runner
 start_runner() {
     log "Starting GitHub Actions runner..."
 
-    # Check if we're running as root
-    local current_user=$(id -un)
-
     if [ "${RUNNER_AS_ROOT}" = "true" ]; then
-        log "Running as root (not recommended for production)"
-        ./run.sh
-    elif [ "${current_user}" = "runner" ]; then
-        # Already running as runner user - just run directly
-        log "Running as runner user: ${current_user}"
-        ./run.sh
-    else
-        # Running as root but need to switch to runner user
-        log "Running as root, switching to runner user for runner execution"
-        # Change ownership of /actions-runner to runner user
+        log_warn "Running jobs as root (not recommended for production); jobs can read the supervisor's credentials"
+    elif [ "$(id -u)" -eq 0 ]; then
+        log "Supervisor runs as root, runner and jobs run as the runner user"
         chown -R runner:runner /actions-runner 2>/dev/null || log "Note: Could not change ownership"
-        # Switch to runner user and start the runner
-        su runner -c "./run.sh"
+    else
+        log_warn "Supervisor runs as $(id -un); jobs share its user and can read GITHUB_TOKEN from /proc. Start the container as root (user: \"0:0\") to isolate credentials"
     fi
+
+    write_status "running"
+
+    # Run in the background so signals reach the trap while the runner is up.
+    # The pipeline only ends once watch_runner_output has logged the last line.
+    rm -f "${SUPERVISOR_DIR}/runner.exit"
+    {
+        as_runner ./run.sh &
+        echo $! > "${SUPERVISOR_DIR}/runner.pid"
+        local run_exit=0
+        wait $! || run_exit=$?
+        echo "${run_exit}" > "${SUPERVISOR_DIR}/runner.exit"
+    } 2>&1 | watch_runner_output &
+
+    wait $! || true
+    local runner_exit
+    runner_exit=$(cat "${SUPERVISOR_DIR}/runner.exit" 2>/dev/null || echo 1)
+    rm -f "${SUPERVISOR_DIR}/runner.pid" "${SUPERVISOR_DIR}/runner.exit"
+
+    exit_if_deprecated
+
+    write_status "stopped" "run.sh exited with code ${runner_exit}"
+    return ${runner_exit}
 }
 
-# Function to clean up runner on shutdown
+# Function to remove the runner registration from GitHub and the local configuration
 cleanup_runner() {
     log "Cleaning up runner..."
+    CLEANUP_RESULT="OK runner was not registered"
 
     if [ -f .runner ]; then
         # Try to remove the runner from GitHub
         if [ -n "${GITHUB_TOKEN}" ] && [ -n "${RUNNER_NAME}" ]; then
-            local runner_url
-            if [ -n "${GITHUB_REPOSITORY}" ]; then
-                runner_url="https://github.com/${GITHUB_REPOSITORY}"
-            else
-                runner_url="https://github.com/${GITHUB_OWNER}"
-            fi
-
-            # Get runner ID
-            local runner_id=$(./config.sh list | grep "${RUNNER_NAME}" | head -1 | awk '{print $1}')
+            local runner_id
+            runner_id=$(jq -r '.agentId // empty' .runner 2>/dev/null)
 
             if [ -n "${runner_id}" ]; then
                 log "Removing runner ${runner_id} from GitHub..."
 
-                local delete_response
-                if [ -n "${GITHUB_REPOSITORY}" ]; then
-                    delete_response=$(curl -s -w "\n%{http_code}" -X DELETE \
-                        -H "Authorization: token ${GITHUB_TOKEN}" \
-                        -H "Accept: application/vnd.github.v3+json" \
-                        "https://api.github.com/repos/${GITHUB_REPOSITORY}/actions/runners/${runner_id}")
-                else
-                    delete_response=$(curl -s -w "\n%{http_code}" -X DELETE \
-                        -H "Authorization: token ${GITHUB_TOKEN}" \
-                        -H "Accept: application/vnd.github.v3+json" \
-                        "https://api.github.com/orgs/${GITHUB_OWNER}/actions/runners/${runner_id}")
-                fi
-
-                local delete_code=$(echo "$delete_response" | tail -n 1)
-                if [ "$delete_code" -eq 204 ]; then
+                local delete_code
+                delete_code=$(github_api DELETE "$(runner_api_path)/actions/runners/${runner_id}" | tail -n 1)
+                if [ "$delete_code" = "204" ]; then
                     log "Runner ${runner_id} removed successfully"
+                    CLEANUP_RESULT="OK runner ${runner_id} removed"
                 else
-                    log "Failed to remove runner ${runner_id}. HTTP Status: ${delete_code}"
+                    log_warn "Failed to remove runner ${runner_id}. HTTP Status: ${delete_code}"
+                    CLEANUP_RESULT="ERROR removing runner ${runner_id} failed with HTTP ${delete_code}"
                 fi
             fi
         fi
@@ -210,12 +658,317 @@ cleanup_runner() {
 # Signal handlers for graceful shutdown
 cleanup_on_exit() {
     log "Received shutdown signal"
+    stop_runner
+    write_status "stopped" "shutdown signal received"
+    cleanup_runner
+    exit 0
+}
+
+# Function to deregister on request from the control socket (SIGUSR1) and exit
+deregister_on_request() {
+    log "Deregistration requested on the control socket"
+    stop_runner
     cleanup_runner
+    echo "${CLEANUP_RESULT}" > "${SUPERVISOR_DIR}/deregister.result"
+    write_status "stopped" "deregistered on request"
     exit 0
 }
 
+# Function to listen on the control socket. The socket only accepts
+# "deregister"; the token never leaves the supervisor, which does the work.
+start_control_socket() {
+    if [ "$(id -u)" -ne 0 ]; then
+        log_debug "Not running as root, control socket disabled"
+        return 0
+    fi
+
+    echo $$ > "${SUPERVISOR_DIR}/supervisor.pid"
+
+    if ! command -v socat >/dev/null 2>&1; then
+        log_warn "socat not found, control socket disabled"
+        return 0
+    fi
+
+    socat "UNIX-LISTEN:${CONTROL_SOCKET},fork,unlink-early,mode=0600" \
+        "EXEC:/entrypoint.sh --control-handler" >/dev/null 2>&1 &
+    log_debug "Control socket listening on ${CONTROL_SOCKET}"
+}
+
+# Function to listen on the job socket for the job hooks (see job_handler)
+start_job_socket() {
+    if ! command -v socat >/dev/null 2>&1; then
+        log_warn "socat not found, job hooks cannot reach the supervisor"
+        return 0
+    fi
+
+    local access="mode=0600"
+    if [ "$(id -u)" -eq 0 ]; then
+        access="mode=0660,user=root,group=runner"
+    fi
+    socat "UNIX-LISTEN:${JOB_SOCKET},fork,unlink-early,${access}" \
+        "EXEC:/entrypoint.sh --job-handler ${SUPERVISOR_DIR}" >/dev/null 2>&1 &
+    export RUNNER_JOB_SOCKET="${JOB_SOCKET}"
+    log_debug "Job socket listening on ${JOB_SOCKET}"
+}
+
+# Function to take sudo away from the runner user and start the privilege
+# broker (RUNNER_HARDENED=true). Jobs then request allow-listed operations
+# from /etc/gh-runner/priv-policy.conf with runner-priv.
+harden_runner() {
+    if [ "${RUNNER_HARDENED}" != "true" ]; then
+        return 0
+    fi
+
+    if [ "$(id -u)" -ne 0 ]; then
+        log_error "RUNNER_HARDENED=true needs the container to start as root (user: \"0:0\")"
+        return 1
+    fi
+    if [ "${RUNNER_AS_ROOT}" = "true" ]; then
+        log_error "RUNNER_HARDENED=true cannot be combined with RUNNER_AS_ROOT=true"
+        return 1
+    fi
+    if ! command -v socat >/dev/null 2>&1; then
+        log_error "socat not found, cannot start the privilege broker"
+        return 1
+    fi
+
+    rm -f /etc/sudoers.d/runner
+    gpasswd -d runner sudo >/dev/null 2>&1 || true
+    if grep -qs '^runner[[:space:]]' /etc/sudoers; then
+        log_error "/etc/sudoers still grants the runner user sudo"
+        return 1
+    fi
+
+    mkdir -p "${PRIV_DIR}"
+    chmod 0755 "${PRIV_DIR}"
+
+    # Audit lines from runner-priv --serve arrive on stderr
+    socat "UNIX-LISTEN:${PRIV_SOCKET},fork,unlink-early,mode=0660,user=root,group=runner" \
+        "EXEC:/usr/local/bin/runner-priv --serve" \
+        >/dev/null 2> >(while IFS= read -r line; do log "${line}"; done) &
+
+    log "Hardened mode: the runner user has no sudo; jobs use runner-priv (policy: /etc/gh-runner/priv-policy.conf)"
+}
+
+# Function to point the package managers of the runner and its jobs at the
+# shared package cache (CACHE_PROXY_URL, docker/pkg-cache): pip, npm/yarn/pnpm,
+# Go, RubyGems, Bundler and pub. Must run before configure_egress_proxy so the
+# cache is in NO_PROXY.
+configure_cache_proxy() {
+    if [ -z "${CACHE_PROXY_URL:-}" ]; then
+        return 0
+    fi
+
+    local url="${CACHE_PROXY_URL%/}"
+    local cache_host="${url#*://}"
+    cache_host="${cache_host%%[:/]*}"
+
+    # Fall back to the registries themselves while the cache is unreachable
+    export GOPROXY="${url}/go|https://proxy.golang.org,direct"
+    export PUB_HOSTED_URL="${url}/pub"
+    local extra="${NO_PROXY:-${no_proxy:-}}"
+    export NO_PROXY="${cache_host}${extra:+,${extra}}" no_proxy="${cache_host}${extra:+,${extra}}"
+
+    # The rest are read from the runner user's home
+    if ! as_runner bash -c '
+        set -e
+        url="$1" cache_host="$2"
+        mkdir -p "${HOME}/.config/pip" "${HOME}/.bundle"
+        {
+            echo "[global]"
+            echo "index-url = ${url}/pypi/simple/"
+            case "${url}" in http://*) echo "trusted-host = ${cache_host}" ;; esac
+        } > "${HOME}/.config/pip/pip.conf"
+        echo "registry=${url}/npm/" > "${HOME}/.npmrc"
+        printf -- "---\n:sources:\n- %s/gems/\n" "${url}" > "${HOME}/.gemrc"
+        printf -- "---\nBUNDLE_MIRROR__HTTPS://RUBYGEMS__ORG/: \"%s/gems/\"\n" "${url}" > "${HOME}/.bundle/config"
+    ' configure-cache-proxy "${url}" "${cache_host}"; then
+        log_error "Could not write the package manager configuration for ${url}"
+        return 1
+    fi
+    log "Packages are fetched through the package cache at ${url}"
+}
+
+# Function to send the runner's and every job's traffic through the egress
+# proxy (EGRESS_PROXY). The compose files attach the runner only to an
+# internal network, so the proxy is its only way out.
+configure_egress_proxy() {
+    if [ -z "${EGRESS_PROXY:-}" ]; then
+        return 0
+    fi
+
+    local proxy_host="${EGRESS_PROXY#*://}"
+    proxy_host="${proxy_host%%[:/]*}"
+    local no_proxy_list="localhost,127.0.0.1,::1,${proxy_host},docker,docker-proxy"
+    local extra="${NO_PROXY:-${no_proxy:-}}"
+    if [ -n "${extra}" ]; then
+        no_proxy_list="${no_proxy_list},${extra}"
+    fi
+
+    export HTTP_PROXY="${EGRESS_PROXY}" HTTPS_PROXY="${EGRESS_PROXY}"
+    export http_proxy="${EGRESS_PROXY}" https_proxy="${EGRESS_PROXY}"
+    export NO_PROXY="${no_proxy_list}" no_proxy="${no_proxy_list}"
+    log "Outbound traffic goes through the egress proxy at ${EGRESS_PROXY}"
+}
+
+# Function to wait until the daemon in DOCKER_HOST (docker-proxy or a
+# Docker-in-Docker sidecar) answers the runner user, so the first job that
+# uses Docker does not race it
+wait_for_docker() {
+    local timeout="${DOCKER_WAIT_SECONDS:-60}"
+    if [ -z "${DOCKER_HOST:-}" ] || [ "${timeout}" -eq 0 ]; then
+        return 0
+    fi
+    if ! command -v docker >/dev/null 2>&1; then
+        log_debug "DOCKER_HOST is set but this image has no docker CLI"
+        return 0
+    fi
+
+    log "Waiting for Docker at ${DOCKER_HOST}..."
+    local waited=0 version
+    until version=$(as_runner docker version --format '{{.Server.Version}}' 2>/dev/null); do
+        if [ ${waited} -ge ${timeout} ]; then
+            log_warn "Docker at ${DOCKER_HOST} did not answer within ${timeout}s; jobs that use Docker fail until it does"
+            return 0
+        fi
+        sleep 2
+        waited=$((waited + 2))
+    done
+    log "Docker ${version} at ${DOCKER_HOST} is ready"
+}
+
+# Function to answer one job socket connection (run by socat, with the
+# supervisor's state directory). The hooks run as the runner user, like the
+# job's steps, so the supervisor makes their calls:
+#
+#   <service> started <name>  name the job once, after the runner announced it
+#   <service> completed       end the job and print the server's report
+#
+# A job can end its record early, which only cuts its report short, but
+# cannot start another one before the runner's next job.
+job_handler() {
+    SUPERVISOR_DIR="${1:-${SUPERVISOR_DIR}}"
+    local service phase name url token
+    read -r -t 5 service phase name || true
+
+    case "${service}" in
+        egress-proxy)
+            url="${EGRESS_PROXY:-}"
+            ;;
+        *)
+            echo "ERROR unknown service '${service}' (supported: ${JOB_SERVICES[*]})"
+            return 1
+            ;;
+    esac
+    if [ -z "${url}" ]; then
+        echo "ERROR ${service} is not configured"
+        return 1
+    fi
+    if ! token=$(cat "${CONTROL_TOKEN_DIR}/${service}.token" 2>/dev/null) || [ -z "${token}" ]; then
+        echo "ERROR no control token for ${service} in ${CONTROL_TOKEN_DIR}"
+        return 1
+    fi
+
+    case "${phase}" in
+        started)
+            # The runner's output may reach the supervisor just after the hook
+            local waited=0
+            until mv "${SUPERVISOR_DIR}/${service}.starting" "${SUPERVISOR_DIR}/${service}.started" 2>/dev/null; do
+                if [ ${waited} -ge 5 ]; then
+                    echo "ERROR the runner has not started a job"
+                    return 1
+                fi
+                sleep 1
+                waited=$((waited + 1))
+            done
+            job_request PUT "${url%/}/job" "${token}" "${name}"
+            ;;
+        completed)
+            rm -f "${SUPERVISOR_DIR}/${service}.starting" "${SUPERVISOR_DIR}/${service}.started"
+            job_request DELETE "${url%/}/job" "${token}"
+            ;;
+        *)
+            echo "ERROR unknown request '${phase}' (supported: started, completed)"
+            return 1
+            ;;
+    esac
+}
+
+# Function to call a server's /job endpoint with its control token. The token
+# goes in through a file descriptor, never on a command line jobs can list.
+job_request() {
+    local method="$1" url="$2" token="$3" body="${4:-}"
+    local args=(-fsS --noproxy '*' -m 5 -X "${method}")
+    if [ -n "${body}" ]; then
+        args+=(--data-binary "${body}")
+    fi
+
+    local reply
+    if ! reply=$(curl "${args[@]}" -H @<(printf 'Authorization: Bearer %s\n' "${token}") "${url}" 2>&1); then
+        echo "ERROR ${reply}"
+        return 1
+    fi
+    if [ -n "${reply}" ]; then
+        printf '%s\n' "${reply}"
+    fi
+}
+
+# Function to answer one control socket connection (run by socat)
+control_handler() {
+    local command
+    read -r -t 5 command || true
+
+    case "${command}" in
+        deregister)
+            rm -f "${SUPERVISOR_DIR}/deregister.result"
+            kill -USR1 "$(cat "${SUPERVISOR_DIR}/supervisor.pid")" || {
+                echo "ERROR supervisor not running"
+                return 1
+            }
+
+            local waited=0
+            while [ ! -s "${SUPERVISOR_DIR}/deregister.result" ]; do
+                if [ ${waited} -ge $((${TIMEOUT_SECONDS:-30} + 30)) ]; then
+                    echo "ERROR timed out waiting for the supervisor"
+                    return 1
+                fi
+                sleep 1
+                waited=$((waited + 1))
+            done
+            cat "${SUPERVISOR_DIR}/deregister.result"
+            ;;
+        *)
+            echo "ERROR unknown command '${command}' (supported: deregister)"
+            return 1
+            ;;
+    esac
+}
+
 # Main execution
 main() {
+    # Control socket modes: the handler socat runs, and the client for operators
+    # (docker exec <container> /entrypoint.sh --deregister)
+    if [ "$1" = "--control-handler" ]; then
+        control_handler
+        return
+    fi
+    # Job socket handler (see job_handler)
+    if [ "$1" = "--job-handler" ]; then
+        job_handler "${2:-}"
+        return
+    fi
+    if [ "$1" = "--deregister" ]; then
+        echo deregister | socat -t "$((${TIMEOUT_SECONDS:-30} + 35))" - "UNIX-CONNECT:${CONTROL_SOCKET}"
+        return
+    fi
+
+    # Print the labels the runner would register with, without registering
+    # (docker run --rm gh-runner:python-only --print-labels)
+    if [ "$1" = "--print-labels" ]; then
+        runner_labels
+        return
+    fi
+
     # Display help if requested
     if [ "$1" = "--help" ] || [ "$1" = "-h" ]; then
         echo "GitHub Actions Runner Entrypoint"
@@ -227,12 +980,40 @@ main() {
         echo "  GITHUB_OWNER        - Organization name (for org runners, if GITHUB_REPOSITORY not set)"
         echo "  RUNNER_NAME         - Unique name for this runner instance"
         echo ""
+        echo "Credentials (GITHUB_TOKEN, GITHUB_APP_PRIVATE_KEY) can instead be read from a file"
+        echo "named by <NAME>_FILE, or from ${SECRETS_DIR}/<name> (Docker secrets). They are removed"
+        echo "from the environment before the runner starts, so jobs cannot read them."
+        echo ""
         echo "Optional Environment Variables:"
         echo "  RUNNER_LABELS       - Comma-separated labels for runner selection (default: 'linux')"
+        echo "  RUNNER_AUTO_LABELS  - Add labels detected from the image: OS, arch, BUILD_STACK, tool versions, docker (default: 'true')"
         echo "  RUNNER_GROUP        - Runner group name (default: 'Default')"
         echo "  RUNNER_WORKDIR      - Working directory for runner (default: '_work')"
         echo "  RUNNER_AS_ROOT      - Run runner as root (not recommended: 'true'/'false')"
+        echo "  RUNNER_HARDENED     - Remove sudo; jobs use runner-priv for allow-listed operations (default: 'false')"
         echo "  RUNNER_REPLACE_EXISTING - Replace existing runner with same name (default: 'false')"
+        echo "  RUNNER_DISABLE_AUTO_UPDATE - Pass --disableupdate to config.sh (default: 'true')"
+        echo "  STATUS_PORT         - Port of the JSON status endpoint, 0 to disable (default: '8080')"
+        echo "  TIMEOUT_SECONDS     - Timeout for each GitHub API request in seconds (default: '30')"
+        echo "  RUNNER_SCRUB        - Scrub workspace, processes, job containers and caches after each job (default: 'true')"
+        echo "  LOG_LEVEL           - Minimum level logged: DEBUG, INFO, WARN, ERROR (default: 'INFO')"
+        echo "  LOG_FORMAT          - 'text' or 'json' (one object per line with runner and phase) (default: 'text')"
+        echo "  EGRESS_PROXY        - Forward proxy for the runner and its jobs; sets HTTP(S)_PROXY and NO_PROXY (default: none)"
+        echo "  CACHE_PROXY_URL     - Shared package cache for pip, npm, Go, RubyGems and pub (default: none)"
+        echo "  DOCKER_WAIT_SECONDS - Wait this long for the daemon in DOCKER_HOST before starting, 0 to skip (default: '60')"
+        echo ""
+        echo "Credential Isolation:"
+        echo "  Started as root, the entrypoint keeps the token in its own process and runs"
+        echo "  config.sh, run.sh and every job as the runner user with a sanitized environment."
+        echo "  Deregister without handing out the token:"
+        echo "    docker exec <container> /entrypoint.sh --deregister"
+        echo ""
+        echo "Labels:"
+        echo "  Print the labels the runner registers with (RUNNER_LABELS and the detected ones):"
+        echo "    docker run --rm gh-runner:python-only --print-labels"
+        echo ""
+        echo "Exit Codes:"
+        echo "  ${EXIT_RUNNER_DEPRECATED}                  - GitHub reports the baked runner version as deprecated; pull a newer image"
         echo ""
         echo "Usage:"
         echo "  docker run -e GITHUB_TOKEN=... -e GITHUB_REPOSITORY=... -e RUNNER_NAME=... gh-runner:linux-base"
@@ -242,12 +1023,47 @@ main() {
 
     # Set up signal handlers
     trap cleanup_on_exit SIGTERM SIGINT
+    trap deregister_on_request SIGUSR1
+
+    # Register credentials for redaction before anything is logged
+    mark_secret_env
+
+    local name
+    for name in "${SECRET_VARS[@]}"; do
+        if ! load_secret "${name}"; then
+            write_status "error" "could not read ${name}"
+            exit 1
+        fi
+    done
+    scrub_secret_env
 
     log "Starting GitHub Actions Runner entrypoint"
 
+    if ! prepare_state_dirs; then
+        log_error "Could not create the supervisor's state directories"
+        exit 1
+    fi
+    write_status "starting"
+    start_status_server
+    start_control_socket
+
+    if ! configure_cache_proxy; then
+        write_status "error" "package cache could not be configured"
+        exit 1
+    fi
+
+    # Before harden_runner so the privilege broker's apt-get uses the proxy too
+    configure_egress_proxy
+
+    if ! harden_runner; then
+        write_status "error" "hardened mode could not be set up"
+        exit 1
+    fi
+
     # Validate environment
     if ! validate_environment; then
-        log "Environment validation failed"
+        log_error "Environment validation failed"
+        write_status "error" "environment validation failed"
         exit 1
     fi
 
@@ -262,17 +1078,27 @@ main() {
         log "Runner files copied successfully"
     fi
 
+    check_runner_version
+
+    # After the servers' URLs are final: the job handler inherits them
+    start_job_socket
+
     # Configure the runner if not already configured
     if [ ! -f .runner ]; then
         log "Runner not configured, starting configuration..."
+        write_status "configuring"
         if ! configure_runner; then
-            log "Failed to configure runner"
+            exit_if_deprecated
+            log_error "Failed to configure runner"
+            write_status "error" "runner configuration failed"
             exit 1
         fi
     else
         log "Runner already configured, skipping configuration"
     fi
 
+    wait_for_docker
+
     # Start the runner
     start_runner
 }
@@ -0,0 +1,125 @@
+#!/bin/bash
+# docker/linux/language-packs/android-sdk/scripts/android-sdk-install.sh
+# Install Android SDK packages with sdkmanager, pinned by android-sdk.lock
+# Used while building the Android SDK pack; not installed into the image
+
+set -euo pipefail
+
+REPOSITORY_URL="https://dl.google.com/android/repository"
+
+usage() {
+    cat << EOF
+Usage: $(basename "$0") <lockfile> <package>...
+
+Install sdkmanager packages (e.g. 'platforms;android-34', 'ndk;26.1.10909125')
+into ANDROID_SDK_ROOT. Every package needs a lockfile entry:
+
+  <package> <revision> linux sha1:<archive checksum>
+
+Before installing, the revision and checksum Google's repository lists for
+the package must match the entry; sdkmanager then checks each archive against
+that checksum. Installed packages are appended to
+\${ANDROID_SDK_ROOT}/installed-packages.txt as '<package> <revision>'.
+
+Example:
+  $(basename "$0") /tmp/android-sdk.lock platform-tools 'platforms;android-34'
+EOF
+}
+
+fail() {
+    echo "[android-sdk-install] ERROR: $*" >&2
+    exit 1
+}
+
+# Repository manifest that lists a package: system images and add-ons have
+# their own; 'default' system images are published under sys-img/android
+manifest_url() {
+    local package="$1" tag
+    case "${package}" in
+        system-images\;*)
+            tag=$(cut -d';' -f3 <<< "${package}")
+            [[ "${tag}" == "default" ]] && tag="android"
+            echo "${REPOSITORY_URL}/sys-img/${tag}/sys-img2-3.xml"
+            ;;
+        add-ons\;*|extras\;google\;*)
+            echo "${REPOSITORY_URL}/addon2-3.xml"
+            ;;
+        *)
+            echo "${REPOSITORY_URL}/repository2-3.xml"
+            ;;
+    esac
+}
+
+# Print a <revision> element of an XML file as major[.minor[.micro]]
+revision_of() {
+    local xml="$1" element="$2" part version=""
+    for part in major minor micro; do
+        part=$(xmllint --xpath "string(${element}/revision/${part})" "${xml}")
+        [[ -n "${part}" ]] || break
+        version="${version:+${version}.}${part}"
+    done
+    echo "${version}"
+}
+
+main() {
+    if [[ $# -lt 2 ]]; then
+        usage
+        exit 2
+    fi
+
+    local lockfile="$1"
+    shift
+    [[ -f "${lockfile}" ]] || fail "Lockfile not found: ${lockfile}"
+    [[ -n "${ANDROID_SDK_ROOT:-}" ]] || fail "ANDROID_SDK_ROOT is not set"
+
+    # Repository manifests, fetched once per run
+    WORK_DIR=$(mktemp -d)
+    trap 'rm -rf "${WORK_DIR}"' EXIT
+
+    local package locked revision digest url xml remote checksum
+    declare -A revisions=()
+    for package in "$@"; do
+        locked=$(awk -v n="${package}" '$1 !~ /^#/ && $1 == n && $3 == "linux" { print $2, $4; exit }' "${lockfile}")
+        read -r revision digest <<< "${locked}"
+        if [[ -z "${revision}" ]]; then
+            fail "No entry for ${package} in $(basename "${lockfile}"); add '${package} <revision> linux -' and run docker/builder/scripts/update-lock.sh"
+        fi
+        if [[ -z "${digest}" || "${digest}" == "-" ]]; then
+            fail "No digest recorded for ${package} ${revision} in $(basename "${lockfile}"); run docker/builder/scripts/update-lock.sh"
+        fi
+        [[ "${digest}" == sha1:* ]] || fail "Expected a sha1 digest for ${package}, got ${digest}"
+
+        url=$(manifest_url "${package}")
+        xml="${WORK_DIR}/$(sha1sum <<< "${url}" | cut -c1-12).xml"
+        if [[ ! -f "${xml}" ]]; then
+            curl -fsSL "${url}" -o "${xml}" || fail "Could not fetch ${url}"
+        fi
+
+        remote="//remotePackage[@path='${package}']"
+        [[ "$(xmllint --xpath "count(${remote})" "${xml}")" != "0" ]] || fail "${package} is not listed in ${url}"
+        if [[ "$(revision_of "${xml}" "${remote}")" != "${revision}" ]]; then
+            fail "${package} is at revision $(revision_of "${xml}" "${remote}") upstream, ${revision} in $(basename "${lockfile}"); update the entry and run docker/builder/scripts/update-lock.sh"
+        fi
+        checksum=$(xmllint --xpath "string(${remote}/archives/archive[not(host-os) or host-os='linux'][not(host-arch) or host-arch='x64']/complete/checksum)" "${xml}")
+        if [[ "sha1:${checksum}" != "${digest}" ]]; then
+            fail "Checksum mismatch for ${package} ${revision}: expected ${digest}, upstream lists sha1:${checksum:-none}"
+        fi
+        echo "[android-sdk-install] OK ${package} ${revision} ${digest}"
+        revisions["${package}"]="${revision}"
+    done
+
+    sdkmanager --sdk_root="${ANDROID_SDK_ROOT}" --install "$@"
+
+    local installed
+    for package in "$@"; do
+        installed="${ANDROID_SDK_ROOT}/${package//;//}/package.xml"
+        [[ -f "${installed}" ]] || fail "${package} was not installed"
+        revision=$(revision_of "${installed}" "//localPackage")
+        if [[ "${revision}" != "${revisions[${package}]}" ]]; then
+            fail "sdkmanager installed ${package} ${revision}, expected ${revisions[${package}]}"
+        fi
+        echo "${package} ${revision}" >> "${ANDROID_SDK_ROOT}/installed-packages.txt"
+    done
+}
+
+main "$@"
@@ -1,6 +1,6 @@
 # docker/linux/language-packs/cpp/Dockerfile.cpp
 # C++/GCC toolchain language pack for GitHub Actions runners
-# Size: ~250MB (adds to base ~300MB = ~550MB total)
+# Size: ~250MB with the default GCC and Clang versions (adds to base ~300MB = ~550MB total; each extra version adds ~100-300MB)
 
 FROM gh-runner:linux-base AS cpp-pack
 
@@ -10,14 +10,9 @@ USER root
 # Prevent interactive prompts
 ENV DEBIAN_FRONTEND=noninteractive
 
-# Install C++ toolchain and build essentials
+# Install build essentials and libraries; the compilers are installed below
 RUN apt-get update && apt-get install -y --no-install-recommends \
     build-essential \
-    gcc \
-    g++ \
-    clang \
-    clang-format \
-    clang-tidy \
     make \
     cmake \
     pkg-config \
@@ -40,8 +35,45 @@ RUN apt-get update && apt-get install -y --no-install-recommends \
     libcurl4-openssl-dev \
     libexpat1-dev \
     libboost-all-dev \
+    ccache \
     && rm -rf /var/lib/apt/lists/*
 
+# Install GCC and Clang side by side: space-separated major versions, each as
+# gcc-N/g++-N and clang-N/clang++-N (plus clang-format-N, clang-tidy-N and
+# lld-N). update-alternatives points gcc, g++, clang and clang++ at the highest
+# version. Versions Ubuntu does not carry come from the ubuntu-toolchain-r PPA
+# and apt.llvm.org, whose signing keys are pinned in cpp.lock. The runner
+# labels for them (gcc-12, clang-15, ...) go to /etc/gh-runner/labels.d/cpp
+ARG GCC_VERSIONS="11 12"
+ARG CLANG_VERSIONS="14 15"
+COPY docker/linux/language-packs/cpp/cpp.lock /tmp/cpp.lock
+COPY docker/linux/language-packs/cpp/scripts/cpp-toolchains-install.sh /tmp/cpp-toolchains-install
+RUN bash /tmp/cpp-toolchains-install /tmp/cpp.lock "${GCC_VERSIONS}" "${CLANG_VERSIONS}" && \
+    rm -rf /var/lib/apt/lists/* /tmp/cpp-toolchains-install
+
+# Install sccache; its release archive must match cpp.lock
+ARG SCCACHE_VERSION=0.8.1
+RUN curl -fsSL -o /tmp/sccache.tar.gz \
+        https://github.com/mozilla/sccache/releases/download/v${SCCACHE_VERSION}/sccache-v${SCCACHE_VERSION}-x86_64-unknown-linux-musl.tar.gz && \
+    lock-verify file /tmp/cpp.lock sccache ${SCCACHE_VERSION} x86_64-unknown-linux-musl /tmp/sccache.tar.gz && \
+    tar -xzf /tmp/sccache.tar.gz -C /usr/local/bin --strip-components=1 \
+        sccache-v${SCCACHE_VERSION}-x86_64-unknown-linux-musl/sccache && \
+    chmod 755 /usr/local/bin/sccache && \
+    rm /tmp/sccache.tar.gz /tmp/cpp.lock
+
+# Compiler caches: ccache (the CMake compiler launcher by default) and sccache
+# keep their entries under ~/.cache, which the compose files mount from the
+# host so they survive container restarts; CCACHE_MAXSIZE and
+# SCCACHE_CACHE_SIZE bound them
+RUN mkdir -p /home/runner/.cache/ccache /home/runner/.cache/sccache && \
+    chown -R runner:runner /home/runner/.cache
+ENV CCACHE_DIR=/home/runner/.cache/ccache \
+    CCACHE_MAXSIZE=5G \
+    SCCACHE_DIR=/home/runner/.cache/sccache \
+    SCCACHE_CACHE_SIZE=5G \
+    CMAKE_C_COMPILER_LAUNCHER=ccache \
+    CMAKE_CXX_COMPILER_LAUNCHER=ccache
+
 # Install CMake 3.x from kitware (if needed for newer version)
 # This is optional and can be updated as needed
 # RUN wget -O - https://apt.kitware.com/keys/kitware-archive-latest.asc 2>/dev/null | gpg --dearmor - | tee /usr/share/keyrings/kitware-archive-keyring.gpg >/dev/null && \
@@ -60,13 +92,18 @@ RUN gcc --version && \
     g++ --version && \
     clang --version && \
     cmake --version && \
-    make --version
+    make --version && \
+    ccache --version && \
+    sccache --version && \
+    update-alternatives --display gcc && \
+    update-alternatives --display clang
 
 # Labels
 LABEL org.opencontainers.image.description="C++/GCC/Clang toolchain for GitHub Actions runners" \
       org.opencontainers.image.version="1.0.0" \
-      org.opencontainers.image.gcc.version="11.x" \
-      org.opencontainers.image.clang.version="14.x" \
+      org.opencontainers.image.gcc.versions="${GCC_VERSIONS}" \
+      org.opencontainers.image.clang.versions="${CLANG_VERSIONS}" \
+      org.opencontainers.image.sccache.version="${SCCACHE_VERSION}" \
       org.opencontainers.image.cmake.version="3.x"
 
 USER runner
@@ -0,0 +1,124 @@
+#!/bin/bash
+# docker/linux/language-packs/cpp/scripts/cpp-toolchains-install.sh
+# Install GCC and Clang versions side by side, with update-alternatives
+# Used while building the C++ pack; not installed into the image
+
+set -euo pipefail
+
+LABELS_FILE="/etc/gh-runner/labels.d/cpp"
+
+usage() {
+    cat << EOF
+Usage: $(basename "$0") <lockfile> "<gcc versions>" "<clang versions>"
+
+Install gcc-N/g++-N and clang-N (with clang-format-N and clang-tidy-N) for
+each major version. Versions the Ubuntu archive does not carry come from the
+ubuntu-toolchain-r PPA (GCC) or apt.llvm.org (Clang); their signing keys must
+be pinned in the lockfile:
+
+  toolchain-r-key <codename> gpg sha256:<key checksum>
+  llvm-key        <codename> gpg sha256:<key checksum>
+
+Every version is registered with update-alternatives (priority = version), so
+gcc, g++, clang, clang++, clang-format and clang-tidy are the highest one.
+The runner labels (gcc-N, clang-N) are written to ${LABELS_FILE}.
+
+Example:
+  $(basename "$0") /tmp/cpp.lock "11 12 13" "14 17"
+EOF
+}
+
+fail() {
+    echo "[cpp-toolchains] ERROR: $*" >&2
+    exit 1
+}
+
+# True if the apt archives configured so far carry a package
+available() {
+    [[ -n "$(apt-cache policy "$1" 2>/dev/null | awk '/Candidate:/ && $2 != "(none)" { print $2 }')" ]]
+}
+
+# Fetch a repository signing key, check it against the lockfile and install
+# it as a keyring for signed-by
+add_key() {
+    local lockfile="$1" name="$2" url="$3" keyring="$4"
+    [[ -f "${keyring}" ]] && return 0
+    curl -fsSL "${url}" -o "${WORK_DIR}/${name}.asc" || fail "Could not fetch ${url}"
+    lock-verify file "${lockfile}" "${name}" "${CODENAME}" gpg "${WORK_DIR}/${name}.asc"
+    gpg --dearmor < "${WORK_DIR}/${name}.asc" > "${keyring}"
+}
+
+main() {
+    if [[ $# -ne 3 ]]; then
+        usage
+        exit 2
+    fi
+
+    local lockfile="$1" gcc_versions="$2" clang_versions="$3"
+    [[ -f "${lockfile}" ]] || fail "Lockfile not found: ${lockfile}"
+    local version
+    for version in ${gcc_versions} ${clang_versions}; do
+        [[ "${version}" =~ ^[0-9]+$ ]] || fail "Versions are major versions (12, not 12.3), got '${version}'"
+    done
+
+    # shellcheck disable=SC1091
+    CODENAME=$(. /etc/os-release && echo "${VERSION_CODENAME}")
+    WORK_DIR=$(mktemp -d)
+    trap 'rm -rf "${WORK_DIR}"' EXIT
+
+    apt-get update
+
+    # Extra archives, only for the versions the distribution does not carry
+    local added=false packages=()
+    for version in ${gcc_versions}; do
+        if ! available "gcc-${version}"; then
+            add_key "${lockfile}" toolchain-r-key \
+                "https://keyserver.ubuntu.com/pks/lookup?op=get&options=mr&search=0x60C317803A41BA51845E371A1E9377A2BA9EF27F" \
+                /usr/share/keyrings/ubuntu-toolchain-r.gpg
+            echo "deb [signed-by=/usr/share/keyrings/ubuntu-toolchain-r.gpg] https://ppa.launchpadcontent.net/ubuntu-toolchain-r/test/ubuntu ${CODENAME} main" \
+                > /etc/apt/sources.list.d/ubuntu-toolchain-r.list
+            added=true
+        fi
+        packages+=("gcc-${version}" "g++-${version}")
+    done
+    for version in ${clang_versions}; do
+        if ! available "clang-${version}"; then
+            add_key "${lockfile}" llvm-key https://apt.llvm.org/llvm-snapshot.gpg.key /usr/share/keyrings/llvm.gpg
+            echo "deb [signed-by=/usr/share/keyrings/llvm.gpg] https://apt.llvm.org/${CODENAME}/ llvm-toolchain-${CODENAME}-${version} main" \
+                > "/etc/apt/sources.list.d/llvm-${version}.list"
+            added=true
+        fi
+        packages+=("clang-${version}" "clang-format-${version}" "clang-tidy-${version}" "lld-${version}")
+    done
+    if [[ "${added}" == "true" ]]; then
+        apt-get update
+    fi
+
+    apt-get install -y --no-install-recommends "${packages[@]}"
+
+    # --force: gcc, g++ and gcov are plain symlinks from the distribution's
+    # default gcc package until they become alternatives
+    local labels=()
+    for version in ${gcc_versions}; do
+        update-alternatives --force --install /usr/bin/gcc gcc "/usr/bin/gcc-${version}" "${version}" \
+            --slave /usr/bin/g++ g++ "/usr/bin/g++-${version}" \
+            --slave /usr/bin/gcov gcov "/usr/bin/gcov-${version}"
+        "gcc-${version}" --version | head -n 1
+        labels+=("gcc-${version}")
+    done
+    for version in ${clang_versions}; do
+        update-alternatives --force --install /usr/bin/clang clang "/usr/bin/clang-${version}" "${version}" \
+            --slave /usr/bin/clang++ clang++ "/usr/bin/clang++-${version}" \
+            --slave /usr/bin/clang-format clang-format "/usr/bin/clang-format-${version}" \
+            --slave /usr/bin/clang-tidy clang-tidy "/usr/bin/clang-tidy-${version}" \
+            --slave /usr/bin/ld.lld ld.lld "/usr/bin/ld.lld-${version}"
+        "clang-${version}" --version | head -n 1
+        labels+=("clang-${version}")
+    done
+
+    mkdir -p "$(dirname "${LABELS_FILE}")"
+    (IFS=,; echo "${labels[*]}") > "${LABELS_FILE}"
+    echo "[cpp-toolchains] Runner labels: $(cat "${LABELS_FILE}")"
+}
+
+main "$@"
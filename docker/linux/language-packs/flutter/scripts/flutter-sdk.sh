@@ -0,0 +1,152 @@
+#!/bin/bash
+# docker/linux/language-packs/flutter/scripts/flutter-sdk.sh
+# Switch between the Flutter SDKs installed in the image, fvm-style
+# Installed into the Flutter pack as /usr/local/bin/flutter-sdk
+
+set -euo pipefail
+
+# One directory (or symlink, for the default /opt/flutter) per version
+SDKS_DIR="${FLUTTER_SDKS_DIR:-/opt/flutter-sdks}"
+DEFAULT_SDK="${FLUTTER_HOME:-/opt/flutter}"
+
+usage() {
+    cat << EOF
+Usage: $(basename "$0") <command> [VERSION]
+
+Commands:
+  list                  List the installed Flutter SDKs (* marks the default)
+  which [VERSION]       Print the directory of an SDK
+  use [VERSION]         Put an SDK first on PATH for the rest of the job
+  exec VERSION CMD...   Run one command with an SDK
+  verify                Check that every SDK reports the version it is installed as
+
+VERSION defaults to the project's fvm pin in the current directory: "flutter"
+in .fvmrc, or "flutterSdkVersion" in .fvm/fvm_config.json.
+
+Outside a workflow, 'use' prints shell exports instead: eval "\$($(basename "$0") use 3.19.5)"
+
+Examples:
+  $(basename "$0") list
+  $(basename "$0") use 3.16.9
+  $(basename "$0") exec 3.16.9 flutter build apk
+EOF
+}
+
+fail() {
+    echo "[flutter-sdk] ERROR: $*" >&2
+    exit 1
+}
+
+installed_versions() {
+    local sdk
+    for sdk in "${SDKS_DIR}"/*/; do
+        if [[ -x "${sdk}bin/flutter" ]]; then
+            basename "${sdk}"
+        fi
+    done | sort -V
+}
+
+# The version pinned by fvm in the current directory, without an @channel suffix
+project_version() {
+    local version=""
+    if [[ -f .fvmrc ]]; then
+        version=$(jq -r '.flutter // empty' .fvmrc)
+    elif [[ -f .fvm/fvm_config.json ]]; then
+        version=$(jq -r '.flutterSdkVersion // empty' .fvm/fvm_config.json)
+    fi
+    [[ -n "${version}" ]] || fail "No VERSION given and no fvm pin (.fvmrc or .fvm/fvm_config.json) in $(pwd)"
+    echo "${version%%@*}"
+}
+
+sdk_dir() {
+    local version="${1:-}"
+    [[ -n "${version}" ]] || version=$(project_version)
+    if [[ ! -x "${SDKS_DIR}/${version}/bin/flutter" ]]; then
+        fail "Flutter ${version} is not installed; installed: $(installed_versions | paste -sd' ' -)"
+    fi
+    # Resolve the default's symlink, so PATH names the real directory
+    readlink -f "${SDKS_DIR}/${version}"
+}
+
+cmd_list() {
+    local version marker default
+    default=$(readlink -f "${DEFAULT_SDK}")
+    while IFS= read -r version; do
+        marker=" "
+        [[ "$(readlink -f "${SDKS_DIR}/${version}")" == "${default}" ]] && marker="*"
+        echo "${marker} ${version}"
+    done < <(installed_versions)
+}
+
+cmd_use() {
+    local version="${1:-}" sdk
+    [[ -n "${version}" ]] || version=$(project_version)
+    sdk=$(sdk_dir "${version}")
+
+    if [[ -n "${GITHUB_PATH:-}" && -n "${GITHUB_ENV:-}" ]]; then
+        # Later GITHUB_PATH lines come first on PATH
+        echo "${sdk}/bin/cache/dart-sdk/bin" >> "${GITHUB_PATH}"
+        echo "${sdk}/bin" >> "${GITHUB_PATH}"
+        echo "FLUTTER_ROOT=${sdk}" >> "${GITHUB_ENV}"
+        echo "[flutter-sdk] Using Flutter ${version} from ${sdk} for the next steps"
+    else
+        echo "export PATH=\"${sdk}/bin:${sdk}/bin/cache/dart-sdk/bin:\${PATH}\" FLUTTER_ROOT=\"${sdk}\""
+    fi
+}
+
+cmd_exec() {
+    [[ $# -ge 2 ]] || fail "Usage: $(basename "$0") exec VERSION CMD..."
+    local sdk
+    sdk=$(sdk_dir "$1")
+    shift
+    PATH="${sdk}/bin:${sdk}/bin/cache/dart-sdk/bin:${PATH}" FLUTTER_ROOT="${sdk}" exec "$@"
+}
+
+cmd_verify() {
+    local version reported dart failed=0
+    while IFS= read -r version; do
+        reported=$("${SDKS_DIR}/${version}/bin/flutter" --version --machine 2>/dev/null) ||
+            fail "Flutter ${version} does not run"
+        dart=$(jq -r '.dartSdkVersion' <<< "${reported}" | cut -d' ' -f1)
+        reported=$(jq -r '.frameworkVersion' <<< "${reported}")
+        if [[ "${reported}" != "${version}" ]]; then
+            echo "[flutter-sdk] ERROR: ${SDKS_DIR}/${version} reports Flutter ${reported}" >&2
+            failed=1
+            continue
+        fi
+        echo "[flutter-sdk] OK Flutter ${version} (Dart ${dart})"
+    done < <(installed_versions)
+    return "${failed}"
+}
+
+main() {
+    local command="${1:-}"
+    [[ $# -gt 0 ]] && shift
+
+    case "${command}" in
+        list)
+            cmd_list
+            ;;
+        which)
+            sdk_dir "${1:-}"
+            ;;
+        use)
+            cmd_use "$@"
+            ;;
+        exec)
+            cmd_exec "$@"
+            ;;
+        verify)
+            cmd_verify
+            ;;
+        -h|--help|help)
+            usage
+            ;;
+        *)
+            usage
+            exit 2
+            ;;
+    esac
+}
+
+main "$@"
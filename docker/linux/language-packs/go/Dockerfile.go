@@ -1,5 +1,5 @@
 # docker/linux/language-packs/go/Dockerfile.go
-# Go 1.22 language pack for GitHub Actions runners
+# Go language pack for GitHub Actions runners (Go 1.21 and 1.22 in the hosted tool cache)
 # Size: ~100MB (adds to base ~300MB = ~400MB total)
 
 FROM gh-runner:linux-base AS go-pack
@@ -10,18 +10,20 @@ USER root
 # Prevent interactive prompts
 ENV DEBIAN_FRONTEND=noninteractive
 
-# Install Go 1.22 from official Go release
-# This ensures we get the exact version needed
+# Install GO_VERSION and every GO_CACHE_VERSIONS release into the hosted tool
+# cache, so actions/setup-go finds them offline; GO_VERSION is the default go
+# on PATH. Each archive must match docker/linux/language-packs/go/go.lock
 ARG GO_VERSION=1.22.7
-
-RUN apt-get update && apt-get install -y --no-install-recommends \
-    wget \
-    && rm -rf /var/lib/apt/lists/*
-
-# Download and install Go
-RUN wget https://go.dev/dl/go${GO_VERSION}.linux-amd64.tar.gz && \
-    tar -C /usr/local -xzf go${GO_VERSION}.linux-amd64.tar.gz && \
-    rm go${GO_VERSION}.linux-amd64.tar.gz
+ARG GO_CACHE_VERSIONS="1.21.13"
+COPY docker/linux/language-packs/go/go.lock /tmp/go.lock
+RUN for version in ${GO_CACHE_VERSIONS} ${GO_VERSION}; do \
+        toolcache install go ${version} \
+            https://go.dev/dl/go${version}.linux-amd64.tar.gz \
+            /tmp/go.lock go linux-amd64 || exit 1; \
+    done && \
+    rm /tmp/go.lock && \
+    toolcache link go ${GO_VERSION} /usr/local/go && \
+    chown -R runner:runner ${RUNNER_TOOL_CACHE}
 
 # Update PATH to include Go binaries
 ENV PATH="/usr/local/go/bin:${PATH}"
@@ -30,18 +32,21 @@ ENV PATH="/usr/local/go/bin:${PATH}"
 RUN mkdir -p /go && chown -R runner:runner /go
 
 # Environment variables for Go development
-ENV GOROOT=/usr/local/go \
-    GOPATH=/go \
+# GOROOT is left unset: each go finds its own root, so a version setup-go puts
+# first on PATH does not pick up the default's standard library
+ENV GOPATH=/go \
     GO111MODULE=on
 
 # Verify Go installation
 RUN go version && \
-    go env GOPATH GOROOT
+    go env GOPATH GOROOT && \
+    toolcache list go
 
 # Labels
-LABEL org.opencontainers.image.description="Go 1.22 toolchain for GitHub Actions runners" \
+LABEL org.opencontainers.image.description="Go toolchains for GitHub Actions runners" \
       org.opencontainers.image.version="1.0.0" \
       org.opencontainers.image.go.version="${GO_VERSION}" \
+      org.opencontainers.image.go.versions="${GO_CACHE_VERSIONS} ${GO_VERSION}" \
       org.opencontainers.image.size="~100MB"
 
 USER runner
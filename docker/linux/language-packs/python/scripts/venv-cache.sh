@@ -0,0 +1,226 @@
+#!/bin/bash
+# docker/linux/language-packs/python/scripts/venv-cache.sh
+# Per-project Python virtualenvs keyed by the hash of the dependency lockfiles
+# Installed into Python images as /usr/local/bin/venv-cache
+
+set -euo pipefail
+
+# Configuration (see usage)
+CACHE_DIR="${VENV_CACHE_DIR:-${HOME}/.cache/venvs}"
+MAX_MB="${VENV_CACHE_MAX_MB:-10240}"
+PYTHON="${VENV_CACHE_PYTHON:-python3}"
+
+# Hits and misses of the current job, reported by the completed hook
+JOB_LOG="/run/gh-runner/venv-cache.log"
+
+usage() {
+    cat << EOF
+Usage: $(basename "$0") activate [DIR]
+       $(basename "$0") key [DIR]
+       $(basename "$0") list
+       $(basename "$0") prune
+
+Give every set of dependencies its own virtualenv instead of one shared venv.
+The key is a hash of the Python version and the requirements*.txt, poetry.lock
+and uv.lock files in DIR (default: GITHUB_WORKSPACE, or the current directory).
+A venv is built once per key and reused by every later job with the same files.
+
+Commands:
+  activate  Reuse the venv for DIR's key or build it (pip install -r for each
+            requirements*.txt, poetry install for poetry.lock, uv sync for
+            uv.lock), then print its path. In a workflow step the venv is also
+            activated for the following steps, and the step outputs
+            cache-hit, key and path are set.
+  key       Print the key for DIR
+  list      Print the cached venvs, least recently used first
+  prune     Remove the least recently used venvs until the cache fits in
+            VENV_CACHE_MAX_MB, plus any a failed build left behind
+
+Environment Variables:
+  VENV_CACHE_DIR      Cache directory (default: ~/.cache/venvs)
+  VENV_CACHE_MAX_MB   Size the cache is pruned to (default: 10240)
+  VENV_CACHE_PYTHON   Interpreter venvs are created with (default: python3)
+
+Examples:
+  - uses: actions/checkout@v4
+  - id: venv
+    run: $(basename "$0") activate
+  - run: pytest
+EOF
+}
+
+log() {
+    echo "[venv-cache] $*" >&2
+}
+
+fail() {
+    log "ERROR: $*"
+    exit 1
+}
+
+# Print the lockfiles of a project directory, sorted
+lockfiles() {
+    local dir="$1"
+    find "${dir}" -maxdepth 1 -type f \( -name 'requirements*.txt' -o -name 'poetry.lock' -o -name 'uv.lock' \) \
+        -printf '%f\n' | LC_ALL=C sort
+}
+
+# Key: Python version plus the name and content of every lockfile
+cache_key() {
+    local dir="$1" files file
+    files=$(lockfiles "${dir}")
+    [[ -n "${files}" ]] || fail "No requirements*.txt, poetry.lock or uv.lock in ${dir}"
+
+    {
+        "${PYTHON}" -c 'import sys; print(sys.version)'
+        while IFS= read -r file; do
+            echo "${file} $(sha256sum < "${dir}/${file}" | cut -d' ' -f1)"
+        done <<< "${files}"
+    } | sha256sum | cut -c1-16
+}
+
+# Install a project's dependencies into a fresh venv
+# Runs as an `if` condition, where set -e is off, so every step returns on failure
+build_venv() {
+    local dir="$1" venv="$2" file
+
+    "${PYTHON}" -m venv "${venv}" || return 1
+
+    if [[ -f "${dir}/uv.lock" ]]; then
+        command -v uv > /dev/null || { log "ERROR: uv.lock needs uv on PATH (pip install --user uv)"; return 1; }
+        UV_PROJECT_ENVIRONMENT="${venv}" uv sync --project "${dir}" --frozen --no-install-project || return 1
+    elif [[ -f "${dir}/poetry.lock" ]]; then
+        command -v poetry > /dev/null || { log "ERROR: poetry.lock needs poetry on PATH (pip install --user poetry)"; return 1; }
+        (cd "${dir}" && VIRTUAL_ENV="${venv}" PATH="${venv}/bin:${PATH}" poetry install --no-root --no-interaction) || return 1
+    fi
+
+    while IFS= read -r file; do
+        [[ "${file}" == requirements*.txt ]] || continue
+        (cd "${dir}" && "${venv}/bin/python" -m pip install --quiet -r "${file}") || return 1
+    done < <(lockfiles "${dir}")
+}
+
+# Export the venv to the following steps of a workflow job
+export_to_job() {
+    local venv="$1" key="$2" hit="$3"
+
+    if [[ -n "${GITHUB_ENV:-}" ]]; then
+        echo "VIRTUAL_ENV=${venv}" >> "${GITHUB_ENV}"
+    fi
+    if [[ -n "${GITHUB_PATH:-}" ]]; then
+        echo "${venv}/bin" >> "${GITHUB_PATH}"
+    fi
+    if [[ -n "${GITHUB_OUTPUT:-}" ]]; then
+        {
+            echo "cache-hit=${hit}"
+            echo "key=${key}"
+            echo "path=${venv}"
+        } >> "${GITHUB_OUTPUT}"
+    fi
+}
+
+# Append to the current job's hit/miss log, if the runner keeps one
+record() {
+    if [[ -d "$(dirname "${JOB_LOG}")" && -w "$(dirname "${JOB_LOG}")" ]]; then
+        echo "$*" >> "${JOB_LOG}"
+    fi
+}
+
+cmd_activate() {
+    [[ $# -le 1 ]] || { usage; exit 2; }
+    local dir="${1:-${GITHUB_WORKSPACE:-${PWD}}}"
+    [[ -d "${dir}" ]] || fail "${dir} is not a directory"
+    dir=$(cd "${dir}" && pwd)
+
+    local key venv
+    key=$(cache_key "${dir}")
+    venv="${CACHE_DIR}/${key}"
+    mkdir -p "${CACHE_DIR}"
+
+    if [[ -f "${venv}.complete" && -x "${venv}/bin/python" ]]; then
+        # The marker's mtime is the last use, which prune evicts by
+        touch "${venv}.complete"
+        log "hit ${key} ($(lockfiles "${dir}" | paste -sd ' '))"
+        record "hit ${key} ${dir}"
+        export_to_job "${venv}" "${key}" true
+        echo "${venv}"
+        return 0
+    fi
+
+    log "miss ${key}, building ${venv} ($(lockfiles "${dir}" | paste -sd ' '))"
+    local started=${SECONDS}
+    rm -rf "${venv}" "${venv}.complete"
+    if ! build_venv "${dir}" "${venv}"; then
+        rm -rf "${venv}"
+        fail "Could not build the venv for ${dir}"
+    fi
+    touch "${venv}.complete"
+
+    log "built ${key} in $((SECONDS - started))s"
+    record "miss ${key} ${dir} $((SECONDS - started))s"
+    export_to_job "${venv}" "${key}" false
+    echo "${venv}"
+}
+
+cmd_key() {
+    [[ $# -le 1 ]] || { usage; exit 2; }
+    cache_key "${1:-${GITHUB_WORKSPACE:-${PWD}}}"
+}
+
+# Print "<last use epoch> <size MB> <key>" for every complete venv, oldest first
+cached_venvs() {
+    local marker venv
+    for marker in "${CACHE_DIR}"/*.complete; do
+        [[ -f "${marker}" ]] || continue
+        venv="${marker%.complete}"
+        echo "$(stat -c %Y "${marker}") $(du -sm "${venv}" 2>/dev/null | cut -f1) $(basename "${venv}")"
+    done | sort -n
+}
+
+cmd_list() {
+    [[ $# -eq 0 ]] || { usage; exit 2; }
+    local used size key
+    while read -r used size key; do
+        printf '%s  %6sMB  last used %s\n' "${key}" "${size:-0}" "$(date -d "@${used}" '+%Y-%m-%d %H:%M')"
+    done < <(cached_venvs)
+}
+
+cmd_prune() {
+    [[ $# -eq 0 ]] || { usage; exit 2; }
+    [[ -d "${CACHE_DIR}" ]] || return 0
+
+    # Builds that never completed
+    local entry
+    for entry in "${CACHE_DIR}"/*/; do
+        entry="${entry%/}"
+        [[ -d "${entry}" && ! -f "${entry}.complete" ]] || continue
+        log "Removing incomplete venv $(basename "${entry}")"
+        rm -rf "${entry}"
+    done
+
+    local total used size key
+    total=$(cached_venvs | awk '{ sum += $2 } END { print sum + 0 }')
+    while read -r used size key; do
+        [[ "${total}" -gt "${MAX_MB}" ]] || break
+        log "Evicting ${key} (${size}MB, last used $(date -d "@${used}" '+%Y-%m-%d %H:%M'))"
+        rm -rf "${CACHE_DIR:?}/${key}" "${CACHE_DIR:?}/${key}.complete"
+        total=$((total - size))
+    done < <(cached_venvs)
+
+    log "${total}MB in ${CACHE_DIR} (limit ${MAX_MB}MB)"
+}
+
+main() {
+    local command="${1:-}"
+    shift || true
+    case "${command}" in
+        activate) cmd_activate "$@" ;;
+        key) cmd_key "$@" ;;
+        list) cmd_list "$@" ;;
+        prune) cmd_prune "$@" ;;
+        -h|--help) usage ;;
+        *) usage; exit 2 ;;
+    esac
+}
+
+main "$@"
@@ -0,0 +1,105 @@
+#!/bin/bash
+# test-credential-isolation.sh
+# Proves a workflow job cannot read the runner management token.
+#
+# Starts the entrypoint the way the compose files do (as root, all but the
+# supervisor's capabilities dropped, no-new-privileges) with a stand-in run.sh.
+# The stand-in runs where jobs run - as the runner user, in the environment
+# run.sh passes to jobs - and searches its environment and every process's
+# /proc/<pid>/environ and /proc/<pid>/cmdline for the token.
+#
+# Usage: ./test-credential-isolation.sh [image]   (default: gh-runner:linux-base)
+
+set -euo pipefail
+
+IMAGE="${1:-gh-runner:linux-base}"
+TOKEN="ghp_isolationtest$(date +%s)abcdefghijklmnop"
+
+GREEN='\033[0;32m'
+RED='\033[0;31m'
+NC='\033[0m'
+
+if ! docker image inspect "${IMAGE}" >/dev/null 2>&1; then
+    echo "Image ${IMAGE} not found; build it first:"
+    echo "  docker build -f docker/linux/base/Dockerfile.base -t gh-runner:linux-base ."
+    exit 2
+fi
+
+workdir="$(mktemp -d)"
+trap 'rm -rf "${workdir}"' EXIT
+
+# A configured runner directory, so the entrypoint goes straight to run.sh
+echo '{"agentId": 1}' > "${workdir}/.runner"
+printf '#!/bin/bash\nexit 0\n' > "${workdir}/config.sh"
+printf '%s\n' "${TOKEN}" > "${workdir}/needle"
+
+cat > "${workdir}/run.sh" << 'EOF'
+#!/bin/bash
+# Stand-in for run.sh: looks for the token everywhere a job step could
+needle=/actions-runner/needle
+leaks=0
+
+echo "probe: running as $(id -un) (uid $(id -u))"
+if [ "$(id -u)" -eq 0 ]; then
+    echo "LEAK: jobs run as root"
+    leaks=$((leaks + 1))
+fi
+
+if env | grep -qFf "${needle}"; then
+    echo "LEAK: token in the job environment"
+    leaks=$((leaks + 1))
+fi
+
+# grep -f keeps the token off this probe's own command line
+for file in /proc/[0-9]*/environ /proc/[0-9]*/cmdline; do
+    if tr '\0' '\n' 2>/dev/null < "${file}" | grep -qFf "${needle}"; then
+        echo "LEAK: token readable in ${file} ($(tr '\0' ' ' < "${file%/*}/cmdline" 2>/dev/null | cut -c1-60))"
+        leaks=$((leaks + 1))
+    fi
+done
+
+if sudo -n true 2>/dev/null; then
+    echo "LEAK: sudo works, so a job can read the supervisor as root"
+    leaks=$((leaks + 1))
+fi
+
+if ls /run/gh-runner-supervisor >/dev/null 2>&1; then
+    echo "LEAK: the supervisor's control directory is readable"
+    leaks=$((leaks + 1))
+fi
+
+for path in /entrypoint.sh /run/gh-runner-status /run/gh-runner-status/www; do
+    if [ -w "${path}" ]; then
+        echo "LEAK: ${path} is writable, and root uses it"
+        leaks=$((leaks + 1))
+    fi
+done
+
+echo "probe: ${leaks} leak(s)"
+exit "${leaks}"
+EOF
+chmod +x "${workdir}/run.sh" "${workdir}/config.sh"
+chmod 0755 "${workdir}"
+
+echo "Running ${IMAGE} with a probe job..."
+status=0
+docker run --rm \
+    --user 0:0 \
+    --cap-drop ALL \
+    --cap-add CHOWN --cap-add DAC_OVERRIDE --cap-add KILL --cap-add SETGID --cap-add SETUID \
+    --security-opt no-new-privileges:true \
+    -e GITHUB_TOKEN="${TOKEN}" \
+    -e GITHUB_REPOSITORY=example/isolation-test \
+    -e RUNNER_NAME=isolation-test \
+    -e STATUS_PORT=0 \
+    -e TIMEOUT_SECONDS=3 \
+    -v "${workdir}:/actions-runner" \
+    "${IMAGE}" || status=$?
+
+echo ""
+if [ "${status}" -eq 0 ]; then
+    echo -e "${GREEN}✓ PASS${NC}: the token is not visible to jobs"
+else
+    echo -e "${RED}✗ FAIL${NC}: the token is visible to jobs (see LEAK lines above)"
+    exit 1
+fi
@@ -0,0 +1,61 @@
+#!/bin/bash
+# test-runner-deprecation.sh
+# Checks which runner output lines make the entrypoint treat the baked runner
+# version as deprecated (RUNNER_DEPRECATION_PATTERN): the listener's own
+# messages must match, job names and other output must not.
+#
+# Usage: ./test-runner-deprecation.sh   (no image or Docker needed)
+
+set -euo pipefail
+
+ENTRYPOINT="$(dirname "$0")/docker/linux/entrypoint/entrypoint.sh"
+
+GREEN='\033[0;32m'
+RED='\033[0;31m'
+NC='\033[0m'
+
+eval "$(grep '^RUNNER_DEPRECATION_PATTERN=' "${ENTRYPOINT}")"
+if [[ -z "${RUNNER_DEPRECATION_PATTERN:-}" ]]; then
+    echo -e "${RED}FAIL${NC}: RUNNER_DEPRECATION_PATTERN not found in ${ENTRYPOINT}"
+    exit 1
+fi
+
+# want<TAB>line: "match" lines must stop the runner, "ignore" lines must not
+cases=$(cat << 'EOF'
+match	2026-10-15 08:00:00Z: Runner version v2.300.0 is deprecated and cannot receive messages.
+match	An error occurred: Runner version v2.300.0 is deprecated and cannot receive messages.
+match	2026-10-15 08:00:00Z: An error occurred: Runner version 2.300.0 is deprecated and cannot receive messages.
+match	Runner update is required, but updates are disabled (--disableupdate)
+match	2026-10-15 08:00:00Z: Runner update is disabled by --disableupdate
+match	2026-10-15 08:00:00Z: Runner auto-updates are disabled and version v2.300.0 is no longer supported
+ignore	2026-10-15 08:00:00Z: Running job: Runner version v2 is deprecated
+ignore	2026-10-15 08:00:00Z: Running job: update is required
+ignore	2026-10-15 08:00:00Z: Running job: check updates are disabled
+ignore	2026-10-15 08:00:00Z: Job deprecated-api-cleanup completed with result: Succeeded
+ignore	2026-10-15 08:00:00Z: Listening for Jobs
+ignore	√ Connected to GitHub
+ignore	Current runner version: '2.331.0'
+ignore	The disableupdate flag is set
+ignore	  Runner version v2.300.0 is deprecated
+EOF
+)
+
+failed=0
+while IFS=$'\t' read -r want line; do
+    got="ignore"
+    if [[ "${line}" =~ ${RUNNER_DEPRECATION_PATTERN} ]]; then
+        got="match"
+    fi
+    if [[ "${got}" == "${want}" ]]; then
+        echo -e "${GREEN}PASS${NC}: ${want}: ${line}"
+    else
+        echo -e "${RED}FAIL${NC}: want ${want}, got ${got}: ${line}"
+        failed=$((failed + 1))
+    fi
+done <<< "${cases}"
+
+if [[ ${failed} -gt 0 ]]; then
+    echo -e "${RED}${failed} case(s) failed${NC}"
+    exit 1
+fi
+echo -e "${GREEN}All cases passed${NC}"
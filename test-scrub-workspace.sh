@@ -0,0 +1,76 @@
+#!/bin/bash
+# test-scrub-workspace.sh
+# Checks that the post-job process scrub (scrub-workspace --only processes)
+# kills what a job left running but spares the runner and the supervisor's
+# own helpers (socat sockets, busybox status endpoint), which run as the same
+# user when the container does not start as root.
+#
+# Usage: ./test-scrub-workspace.sh   (no image or Docker needed; run as root,
+# the scrub runs as nobody, since it skips the process scrub for root)
+
+set -euo pipefail
+
+SCRUB="$(cd "$(dirname "$0")" && pwd)/docker/linux/base/scripts/scrub-workspace.sh"
+
+GREEN='\033[0;32m'
+RED='\033[0;31m'
+NC='\033[0m'
+
+if [[ "$(id -u)" -ne 0 ]]; then
+    echo -e "${RED}FAIL${NC}: run as root, so the scrub can run as another user"
+    exit 2
+fi
+
+workdir="$(mktemp -d)"
+trap 'pkill -KILL -u nobody -f "^${workdir}/" 2>/dev/null || true; rm -rf "${workdir}"' EXIT
+chmod 0755 "${workdir}"
+
+# want<TAB>process name: stand-ins (copies of sleep) the scrub must keep or kill
+cases=$(cat << 'CASES'
+keep	Runner.Listener
+keep	Runner.Worker
+keep	socat
+keep	busybox
+kill	node
+kill	python3
+CASES
+)
+
+while IFS=$'\t' read -r _ name; do
+    cp "$(command -v sleep)" "${workdir}/${name}"
+done <<< "${cases}"
+cp "${SCRUB}" "${workdir}/scrub-workspace"
+chmod -R a+rx "${workdir}"
+
+# Start the stand-ins and the scrub as one user, then report who survived
+setpriv --reuid=nobody --regid=nogroup --clear-groups env -i HOME="${workdir}" PATH=/usr/bin:/bin \
+    bash -c '
+        dir="$1"; shift
+        for name in "$@"; do
+            "${dir}/${name}" 300 &
+            echo "${name} $!" >> "${dir}/pids"
+        done
+        sleep 0.5
+        "${dir}/scrub-workspace" --only processes >/dev/null
+    ' _ "${workdir}" $(cut -f2 <<< "${cases}")
+
+failed=0
+while IFS=$'\t' read -r want name; do
+    pid=$(awk -v n="${name}" '$1 == n { print $2 }' "${workdir}/pids")
+    got="kill"
+    if kill -0 "${pid}" 2>/dev/null; then
+        got="keep"
+    fi
+    if [[ "${got}" == "${want}" ]]; then
+        echo -e "${GREEN}PASS${NC}: ${want}: ${name}"
+    else
+        echo -e "${RED}FAIL${NC}: want ${want}, got ${got}: ${name}"
+        failed=$((failed + 1))
+    fi
+done <<< "${cases}"
+
+if [[ ${failed} -gt 0 ]]; then
+    echo -e "${RED}${failed} case(s) failed${NC}"
+    exit 1
+fi
+echo -e "${GREEN}All cases passed${NC}"
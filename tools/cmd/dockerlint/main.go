@@ -0,0 +1,81 @@
+// Command dockerlint checks every Dockerfile under docker/linux against the
+// repo's base / language pack / composite rules without a Docker daemon.
+//
+// Usage:
+//
+//	cd tools && go run ./cmd/dockerlint [-root DIR] [-dir docker/linux] [-strict] [-rules]
+//
+// It prints one line per finding and exits 1 when there are errors (or any
+// finding with -strict).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/subhead/github-runners/tools/internal/dockerlint"
+)
+
+func main() {
+	root := flag.String("root", "", "repository root; finding paths are relative to it (default: nearest parent containing docker/linux)")
+	dir := flag.String("dir", "docker/linux", "directory under root to scan for Dockerfile*")
+	strict := flag.Bool("strict", false, "treat warnings as errors")
+	listRules := flag.Bool("rules", false, "list the rules and exit")
+	flag.Parse()
+
+	if *listRules {
+		for _, r := range dockerlint.Rules {
+			fmt.Printf("%-14s %s\n", r.Name, r.Doc)
+		}
+		return
+	}
+
+	if *root == "" {
+		r, err := findRoot(*dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dockerlint: %v\n", err)
+			os.Exit(2)
+		}
+		*root = r
+	}
+
+	l, err := dockerlint.Load(*root, *dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dockerlint: %v\n", err)
+		os.Exit(2)
+	}
+
+	errors, warnings := 0, 0
+	for _, f := range l.Run() {
+		fmt.Println(f)
+		if f.Severity == dockerlint.Error {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "dockerlint: %d Dockerfile(s), %d error(s), %d warning(s)\n", len(l.Files), errors, warnings)
+
+	if errors > 0 || (*strict && warnings > 0) {
+		os.Exit(1)
+	}
+}
+
+// findRoot walks up from the working directory to the first directory that
+// contains dir.
+func findRoot(dir string) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for d := wd; ; d = filepath.Dir(d) {
+		if fi, err := os.Stat(filepath.Join(d, dir)); err == nil && fi.IsDir() {
+			return d, nil
+		}
+		if filepath.Dir(d) == d {
+			return "", fmt.Errorf("no %s directory above %s; use -root", dir, wd)
+		}
+	}
+}
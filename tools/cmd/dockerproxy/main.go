@@ -0,0 +1,146 @@
+// Command dockerproxy serves a filtered Docker API to runners in place of
+// the daemon socket. Each -listen address belongs to one runner; jobs on it
+// may build, run and pull, but not start privileged containers, use host
+// namespaces or bind-mount host paths outside -allow-bind, and only see the
+// containers, networks and volumes their runner created.
+//
+// Usage:
+//
+//	dockerproxy -listen /run/gh-runner-docker-proxy/python/docker.sock=python-runner-01 \
+//	            -allow-bind /actions-runner/_work:/actions-runner/externals \
+//	            -job-network gh-runner-python-egress
+//
+// A unix socket listener must be mounted at the same path on the host and in
+// the runner, so container jobs can be given the proxy socket instead of the
+// daemon's. With -job-network, containers go on the egress proxy's internal
+// network instead of the daemon's default bridge, and networks jobs create
+// are internal, so job containers have no way out but the proxy. Denied
+// requests are logged with the runner name.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/subhead/github-runners/tools/internal/dockerproxy"
+)
+
+type listenFlags []string
+
+func (l *listenFlags) String() string     { return strings.Join(*l, ",") }
+func (l *listenFlags) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	var listens listenFlags
+	flag.Var(&listens, "listen", "ADDRESS=RUNNER: unix socket path or tcp host:port for one runner (repeatable)")
+	upstream := flag.String("upstream", "unix:///var/run/docker.sock", "Docker daemon address")
+	allowBind := flag.String("allow-bind", "/actions-runner/_work:/actions-runner/externals", "colon-separated host paths containers may bind-mount")
+	jobNetwork := flag.String("job-network", "", "network containers join in place of the default bridge (the egress proxy's); job-created networks become internal")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: dockerproxy -listen ADDRESS=RUNNER [-listen ...] [options]\n\nOptions:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if len(listens) == 0 || flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var binds []string
+	for _, b := range strings.Split(*allowBind, ":") {
+		if b != "" {
+			binds = append(binds, b)
+		}
+	}
+
+	logger := log.New(os.Stderr, "dockerproxy: ", log.LstdFlags)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	var servers []*http.Server
+	errs := make(chan error, len(listens))
+	for _, spec := range listens {
+		address, runner, ok := strings.Cut(spec, "=")
+		if !ok || address == "" || runner == "" {
+			fail(fmt.Errorf("invalid -listen %q, want ADDRESS=RUNNER", spec))
+		}
+
+		listener, socket, err := listen(address)
+		if err != nil {
+			fail(err)
+		}
+		proxy, err := dockerproxy.New(*upstream, dockerproxy.Policy{
+			Runner:       runner,
+			AllowedBinds: append([]string(nil), binds...),
+			Socket:       socket,
+			JobNetwork:   *jobNetwork,
+		}, logger)
+		if err != nil {
+			fail(err)
+		}
+
+		server := &http.Server{Handler: proxy, ReadHeaderTimeout: 30 * time.Second}
+		servers = append(servers, server)
+		logger.Printf("runner=%s listening on %s", runner, address)
+		go func() {
+			if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				errs <- err
+			}
+		}()
+	}
+
+	select {
+	case err := <-errs:
+		fail(err)
+	case <-ctx.Done():
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, server := range servers {
+		_ = server.Shutdown(shutdown)
+	}
+}
+
+// listen opens a tcp host:port or a unix socket any local user may connect
+// to; the socket's directory decides who can reach it. For unix sockets it
+// also returns the path, which jobs get in place of the daemon socket.
+func listen(address string) (net.Listener, string, error) {
+	if !strings.HasPrefix(address, "/") {
+		l, err := net.Listen("tcp", address)
+		return l, "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(address), 0o755); err != nil {
+		return nil, "", err
+	}
+	if err := os.Remove(address); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, "", err
+	}
+	l, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := os.Chmod(address, 0o666); err != nil {
+		l.Close()
+		return nil, "", err
+	}
+	return l, address, nil
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "dockerproxy: %v\n", err)
+	os.Exit(2)
+}
@@ -0,0 +1,117 @@
+// Command doctor checks that a host is ready to run a runner from a compose
+// file: configuration, Docker daemon, images, disk space, GitHub token and
+// runner name, and bind-mount permissions.
+//
+// Usage:
+//
+//	cd tools && go run ./cmd/doctor [-service NAME] [-env FILE] [-offline] COMPOSE_FILE
+//
+// Every check prints OK, WARN, FAIL or SKIP with remediation hints. doctor
+// exits 1 when any check fails.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/subhead/github-runners/tools/internal/doctor"
+)
+
+func main() {
+	root := flag.String("root", "", "repository root (default: found from the working directory)")
+	service := flag.String("service", "", "service to check (default: the first runner service in the compose file)")
+	envFile := flag.String("env", "", "env file used with the compose file (default: .env in the repository root)")
+	dockerHost := flag.String("docker-host", "", "Docker daemon address (default: $DOCKER_HOST or unix:///var/run/docker.sock)")
+	githubAPI := flag.String("github-api", os.Getenv("GITHUB_API_URL"), "GitHub API base URL")
+	offline := flag.Bool("offline", false, "skip the checks that call the GitHub API")
+	minFree := flag.Int64("min-free-mb", 2048, "disk headroom for job workspaces, on top of images still to build")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: doctor [options] COMPOSE_FILE\n\nOptions:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *root == "" {
+		r, err := findRoot()
+		if err != nil {
+			fail(err)
+		}
+		*root = r
+	}
+	composeFile, err := filepath.Abs(flag.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+	if *envFile == "" {
+		*envFile = filepath.Join(*root, ".env")
+	} else if *envFile, err = filepath.Abs(*envFile); err != nil {
+		fail(err)
+	}
+
+	d, err := doctor.New(doctor.Options{
+		Root:        *root,
+		ComposeFile: composeFile,
+		Service:     *service,
+		EnvFile:     *envFile,
+		DockerHost:  *dockerHost,
+		GitHubAPI:   *githubAPI,
+		Offline:     *offline,
+		MinFreeMB:   *minFree,
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	fmt.Printf("Checking service %s in %s\n\n", d.Service(), flag.Arg(0))
+	failed, warned := 0, 0
+	for _, r := range d.Run(ctx) {
+		fmt.Printf("[%-4s] %s: %s\n", r.Status, r.Name, r.Detail)
+		for _, hint := range r.Hints {
+			fmt.Printf("       - %s\n", hint)
+		}
+		switch r.Status {
+		case doctor.Fail:
+			failed++
+		case doctor.Warn:
+			warned++
+		}
+	}
+
+	fmt.Printf("\n%d failed, %d warning(s)\n", failed, warned)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "doctor: %v\n", err)
+	os.Exit(2)
+}
+
+// findRoot walks up from the working directory to the repository root.
+func findRoot() (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for d := wd; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "docker-compose")); err == nil {
+			return d, nil
+		}
+		if filepath.Dir(d) == d {
+			return "", fmt.Errorf("no docker-compose directory above %s", wd)
+		}
+	}
+}
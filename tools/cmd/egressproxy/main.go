@@ -0,0 +1,130 @@
+// Command egressproxy is the forward proxy runners send all outbound traffic
+// through. Each -listen address belongs to one runner and its image's policy
+// file; jobs reach only the hosts that policy allows, and denied requests are
+// logged with the runner and the job that made them.
+//
+// Usage:
+//
+//	egressproxy -listen :3128=python-runner-01=python.conf \
+//	            -policy-dir /etc/egress-proxy -allow internal.example.com \
+//	            -control-token-file /run/gh-runner-control/egress-proxy.token
+//
+// The compose files attach runners, and through docker-proxy their job
+// containers, only to an internal network the proxy shares, so the proxy is
+// their only way out.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/subhead/github-runners/tools/internal/controltoken"
+	"github.com/subhead/github-runners/tools/internal/egress"
+)
+
+type listenFlags []string
+
+func (l *listenFlags) String() string     { return strings.Join(*l, ",") }
+func (l *listenFlags) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	var listens listenFlags
+	flag.Var(&listens, "listen", "ADDRESS=RUNNER=POLICY: tcp host:port, runner name and policy file for one runner (repeatable)")
+	policyDir := flag.String("policy-dir", "/etc/egress-proxy", "directory of relative POLICY files")
+	allow := flag.String("allow", "", "comma-separated HOST[:PORT] patterns allowed for every runner, on top of its policy")
+	tokenFile := flag.String("control-token-file", "", "token file for /job, created if missing; empty disables the job endpoint")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: egressproxy -listen ADDRESS=RUNNER=POLICY [-listen ...] [options]\n\nOptions:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if len(listens) == 0 || flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var token string
+	if *tokenFile != "" {
+		var err error
+		if token, err = controltoken.Load(*tokenFile); err != nil {
+			fail(fmt.Errorf("-control-token-file: %w", err))
+		}
+	}
+
+	logger := log.New(os.Stderr, "egressproxy: ", log.LstdFlags)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	var servers []*http.Server
+	errs := make(chan error, len(listens))
+	for _, spec := range listens {
+		parts := strings.SplitN(spec, "=", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			fail(fmt.Errorf("invalid -listen %q, want ADDRESS=RUNNER=POLICY", spec))
+		}
+		address, runner, policyFile := parts[0], parts[1], parts[2]
+
+		if !filepath.IsAbs(policyFile) {
+			policyFile = filepath.Join(*policyDir, policyFile)
+		}
+		policy, err := egress.LoadPolicy(policyFile)
+		if err != nil {
+			fail(err)
+		}
+		for _, pattern := range strings.Split(*allow, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern == "" {
+				continue
+			}
+			if err := policy.Add(true, pattern); err != nil {
+				fail(fmt.Errorf("-allow: %w", err))
+			}
+		}
+
+		proxy, err := egress.New(runner, policy, token, logger)
+		if err != nil {
+			fail(err)
+		}
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			fail(err)
+		}
+
+		server := &http.Server{Handler: proxy, ReadHeaderTimeout: 30 * time.Second}
+		servers = append(servers, server)
+		logger.Printf("runner=%s listening on %s (policy %s)", runner, address, policyFile)
+		go func() {
+			if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				errs <- err
+			}
+		}()
+	}
+
+	select {
+	case err := <-errs:
+		fail(err)
+	case <-ctx.Done():
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, server := range servers {
+		_ = server.Shutdown(shutdown)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "egressproxy: %v\n", err)
+	os.Exit(2)
+}
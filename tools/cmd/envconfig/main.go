@@ -0,0 +1,188 @@
+// Command envconfig validates .env files against the runner variable schema
+// and regenerates the variable sections of .env.template and
+// docs/ENVIRONMENT_VARIABLES.md.
+//
+// Usage:
+//
+//	cd tools && go run ./cmd/envconfig validate [-compose FILE]... [-partial] [-allow-unknown] [FILE...]
+//	cd tools && go run ./cmd/envconfig template [-check]
+//	cd tools && go run ./cmd/envconfig docs [-check]
+//
+// validate exits 1 when a file has errors. template and docs rewrite the
+// files in place, or with -check exit 1 when they are out of date.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/subhead/github-runners/tools/internal/config"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: envconfig <command> [options]
+
+Commands:
+  validate [FILE...]   Validate .env files (default: .env in the repository root)
+  template             Regenerate the variable sections of .env.template
+  docs                 Regenerate the variable reference in docs/ENVIRONMENT_VARIABLES.md
+  list                 Print every variable with its type, default and scope
+
+Run 'envconfig <command> -h' for the command's options.
+`)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	code := 0
+	switch os.Args[1] {
+	case "validate":
+		code, err = validate(os.Args[2:])
+	case "template":
+		code, err = generate("template", os.Args[2:], ".env.template", config.TemplateBegin, config.TemplateEnd, config.RenderTemplate())
+	case "docs":
+		code, err = generate("docs", os.Args[2:], "docs/ENVIRONMENT_VARIABLES.md", config.DocsBegin, config.DocsEnd, config.RenderDocs())
+	case "list":
+		list()
+	case "-h", "--help", "help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "envconfig: unknown command %q\n", os.Args[1])
+		usage()
+		code = 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "envconfig: %v\n", err)
+		code = 2
+	}
+	os.Exit(code)
+}
+
+// stringList collects a repeatable flag.
+type stringList []string
+
+func (s *stringList) String() string     { return strings.Join(*s, ",") }
+func (s *stringList) Set(v string) error { *s = append(*s, v); return nil }
+
+func validate(args []string) (int, error) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	var composeFiles stringList
+	fs.Var(&composeFiles, "compose", "compose file the .env is used with; warns about variables it does not forward (repeatable)")
+	partial := fs.Bool("partial", false, "skip required-variable checks (for override files)")
+	allowUnknown := fs.Bool("allow-unknown", false, "report unknown variables as warnings")
+	fs.Parse(args)
+
+	opts := config.Options{AllowUnknown: *allowUnknown, Partial: *partial}
+	if len(composeFiles) > 0 {
+		opts.ComposeFiles = map[string]string{}
+		for _, path := range composeFiles {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return 0, err
+			}
+			opts.ComposeFiles[path] = string(data)
+		}
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		root, err := findRoot()
+		if err != nil {
+			return 0, err
+		}
+		files = []string{filepath.Join(root, ".env")}
+	}
+
+	errors := 0
+	for _, path := range files {
+		problems, err := config.ValidateFile(path, opts)
+		if err != nil {
+			return 0, err
+		}
+		for _, p := range problems {
+			fmt.Println(p)
+			if !p.Warning {
+				errors++
+			}
+		}
+	}
+
+	if errors > 0 {
+		fmt.Fprintf(os.Stderr, "envconfig: %d error(s)\n", errors)
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// generate splices generated into the file at rel (relative to the repository root).
+func generate(name string, args []string, rel, begin, end, generated string) (int, error) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	check := fs.Bool("check", false, "exit 1 if the file is out of date instead of rewriting it")
+	fs.Parse(args)
+
+	root, err := findRoot()
+	if err != nil {
+		return 0, err
+	}
+	path := filepath.Join(root, rel)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	updated, err := config.Splice(string(data), begin, end, generated)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", rel, err)
+	}
+
+	if updated == string(data) {
+		return 0, nil
+	}
+	if *check {
+		fmt.Fprintf(os.Stderr, "%s is out of date; run: cd tools && go run ./cmd/envconfig %s\n", rel, name)
+		return 1, nil
+	}
+	if err := os.WriteFile(path, []byte(updated), 0o644); err != nil {
+		return 0, err
+	}
+	fmt.Fprintf(os.Stderr, "Updated %s\n", rel)
+	return 0, nil
+}
+
+func list() {
+	for _, s := range config.Schema {
+		for _, v := range s.Vars {
+			def := v.Default
+			if v.DefaultText != "" {
+				def = v.DefaultText
+			}
+			fmt.Printf("%-30s %-11s %-10s %s\n", v.Name, v.Kind, v.Scope, def)
+		}
+	}
+}
+
+// findRoot walks up from the working directory to the repository root,
+// recognised by .env.template.
+func findRoot() (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for d := wd; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".env.template")); err == nil {
+			return d, nil
+		}
+		if filepath.Dir(d) == d {
+			return "", fmt.Errorf("no .env.template above %s", wd)
+		}
+	}
+}
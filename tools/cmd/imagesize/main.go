@@ -0,0 +1,96 @@
+// Command imagesize reports how much disk a set of local runner images share.
+// For each image it prints the image it is built on and the bytes it adds,
+// then what the images would take stored separately, what they take with
+// shared layers, and the difference.
+//
+// Usage:
+//
+//	cd tools && go run ./cmd/imagesize [-docker-host HOST] [IMAGE...]
+//
+// Without arguments it reports the images that share the Android and Flutter
+// SDKs, from linux-base through android-sdk-pack, flutter-pack and flet-pack
+// to flutter-only, flet-only and full-stack. Images that are not built are
+// skipped.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/subhead/github-runners/tools/internal/docker"
+	"github.com/subhead/github-runners/tools/internal/dockerlint"
+	"github.com/subhead/github-runners/tools/internal/imagesize"
+)
+
+var defaultImages = []string{"linux-base", "android-sdk-pack", "flutter-pack", "flet-pack", "flutter-only", "flet-only", "full-stack"}
+
+func main() {
+	dockerHost := flag.String("docker-host", "", "Docker daemon address (default: $DOCKER_HOST or unix:///var/run/docker.sock)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: imagesize [options] [IMAGE...]\n\nIMAGE is a tag in %s (flet-only) or a full image name.\nDefault: %s\n\nOptions:\n",
+			strings.TrimSuffix(dockerlint.ImagePrefix, ":"), strings.Join(defaultImages, " "))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	names := flag.Args()
+	if len(names) == 0 {
+		names = defaultImages
+	}
+
+	client, err := docker.NewClient(*dockerHost)
+	if err != nil {
+		fail(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var images []imagesize.Image
+	for _, name := range names {
+		if !strings.Contains(name, ":") {
+			name = dockerlint.ImagePrefix + name
+		}
+		img, err := client.ImageInspect(ctx, name)
+		switch {
+		case errors.Is(err, docker.ErrNotFound):
+			fmt.Fprintf(os.Stderr, "imagesize: skipping %s: not built\n", name)
+			continue
+		case err != nil:
+			fail(err)
+		}
+		images = append(images, imagesize.Image{Name: name, ID: img.ID, Size: img.Size, Layers: img.RootFS.Layers})
+	}
+	if len(images) == 0 {
+		fail(errors.New("none of the images are built"))
+	}
+
+	report := imagesize.Analyze(images)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tSIZE\tBUILT ON\tADDS")
+	for _, row := range report.Rows {
+		base := row.Base
+		if base == "" {
+			base = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", row.Name, imagesize.Format(row.Size), base, imagesize.Format(row.Own))
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Printf("Stored separately:   %s\n", imagesize.Format(report.Separate))
+	fmt.Printf("With shared layers:  %s\n", imagesize.Format(report.Stored))
+	if report.Separate > 0 {
+		fmt.Printf("Saved:               %s (%.0f%%)\n", imagesize.Format(report.Saved()), 100*float64(report.Saved())/float64(report.Separate))
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "imagesize: %v\n", err)
+	os.Exit(2)
+}
@@ -0,0 +1,103 @@
+// Command pkgcache is the package cache the runners of a host share. It
+// serves PyPI, npm, the Go module proxy, RubyGems and pub.dev from one
+// endpoint, each under its own path prefix, and keeps what they download on
+// disk so the next runner that needs the same package gets it locally.
+//
+// Usage:
+//
+//	pkgcache -listen :8081 -dir /var/cache/pkgcache -max-size 50g
+//
+// The base image's entrypoint points pip, npm, Go, RubyGems, Bundler and pub
+// at it when CACHE_PROXY_URL is set (http://pkg-cache:8081 in the compose
+// files).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/subhead/github-runners/tools/internal/bytesize"
+	"github.com/subhead/github-runners/tools/internal/pkgcache"
+)
+
+func main() {
+	listen := flag.String("listen", ":8081", "tcp host:port to serve on")
+	dir := flag.String("dir", "/var/cache/pkgcache", "directory the cache is stored in")
+	ttl := flag.Duration("metadata-ttl", 10*time.Minute, "how long package indexes are served before they are refetched")
+	maxSize := flag.String("max-size", "50g", "size the cache is pruned to, such as 50g (K, M, G or T suffix), 0 for no limit")
+	evictEvery := flag.Duration("evict-interval", 10*time.Minute, "how often the cache is pruned to -max-size")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pkgcache [options]\n\nServes /pypi/, /npm/, /go/, /gems/ and /pub/ from a disk cache.\n\nOptions:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	maxBytes, err := bytesize.Parse(*maxSize)
+	if err != nil {
+		fail(fmt.Errorf("-max-size: %w", err))
+	}
+
+	logger := log.New(os.Stderr, "pkgcache: ", log.LstdFlags)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	cache, err := pkgcache.New(pkgcache.Registries(), pkgcache.Options{
+		Dir:         *dir,
+		MetadataTTL: *ttl,
+		MaxBytes:    maxBytes,
+		Logger:      logger,
+	})
+	if err != nil {
+		fail(err)
+	}
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fail(err)
+	}
+
+	server := &http.Server{Handler: cache, ReadHeaderTimeout: 30 * time.Second}
+	logger.Printf("listening on %s (cache %s, limit %s)", *listen, *dir, *maxSize)
+	errs := make(chan error, 1)
+	go func() {
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			errs <- err
+		}
+	}()
+
+	ticker := time.NewTicker(*evictEvery)
+	defer ticker.Stop()
+	cache.Evict()
+wait:
+	for {
+		select {
+		case err := <-errs:
+			fail(err)
+		case <-ticker.C:
+			cache.Evict()
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_ = server.Shutdown(shutdown)
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "pkgcache: %v\n", err)
+	os.Exit(2)
+}
@@ -0,0 +1,3 @@
+module github.com/subhead/github-runners/tools
+
+go 1.22
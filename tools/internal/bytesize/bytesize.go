@@ -0,0 +1,26 @@
+// Package bytesize parses the sizes the servers' flags take.
+package bytesize
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse parses a byte count with an optional K, M, G or T suffix, the way
+// Docker writes sizes (512m, 1.5g, 50GB).
+func Parse(raw string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(raw)), "B")
+	shift := 0
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGT", s[n-1]); i >= 0 {
+			shift = 10 * (i + 1)
+			s = s[:n-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", raw)
+	}
+	return int64(n * float64(int64(1)<<shift)), nil
+}
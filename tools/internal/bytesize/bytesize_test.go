@@ -0,0 +1,34 @@
+package bytesize
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int64
+		wantErr bool
+	}{
+		{raw: "0", want: 0},
+		{raw: "512", want: 512},
+		{raw: "512k", want: 512 << 10},
+		{raw: "512m", want: 512 << 20},
+		{raw: "1.5g", want: 3 << 29},
+		{raw: "50GB", want: 50 << 30},
+		{raw: " 2T ", want: 2 << 40},
+		{raw: "", wantErr: true},
+		{raw: "g", wantErr: true},
+		{raw: "-1g", wantErr: true},
+		{raw: "10x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := Parse(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, want error %v", tt.raw, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %d, want %d", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
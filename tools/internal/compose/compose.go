@@ -0,0 +1,293 @@
+// Package compose reads the parts of a docker-compose file the tools need:
+// each service's image, Dockerfile, user, environment and volumes. It
+// understands the YAML subset the files in docker-compose/ use (block
+// mappings and lists, comments, quoted scalars) rather than full YAML.
+package compose
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Service is one entry under services:.
+type Service struct {
+	Name        string
+	Image       string
+	Context     string // build context, relative to the compose file
+	Dockerfile  string // relative to Context
+	User        string
+	Environment []string // NAME=value entries, unresolved
+	Volumes     []Volume
+}
+
+// Volume is a short-syntax volume entry ("source:target[:mode]").
+type Volume struct {
+	Source   string // host path (as written) or named volume
+	Target   string
+	ReadOnly bool
+}
+
+// Bind reports whether the volume is a host bind mount rather than a named volume.
+func (v Volume) Bind() bool {
+	return strings.HasPrefix(v.Source, ".") || strings.HasPrefix(v.Source, "/") || strings.HasPrefix(v.Source, "~")
+}
+
+// File is a parsed compose file.
+type File struct {
+	Path      string
+	Services  map[string]*Service
+	Variables []string // every variable the file interpolates, sorted
+}
+
+// ServiceNames returns the service names in sorted order.
+func (f *File) ServiceNames() []string {
+	names := make([]string, 0, len(f.Services))
+	for name := range f.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HostPath resolves a bind mount source relative to the compose file.
+func (f *File) HostPath(v Volume) string {
+	src := v.Source
+	if strings.HasPrefix(src, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			src = home + src[1:]
+		}
+	}
+	if filepath.IsAbs(src) {
+		return src
+	}
+	return filepath.Join(filepath.Dir(f.Path), src)
+}
+
+// DockerfilePath returns the service's Dockerfile relative to the compose
+// file's build context, as written in the compose file.
+func (s *Service) DockerfilePath() string {
+	if s.Dockerfile == "" {
+		return ""
+	}
+	return filepath.ToSlash(filepath.Clean(filepath.Join(s.Context, s.Dockerfile)))
+}
+
+type line struct {
+	indent int
+	text   string
+}
+
+// Load parses the compose file at path.
+func Load(path string) (*File, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var lines []line
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		raw := stripComment(scanner.Text())
+		text := strings.TrimSpace(raw)
+		if text == "" {
+			continue
+		}
+		lines = append(lines, line{indent: len(raw) - len(strings.TrimLeft(raw, " ")), text: text})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	f := &File{Path: path, Services: map[string]*Service{}}
+	f.Variables = variables(lines)
+	for i := 0; i < len(lines); i++ {
+		if lines[i].indent == 0 && lines[i].text == "services:" {
+			if err := f.parseServices(lines[i+1:]); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			break
+		}
+	}
+	return f, nil
+}
+
+func (f *File) parseServices(lines []line) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	serviceIndent := lines[0].indent
+	var (
+		svc     *Service
+		section string // key at service level whose children we are reading
+	)
+	for _, l := range lines {
+		if l.indent == 0 {
+			break
+		}
+		if l.indent == serviceIndent {
+			name := strings.TrimSuffix(l.text, ":")
+			svc = &Service{Name: name, Context: "."}
+			f.Services[name] = svc
+			section = ""
+			continue
+		}
+		if svc == nil {
+			continue
+		}
+
+		key, value, isKey := splitKey(l.text)
+		if l.indent == serviceIndent+2 {
+			section = ""
+			if !isKey {
+				continue
+			}
+			switch key {
+			case "image":
+				svc.Image = value
+			case "user":
+				svc.User = value
+			case "build":
+				if value != "" {
+					svc.Context = value
+				}
+			}
+			if value == "" {
+				section = key
+			}
+			continue
+		}
+
+		switch section {
+		case "build":
+			if isKey && l.indent == serviceIndent+4 {
+				switch key {
+				case "context":
+					svc.Context = value
+				case "dockerfile":
+					svc.Dockerfile = value
+				}
+			}
+		case "environment":
+			if item, ok := listItem(l.text); ok {
+				svc.Environment = append(svc.Environment, item)
+			} else if isKey {
+				svc.Environment = append(svc.Environment, key+"="+value)
+			}
+		case "volumes":
+			if item, ok := listItem(l.text); ok {
+				svc.Volumes = append(svc.Volumes, parseVolume(item))
+			}
+		}
+	}
+	return nil
+}
+
+var keyPattern = regexp.MustCompile(`^([A-Za-z0-9_.<-]+):(?:\s+(.*))?$`)
+
+// splitKey splits "key: value" and reports whether the line is a mapping entry.
+func splitKey(text string) (string, string, bool) {
+	m := keyPattern.FindStringSubmatch(text)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], unquote(m[2]), true
+}
+
+func listItem(text string) (string, bool) {
+	item, ok := strings.CutPrefix(text, "- ")
+	if !ok {
+		return "", false
+	}
+	return unquote(strings.TrimSpace(item)), true
+}
+
+func parseVolume(item string) Volume {
+	parts := strings.Split(item, ":")
+	v := Volume{Source: parts[0]}
+	if len(parts) > 1 {
+		v.Target = parts[1]
+	}
+	if len(parts) > 2 {
+		for _, opt := range strings.Split(parts[2], ",") {
+			if opt == "ro" {
+				v.ReadOnly = true
+			}
+		}
+	}
+	return v
+}
+
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// stripComment removes a # comment that is not inside quotes.
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return strings.TrimRight(s[:i], " \t")
+		}
+	}
+	return strings.TrimRight(s, " \t")
+}
+
+// variables returns the names referenced by ${VAR} and $VAR anywhere in lines.
+func variables(lines []line) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, l := range lines {
+		for _, sub := range varPattern.FindAllStringSubmatch(l.text, -1) {
+			name := sub[1] + sub[4]
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+var varPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:?[-?])([^}]*))?\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// Interpolate expands ${VAR}, ${VAR:-default}, ${VAR-default}, ${VAR:?err}
+// and $VAR the way docker compose does, using lookup for variable values.
+func Interpolate(s string, lookup func(string) (string, bool)) string {
+	return varPattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := varPattern.FindStringSubmatch(m)
+		if sub[4] != "" {
+			v, _ := lookup(sub[4])
+			return v
+		}
+		v, ok := lookup(sub[1])
+		switch sub[2] {
+		case ":-":
+			if v == "" {
+				return sub[3]
+			}
+		case "-":
+			if !ok {
+				return sub[3]
+			}
+		}
+		return v
+	})
+}
@@ -0,0 +1,112 @@
+package compose
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "linux-test.yml")
+	content := `version: '3.8'
+
+services:
+  test-runner:
+    build:
+      context: ../
+      dockerfile: docker/linux/composite/Dockerfile.test   # comment
+    image: "gh-runner:test"
+    command: ["--cpus", "$CPUS"]
+    user: '1001:1001'
+    environment:
+      - RUNNER_NAME=${RUNNER_NAME:-test-runner-01}
+      # - IGNORED=${IGNORED}
+      - "LABELS=linux # not a comment"
+    volumes:
+      # Runner registration
+      - ./data/test-runner:/actions-runner
+      - control:/run/gh-runner-control:ro
+  helper:
+    build: ./helper
+    environment:
+      MODE: fast
+
+volumes:
+  control:
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.ServiceNames(); !reflect.DeepEqual(got, []string{"helper", "test-runner"}) {
+		t.Fatalf("ServiceNames = %q", got)
+	}
+
+	if got := f.Variables; !reflect.DeepEqual(got, []string{"CPUS", "RUNNER_NAME"}) {
+		t.Fatalf("Variables = %q", got)
+	}
+
+	runner := f.Services["test-runner"]
+	want := &Service{
+		Name:        "test-runner",
+		Image:       "gh-runner:test",
+		Context:     "../",
+		Dockerfile:  "docker/linux/composite/Dockerfile.test",
+		User:        "1001:1001",
+		Environment: []string{"RUNNER_NAME=${RUNNER_NAME:-test-runner-01}", "LABELS=linux # not a comment"},
+		Volumes: []Volume{
+			{Source: "./data/test-runner", Target: "/actions-runner"},
+			{Source: "control", Target: "/run/gh-runner-control", ReadOnly: true},
+		},
+	}
+	if !reflect.DeepEqual(runner, want) {
+		t.Fatalf("test-runner = %+v\nwant %+v", runner, want)
+	}
+	if got := runner.DockerfilePath(); got != "../docker/linux/composite/Dockerfile.test" {
+		t.Fatalf("DockerfilePath = %q", got)
+	}
+	if !runner.Volumes[0].Bind() || runner.Volumes[1].Bind() {
+		t.Fatal("Bind() should be true for the host path only")
+	}
+	if got := f.HostPath(runner.Volumes[0]); got != filepath.Join(dir, "data", "test-runner") {
+		t.Fatalf("HostPath = %q", got)
+	}
+
+	helper := f.Services["helper"]
+	if helper.Context != "./helper" || !reflect.DeepEqual(helper.Environment, []string{"MODE=fast"}) {
+		t.Fatalf("helper = %+v", helper)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{"SET": "value", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	tests := []struct {
+		s, want string
+	}{
+		{"${SET}", "value"},
+		{"$SET/x", "value/x"},
+		{"${UNSET}", ""},
+		{"${UNSET:-default}", "default"},
+		{"${EMPTY:-default}", "default"},
+		{"${EMPTY-default}", ""},
+		{"${UNSET-default}", "default"},
+		{"${SET:-default}", "value"},
+		{"${UNSET:?must be set}", ""},
+		{"a ${SET} b ${UNSET:-c}", "a value b c"},
+	}
+	for _, tt := range tests {
+		if got := Interpolate(tt.s, lookup); got != tt.want {
+			t.Errorf("Interpolate(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Markers delimit the generated part of .env.template and the docs; the
+// text outside them is maintained by hand.
+const (
+	TemplateBegin = "# >>> BEGIN GENERATED VARIABLES (cd tools && go run ./cmd/envconfig template) >>>"
+	TemplateEnd   = "# <<< END GENERATED VARIABLES <<<"
+	DocsBegin     = "<!-- BEGIN GENERATED VARIABLES (cd tools && go run ./cmd/envconfig docs) -->"
+	DocsEnd       = "<!-- END GENERATED VARIABLES -->"
+)
+
+const banner = "# ============================================================================="
+
+// defaultText is the default as shown to people.
+func (v Var) defaultText() string {
+	switch {
+	case v.DefaultText != "":
+		return v.DefaultText
+	case v.Required:
+		return "(required)"
+	case v.OneOf != "":
+		return "(required unless " + strings.Join(oneOfPeers(v), " or ") + " is set)"
+	case v.Default == "":
+		return "(empty)"
+	}
+	return v.Default
+}
+
+// oneOfPeers returns the other variables in v's OneOf group.
+func oneOfPeers(v Var) []string {
+	var peers []string
+	for _, s := range Schema {
+		for _, p := range s.Vars {
+			if p.OneOf == v.OneOf && p.Name != v.Name {
+				peers = append(peers, p.Name)
+			}
+		}
+	}
+	return peers
+}
+
+// RenderTemplate renders the variable sections of .env.template.
+func RenderTemplate() string {
+	var b strings.Builder
+	for i, s := range Schema {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s\n# %s\n%s\n", banner, s.Title, banner)
+
+		for _, v := range s.Vars {
+			b.WriteString("\n")
+			for _, line := range v.Description {
+				fmt.Fprintf(&b, "# %s\n", line)
+			}
+			fmt.Fprintf(&b, "# Default: %s\n", v.defaultText())
+			if v.Kind == Enum {
+				fmt.Fprintf(&b, "# Options: %s\n", strings.Join(v.Allowed, ", "))
+			}
+			switch {
+			case len(v.Examples) == 1:
+				fmt.Fprintf(&b, "# Example: %s=%s\n", v.Name, v.Examples[0])
+			case v.Kind == List:
+				// Comma-separated values would run together on one line
+				b.WriteString("# Examples:\n")
+				for _, ex := range v.Examples {
+					fmt.Fprintf(&b, "#   - %s\n", ex)
+				}
+			case len(v.Examples) > 1:
+				fmt.Fprintf(&b, "# Examples: %s\n", strings.Join(v.Examples, ", "))
+			}
+
+			value := v.Template
+			if value == "" {
+				value = v.Default
+			}
+			if v.Commented {
+				b.WriteString("# ")
+			}
+			fmt.Fprintf(&b, "%s=%s\n", v.Name, value)
+		}
+	}
+	return b.String()
+}
+
+// RenderDocs renders the variable reference of docs/ENVIRONMENT_VARIABLES.md.
+func RenderDocs() string {
+	var b strings.Builder
+	b.WriteString("## Variable Reference\n\n")
+	b.WriteString("Scope `entrypoint` variables are passed into the runner container and read by the entrypoint or job hooks; ")
+	b.WriteString("a compose file must forward them in its `environment:` list. Scope `compose` variables are only interpolated into the compose files.\n")
+
+	for _, s := range Schema {
+		fmt.Fprintf(&b, "\n### %s\n\n", s.Heading)
+		b.WriteString("| Variable | Type | Default | Scope | Description |\n")
+		b.WriteString("|----------|------|---------|-------|-------------|\n")
+		for _, v := range s.Vars {
+			typ := v.Kind.String()
+			if v.Kind == Enum {
+				typ = "`" + strings.Join(v.Allowed, "` \\| `") + "`"
+			}
+			if v.Secret {
+				typ += " (secret)"
+			}
+
+			def := v.defaultText()
+			if v.DefaultText == "" && v.Default != "" {
+				def = "`" + def + "`"
+			}
+
+			desc := ""
+			if len(v.Description) > 0 {
+				desc = v.Description[0]
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s | %s | %s |\n", v.Name, typ, def, v.Scope, escapeCell(desc))
+		}
+	}
+	return b.String()
+}
+
+func escapeCell(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
+
+// Splice replaces the text between the begin and end marker lines of content
+// with generated.
+func Splice(content, begin, end, generated string) (string, error) {
+	i := strings.Index(content, begin+"\n")
+	if i < 0 {
+		return "", fmt.Errorf("marker %q not found", begin)
+	}
+	start := i + len(begin) + 1
+
+	j := strings.Index(content[start:], end)
+	if j < 0 {
+		return "", fmt.Errorf("marker %q not found", end)
+	}
+	return content[:start] + generated + content[start+j:], nil
+}
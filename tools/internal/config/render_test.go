@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplice(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "replaces between markers", content: "a\n# BEGIN\nold\n# END\nb\n", want: "a\n# BEGIN\nnew\n# END\nb\n"},
+		{name: "empty section", content: "# BEGIN\n# END\n", want: "# BEGIN\nnew\n# END\n"},
+		{name: "no begin marker", content: "old\n# END\n", wantErr: true},
+		{name: "no end marker", content: "# BEGIN\nold\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Splice(tt.content, "# BEGIN", "# END", "new\n")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Splice error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("Splice = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	template, docs := RenderTemplate(), RenderDocs()
+	for _, name := range Names() {
+		if !strings.Contains(template, name) {
+			t.Errorf(".env.template section does not mention %s", name)
+		}
+		if !strings.Contains(docs, "`"+name+"`") {
+			t.Errorf("docs section does not list %s", name)
+		}
+	}
+}
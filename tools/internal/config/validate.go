@@ -0,0 +1,374 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is one assignment in a .env file.
+type Entry struct {
+	Line  int
+	Name  string
+	Value string
+}
+
+// Problem is a validation error or warning tied to a line of the .env file.
+// Line is 0 for problems about the file as a whole, such as a missing variable.
+type Problem struct {
+	Path    string
+	Line    int
+	Name    string
+	Warning bool
+	Message string
+}
+
+func (p Problem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+	loc := p.Path
+	if p.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", p.Path, p.Line)
+	}
+	if p.Name == "" {
+		return fmt.Sprintf("%s: %s: %s", loc, level, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", loc, level, p.Name, p.Message)
+}
+
+var (
+	namePattern       = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	ownerPattern      = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9-]{0,38})$`)
+	repositoryPattern = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9-]{0,38})/[A-Za-z0-9._-]{1,100}$`)
+	sizePattern       = regexp.MustCompile(`(?i)^[0-9]+(\.[0-9]+)?[bkmg]?b?$`)
+	tokenPattern      = regexp.MustCompile(`^(ghp_|gho_|ghu_|ghs_|github_pat_)[A-Za-z0-9_]+$|^[0-9a-f]{40}$`)
+)
+
+// placeholderPattern matches the values .env.template ships with
+var placeholderPattern = regexp.MustCompile(`^YOUR_[A-Z_/]+$`)
+
+// ParseEnv reads KEY=VALUE assignments the way docker compose does: blank
+// lines and # comments are skipped, "export " is allowed, values may be
+// single- or double-quoted and unquoted values end at " #".
+func ParseEnv(r io.Reader) ([]Entry, []Problem) {
+	var (
+		entries  []Entry
+		problems []Problem
+		n        int
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok {
+			problems = append(problems, Problem{Line: n, Message: fmt.Sprintf("expected NAME=VALUE, got %q", line)})
+			continue
+		}
+		if !namePattern.MatchString(name) {
+			problems = append(problems, Problem{Line: n, Message: fmt.Sprintf("invalid variable name %q", name)})
+			continue
+		}
+
+		value, err := parseValue(strings.TrimSpace(value))
+		if err != nil {
+			problems = append(problems, Problem{Line: n, Name: name, Message: err.Error()})
+			continue
+		}
+		entries = append(entries, Entry{Line: n, Name: name, Value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		problems = append(problems, Problem{Message: err.Error()})
+	}
+	return entries, problems
+}
+
+func parseValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	if q := raw[0]; q == '"' || q == '\'' {
+		end := strings.LastIndexByte(raw, q)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated %c quote", q)
+		}
+		if rest := strings.TrimSpace(raw[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after quoted value", rest)
+		}
+		value := raw[1:end]
+		if q == '"' {
+			value = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value)
+		}
+		return value, nil
+	}
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.TrimSpace(raw), nil
+}
+
+// Options change what Validate reports.
+type Options struct {
+	// AllowUnknown reports unknown variables as warnings instead of errors
+	AllowUnknown bool
+	// Partial skips the required-variable checks, for files layered on top
+	// of another .env
+	Partial bool
+	// ComposeFiles are checked to forward every entrypoint variable the .env
+	// sets; variables no compose file references are reported as unused
+	ComposeFiles map[string]string
+}
+
+// ValidateFile parses and validates the .env file at path.
+func ValidateFile(path string, opts Options) ([]Problem, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	entries, problems := ParseEnv(fh)
+	problems = append(problems, Validate(entries, opts)...)
+	for i := range problems {
+		problems[i].Path = path
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	return problems, nil
+}
+
+// Validate checks parsed entries against the schema.
+func Validate(entries []Entry, opts Options) []Problem {
+	var problems []Problem
+	seen := map[string]Entry{}
+
+	for _, e := range entries {
+		if prev, ok := seen[e.Name]; ok {
+			problems = append(problems, Problem{Line: e.Line, Name: e.Name, Warning: true,
+				Message: fmt.Sprintf("already set on line %d; this value wins", prev.Line)})
+		}
+		seen[e.Name] = e
+
+		v, ok := Lookup(e.Name)
+		if !ok {
+			msg := "unknown variable"
+			if s := suggest(e.Name); s != "" {
+				msg += fmt.Sprintf(" (did you mean %s?)", s)
+			}
+			problems = append(problems, Problem{Line: e.Line, Name: e.Name, Warning: opts.AllowUnknown, Message: msg})
+			continue
+		}
+
+		if err := v.Check(e.Value); err != nil {
+			problems = append(problems, Problem{Line: e.Line, Name: e.Name, Message: err.Error()})
+		}
+
+		if v.Scope == Entrypoint && len(opts.ComposeFiles) > 0 && !forwarded(e.Name, opts.ComposeFiles) {
+			problems = append(problems, Problem{Line: e.Line, Name: e.Name, Warning: true,
+				Message: "not passed to the container by " + composeNames(opts.ComposeFiles) + "; the value is ignored"})
+		}
+	}
+
+	if opts.Partial {
+		return problems
+	}
+
+	// Groups in schema order, so the problems come out in a stable order
+	var order []string
+	groups := map[string][]string{}
+	for _, s := range Schema {
+		for _, v := range s.Vars {
+			if v.Required && seen[v.Name].Value == "" {
+				problems = append(problems, Problem{Name: v.Name, Message: "required variable is not set"})
+			}
+			if v.OneOf != "" {
+				if groups[v.OneOf] == nil {
+					order = append(order, v.OneOf)
+				}
+				groups[v.OneOf] = append(groups[v.OneOf], v.Name)
+			}
+		}
+	}
+	for _, group := range order {
+		names := groups[group]
+		set := 0
+		for _, name := range names {
+			if seen[name].Value != "" {
+				set++
+			}
+		}
+		if set == 0 {
+			problems = append(problems, Problem{Message: "one of " + strings.Join(names, " or ") + " must be set"})
+		}
+	}
+	if seen["GITHUB_OWNER"].Value != "" && seen["GITHUB_REPOSITORY"].Value != "" {
+		problems = append(problems, Problem{Line: seen["GITHUB_OWNER"].Line, Name: "GITHUB_OWNER", Warning: true,
+			Message: "ignored because GITHUB_REPOSITORY is also set"})
+	}
+	return problems
+}
+
+// Check validates a single value. An empty value means "use the default" and
+// is only an error for required variables.
+func (v Var) Check(value string) error {
+	if value == "" {
+		if v.Required {
+			return fmt.Errorf("must not be empty")
+		}
+		return nil
+	}
+	if placeholderPattern.MatchString(value) {
+		return fmt.Errorf("still set to the .env.template placeholder %q", value)
+	}
+
+	switch v.Kind {
+	case Bool:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("%q is not a boolean (use true or false)", value)
+		}
+	case Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		return v.checkBounds(float64(n), value)
+	case Float:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		return v.checkBounds(f, value)
+	case Duration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("%q is not a duration (e.g. 30s, 1m, 1m30s)", value)
+		}
+	case Size:
+		if !sizePattern.MatchString(value) {
+			return fmt.Errorf("%q is not a size (e.g. 512m, 2g)", value)
+		}
+	case Enum:
+		for _, a := range v.Allowed {
+			if value == a {
+				return nil
+			}
+		}
+		msg := fmt.Sprintf("%q is not one of %s", value, strings.Join(v.Allowed, ", "))
+		for _, a := range v.Allowed {
+			if strings.EqualFold(value, a) {
+				msg += fmt.Sprintf(" (values are case-sensitive; use %s)", a)
+			}
+		}
+		return fmt.Errorf("%s", msg)
+	case List:
+		for i, item := range strings.Split(value, ",") {
+			if item == "" {
+				return fmt.Errorf("item %d of %q is empty", i+1, value)
+			}
+			if strings.ContainsAny(item, " \t") {
+				return fmt.Errorf("item %q contains whitespace; separate items with commas only", item)
+			}
+		}
+	case PathList:
+		for _, p := range strings.Split(value, ":") {
+			if p != "" && !strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "~") {
+				return fmt.Errorf("path %q must be absolute", p)
+			}
+		}
+	case AbsPath:
+		if !strings.HasPrefix(value, "/") {
+			return fmt.Errorf("%q must be an absolute path", value)
+		}
+	case Owner:
+		if !ownerPattern.MatchString(value) {
+			if strings.Contains(value, "/") {
+				return fmt.Errorf("%q looks like a repository; set GITHUB_REPOSITORY instead", value)
+			}
+			return fmt.Errorf("%q is not a valid GitHub organization or user name", value)
+		}
+	case Repository:
+		if !repositoryPattern.MatchString(value) {
+			return fmt.Errorf("%q is not in owner/repo form", value)
+		}
+	case Token:
+		if !tokenPattern.MatchString(value) {
+			return fmt.Errorf("does not look like a GitHub token (expected a ghp_, github_pat_ or ghs_ prefix)")
+		}
+	}
+	return nil
+}
+
+func (v Var) checkBounds(n float64, value string) error {
+	if v.Min != nil && n < *v.Min {
+		return fmt.Errorf("%s is below the minimum %g", value, *v.Min)
+	}
+	if v.Max != nil && n > *v.Max {
+		return fmt.Errorf("%s is above the maximum %g", value, *v.Max)
+	}
+	return nil
+}
+
+// forwarded reports whether any compose file references name.
+func forwarded(name string, files map[string]string) bool {
+	re := regexp.MustCompile(`\$\{?` + name + `\b|\b` + name + `=`)
+	for _, content := range files {
+		if re.MatchString(content) {
+			return true
+		}
+	}
+	return false
+}
+
+func composeNames(files map[string]string) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// suggest returns the known variable closest to name, if any is close enough
+// to be a typo.
+func suggest(name string) string {
+	best, bestDist := "", 3
+	for _, known := range Names() {
+		if d := distance(strings.ToUpper(name), known); d < bestDist {
+			best, bestDist = known, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/subhead/github-runners/tools/internal/compose"
+)
+
+func TestParseEnv(t *testing.T) {
+	entries, problems := ParseEnv(strings.NewReader(`# comment
+
+export RUNNER_NAME=runner-01
+RUNNER_LABELS=linux,x64 # trailing comment
+QUOTED="a \"b\" # not a comment"
+SINGLE='c\nd'
+EMPTY=
+not an assignment
+1BAD=x
+OPEN="unterminated
+`))
+	want := []Entry{
+		{Line: 3, Name: "RUNNER_NAME", Value: "runner-01"},
+		{Line: 4, Name: "RUNNER_LABELS", Value: "linux,x64"},
+		{Line: 5, Name: "QUOTED", Value: `a "b" # not a comment`},
+		{Line: 6, Name: "SINGLE", Value: `c\nd`},
+		{Line: 7, Name: "EMPTY", Value: ""},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("entries = %+v, want %+v", entries, want)
+	}
+	var lines []int
+	for _, p := range problems {
+		lines = append(lines, p.Line)
+	}
+	if want := []int{8, 9, 10}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("problems on lines %v, want %v: %v", lines, want, problems)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       Var
+		value   string
+		wantErr string // substring of the error, "" for none
+	}{
+		{name: "empty optional", v: Var{Kind: Int}, value: ""},
+		{name: "empty required", v: Var{Kind: String, Required: true}, value: "", wantErr: "must not be empty"},
+		{name: "placeholder", v: Var{Kind: String}, value: "YOUR_GITHUB_TOKEN_HERE", wantErr: "placeholder"},
+		{name: "bool", v: Var{Kind: Bool}, value: "true"},
+		{name: "bool spelled yes", v: Var{Kind: Bool}, value: "yes", wantErr: "not a boolean"},
+		{name: "int in bounds", v: Var{Kind: Int, Min: bound(0), Max: bound(10)}, value: "10"},
+		{name: "int below minimum", v: Var{Kind: Int, Min: bound(0)}, value: "-1", wantErr: "below the minimum"},
+		{name: "int above maximum", v: Var{Kind: Int, Max: bound(10)}, value: "11", wantErr: "above the maximum"},
+		{name: "float as int", v: Var{Kind: Int}, value: "1.5", wantErr: "not an integer"},
+		{name: "float", v: Var{Kind: Float, Max: bound(2)}, value: "1.5"},
+		{name: "duration", v: Var{Kind: Duration}, value: "1m30s"},
+		{name: "duration without unit", v: Var{Kind: Duration}, value: "30", wantErr: "not a duration"},
+		{name: "size", v: Var{Kind: Size}, value: "6g"},
+		{name: "size with unit word", v: Var{Kind: Size}, value: "6 gigs", wantErr: "not a size"},
+		{name: "enum", v: Var{Kind: Enum, Allowed: []string{"json", "text"}}, value: "json"},
+		{name: "enum case", v: Var{Kind: Enum, Allowed: []string{"json", "text"}}, value: "JSON", wantErr: "case-sensitive; use json"},
+		{name: "list", v: Var{Kind: List}, value: "linux,x64"},
+		{name: "list with spaces", v: Var{Kind: List}, value: "linux, x64", wantErr: "whitespace"},
+		{name: "list with empty item", v: Var{Kind: List}, value: "linux,,x64", wantErr: "item 2"},
+		{name: "path list", v: Var{Kind: PathList}, value: "/a:~/b"},
+		{name: "relative path in list", v: Var{Kind: PathList}, value: "/a:b", wantErr: "must be absolute"},
+		{name: "relative path", v: Var{Kind: AbsPath}, value: "run/secrets", wantErr: "absolute path"},
+		{name: "owner", v: Var{Kind: Owner}, value: "my-org"},
+		{name: "repository as owner", v: Var{Kind: Owner}, value: "my-org/repo", wantErr: "set GITHUB_REPOSITORY"},
+		{name: "repository", v: Var{Kind: Repository}, value: "my-org/repo.js"},
+		{name: "owner as repository", v: Var{Kind: Repository}, value: "my-org", wantErr: "owner/repo"},
+		{name: "token", v: Var{Kind: Token}, value: "ghp_abc123"},
+		{name: "password as token", v: Var{Kind: Token}, value: "hunter2", wantErr: "GitHub token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.v.Check(tt.value)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Check(%q) = %v, want no error", tt.value, err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("Check(%q) = %v, want an error containing %q", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		opts Options
+		want []string // messages, errors and warnings alike
+	}{
+		{name: "minimal", env: "GITHUB_TOKEN=ghp_abc\nGITHUB_REPOSITORY=o/r\n"},
+		{name: "nothing set", env: "", want: []string{
+			"one of GITHUB_TOKEN or GITHUB_TOKEN_FILE must be set",
+			"one of GITHUB_OWNER or GITHUB_REPOSITORY must be set",
+		}},
+		{name: "partial", env: "RUNNER_NAME=r\n", opts: Options{Partial: true}},
+		{name: "typo", env: "RUNER_NAME=r\n", opts: Options{Partial: true}, want: []string{"unknown variable (did you mean RUNNER_NAME?)"}},
+		{name: "set twice", env: "RUNNER_NAME=a\nRUNNER_NAME=b\n", opts: Options{Partial: true}, want: []string{"already set on line 1; this value wins"}},
+		{name: "owner and repository", env: "GITHUB_TOKEN=ghp_abc\nGITHUB_OWNER=o\nGITHUB_REPOSITORY=o/r\n", want: []string{"ignored because GITHUB_REPOSITORY is also set"}},
+		{name: "not forwarded", env: "RUNNER_NAME=r\n", opts: Options{Partial: true, ComposeFiles: map[string]string{"linux-base.yml": "environment:\n  - RUNNER_LABELS=x\n"}},
+			want: []string{"not passed to the container by linux-base.yml; the value is ignored"}},
+		{name: "forwarded", env: "RUNNER_NAME=r\n", opts: Options{Partial: true, ComposeFiles: map[string]string{"linux-base.yml": "environment:\n  - RUNNER_NAME=${RUNNER_NAME:-r}\n"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, problems := ParseEnv(strings.NewReader(tt.env))
+			if len(problems) > 0 {
+				t.Fatal(problems)
+			}
+			var got []string
+			for _, p := range Validate(entries, tt.opts) {
+				got = append(got, p.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Validate = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSchema keeps the schema itself valid: unique names and defaults that
+// pass their own checks.
+func TestSchema(t *testing.T) {
+	seen := map[string]bool{}
+	for _, name := range Names() {
+		if seen[name] {
+			t.Errorf("%s is defined twice", name)
+		}
+		seen[name] = true
+		if !namePattern.MatchString(name) {
+			t.Errorf("%s is not a valid variable name", name)
+		}
+	}
+	for _, s := range Schema {
+		for _, v := range s.Vars {
+			if len(v.Description) == 0 {
+				t.Errorf("%s has no description", v.Name)
+			}
+			if v.Kind == Enum && len(v.Allowed) == 0 {
+				t.Errorf("%s is an enum without allowed values", v.Name)
+			}
+			if v.Required && v.Default == "" {
+				continue // has to be set in .env
+			}
+			if err := v.Check(v.Default); err != nil {
+				t.Errorf("%s default: %v", v.Name, err)
+			}
+		}
+	}
+}
+
+// TestSchemaCoversCompose fails when a compose stack interpolates a variable
+// the schema does not define, which envconfig validate would call unknown.
+func TestSchemaCoversCompose(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "..", "..", "docker-compose", "*.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no compose files found")
+	}
+	for _, path := range paths {
+		f, err := compose.Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range f.Variables {
+			if _, ok := Lookup(name); !ok {
+				t.Errorf("%s: %s is not in the schema", filepath.Base(path), name)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package controltoken
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.token")
+	token, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 64 {
+		t.Fatalf("token %q, want 64 hex digits", token)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Fatalf("token file mode %v, want 0600", mode)
+	}
+
+	again, err := Load(path)
+	if err != nil || again != token {
+		t.Fatalf("second Load = %q, %v, want %q", again, err, token)
+	}
+
+	if err := os.WriteFile(path, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("Load of an empty token file succeeded")
+	}
+}
+
+func TestAuthorized(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   bool
+	}{
+		{name: "matching", token: "secret", header: "Bearer secret", want: true},
+		{name: "wrong token", token: "secret", header: "Bearer secreT"},
+		{name: "prefix of the token", token: "secret", header: "Bearer secre"},
+		{name: "no scheme", token: "secret", header: "secret"},
+		{name: "basic", token: "secret", header: "Basic secret"},
+		{name: "missing", token: "secret"},
+		{name: "no token configured", header: "Bearer "},
+		{name: "no token configured or sent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodPut, "http://server/job", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if got := Authorized(r, tt.token); got != tt.want {
+				t.Fatalf("Authorized = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Package docker is a minimal Docker Engine API client over the daemon
+// socket, covering the calls the tools make: ping, info and image inspect.
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultHost is used when DOCKER_HOST is not set.
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// ErrNotFound is returned when an object does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Client talks to one Docker daemon.
+type Client struct {
+	Host string
+	http *http.Client
+	base string
+}
+
+// NewClient connects to host, which is a unix:// or tcp:// address. An
+// empty host means DOCKER_HOST or DefaultHost.
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultHost
+	}
+
+	transport, base, err := Transport(host)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		Host: host,
+		http: &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		base: base,
+	}, nil
+}
+
+// Transport returns an HTTP transport that dials the daemon at host (a
+// unix:// or tcp:// address) and the base URL requests must use.
+func Transport(host string) (*http.Transport, string, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid DOCKER_HOST %q: %w", host, err)
+	}
+
+	transport := &http.Transport{}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		return transport, "http://docker", nil
+	case "tcp", "http":
+		return transport, "http://" + u.Host, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported DOCKER_HOST scheme %q", u.Scheme)
+	}
+}
+
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode >= 300:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	case out == nil:
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Ping checks that the daemon answers.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.get(ctx, "/_ping", nil)
+}
+
+// Version is the subset of GET /version the tools use.
+type Version struct {
+	Version    string `json:"Version"`
+	APIVersion string `json:"ApiVersion"`
+}
+
+// Version returns the daemon version.
+func (c *Client) Version(ctx context.Context) (Version, error) {
+	var v Version
+	err := c.get(ctx, "/version", &v)
+	return v, err
+}
+
+// Info is the subset of GET /info the tools use.
+type Info struct {
+	DockerRootDir string `json:"DockerRootDir"`
+	Driver        string `json:"Driver"`
+}
+
+// Info returns daemon-wide information.
+func (c *Client) Info(ctx context.Context) (Info, error) {
+	var info Info
+	err := c.get(ctx, "/info", &info)
+	return info, err
+}
+
+// Image is the subset of GET /images/{name}/json the tools use.
+type Image struct {
+	ID      string            `json:"Id"`
+	Created time.Time         `json:"Created"`
+	Size    int64             `json:"Size"`
+	Labels  map[string]string `json:"-"`
+	Config  struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	// RootFS lists the image's layers, base first, by content digest
+	RootFS struct {
+		Layers []string `json:"Layers"`
+	} `json:"RootFS"`
+}
+
+// ImageInspect returns the local image called name, or ErrNotFound.
+func (c *Client) ImageInspect(ctx context.Context, name string) (Image, error) {
+	var img Image
+	if err := c.get(ctx, "/images/"+url.PathEscape(name)+"/json", &img); err != nil {
+		return Image{}, err
+	}
+	img.Labels = img.Config.Labels
+	return img, nil
+}
@@ -0,0 +1,94 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func daemon() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_ping":
+			fmt.Fprint(w, "OK")
+		case "/version":
+			fmt.Fprint(w, `{"Version":"25.0.3","ApiVersion":"1.44"}`)
+		case "/images/gh-runner:linux-base/json":
+			fmt.Fprint(w, `{"Id":"sha256:abc","Size":42,"Config":{"Labels":{"a":"b"}},"RootFS":{"Layers":["sha256:1","sha256:2"]}}`)
+		case "/info":
+			http.Error(w, "daemon is shutting down", http.StatusInternalServerError)
+		default:
+			http.Error(w, `{"message":"No such image"}`, http.StatusNotFound)
+		}
+	})
+}
+
+func TestClient(t *testing.T) {
+	tcp := httptest.NewServer(daemon())
+	t.Cleanup(tcp.Close)
+
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unix := &httptest.Server{Listener: ln, Config: &http.Server{Handler: daemon()}}
+	unix.Start()
+	t.Cleanup(unix.Close)
+
+	for _, host := range []string{"tcp://" + strings.TrimPrefix(tcp.URL, "http://"), "unix://" + socket} {
+		t.Run(host, func(t *testing.T) {
+			c, err := NewClient(host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			if err := c.Ping(ctx); err != nil {
+				t.Fatalf("Ping: %v", err)
+			}
+			if v, err := c.Version(ctx); err != nil || v.Version != "25.0.3" || v.APIVersion != "1.44" {
+				t.Fatalf("Version = %+v, %v", v, err)
+			}
+			img, err := c.ImageInspect(ctx, "gh-runner:linux-base")
+			if err != nil || img.Size != 42 || img.Labels["a"] != "b" || len(img.RootFS.Layers) != 2 {
+				t.Fatalf("ImageInspect = %+v, %v", img, err)
+			}
+			if _, err := c.ImageInspect(ctx, "gh-runner:missing"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("ImageInspect of a missing image: %v, want %v", err, ErrNotFound)
+			}
+			if _, err := c.Info(ctx); err == nil || !strings.Contains(err.Error(), "shutting down") {
+				t.Fatalf("Info error = %v, want the daemon's message", err)
+			}
+		})
+	}
+}
+
+func TestNewClientHost(t *testing.T) {
+	tests := []struct {
+		host, env string
+		want      string
+		wantErr   bool
+	}{
+		{host: "tcp://127.0.0.1:2375", want: "tcp://127.0.0.1:2375"},
+		{env: "unix:///run/docker.sock", want: "unix:///run/docker.sock"},
+		{want: DefaultHost},
+		{host: "ssh://docker@host", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("DOCKER_HOST", tt.env)
+		c, err := NewClient(tt.host)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewClient(%q) with DOCKER_HOST=%q error = %v, want error %v", tt.host, tt.env, err, tt.wantErr)
+			continue
+		}
+		if err == nil && c.Host != tt.want {
+			t.Errorf("NewClient(%q) with DOCKER_HOST=%q uses %q, want %q", tt.host, tt.env, c.Host, tt.want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+// Package dockerfile parses Dockerfiles into instructions and build stages
+// without a Docker daemon. It understands line continuations, comments, the
+// escape parser directive, --flags and JSON (exec form) arguments, which is
+// all the repo's Dockerfiles use.
+package dockerfile
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Instructions lists every instruction keyword Docker accepts.
+var Instructions = map[string]bool{
+	"ADD":         true,
+	"ARG":         true,
+	"CMD":         true,
+	"COPY":        true,
+	"ENTRYPOINT":  true,
+	"ENV":         true,
+	"EXPOSE":      true,
+	"FROM":        true,
+	"HEALTHCHECK": true,
+	"LABEL":       true,
+	"MAINTAINER":  true,
+	"ONBUILD":     true,
+	"RUN":         true,
+	"SHELL":       true,
+	"STOPSIGNAL":  true,
+	"USER":        true,
+	"VOLUME":      true,
+	"WORKDIR":     true,
+}
+
+// Instruction is one logical Dockerfile instruction with continuations joined.
+type Instruction struct {
+	Line  int               // line of the keyword (1-based)
+	Cmd   string            // upper-case keyword, e.g. "COPY"
+	Flags map[string]string // leading --name=value flags, e.g. "from"
+	Args  []string          // arguments after the flags
+	JSON  bool              // Args came from the exec (JSON array) form
+	Raw   string            // everything after the keyword
+}
+
+// KeyValue is one assignment of an ARG, ENV or LABEL instruction.
+type KeyValue struct {
+	Key      string
+	Value    string
+	HasValue bool
+}
+
+// Stage is a build stage: a FROM instruction and everything up to the next one.
+type Stage struct {
+	Index        int
+	Name         string // lower-cased AS name, empty when unnamed
+	Base         string // image or stage the stage starts from
+	Line         int
+	Instructions []Instruction // excluding the FROM itself
+}
+
+// File is a parsed Dockerfile.
+type File struct {
+	Path         string
+	Instructions []Instruction
+	GlobalArgs   []Instruction // ARGs before the first FROM
+	Stages       []*Stage
+}
+
+// FinalStage returns the stage that produces the image, or nil if the file
+// has no FROM.
+func (f *File) FinalStage() *Stage {
+	if len(f.Stages) == 0 {
+		return nil
+	}
+	return f.Stages[len(f.Stages)-1]
+}
+
+// Stage looks up a stage by AS name or index, as COPY --from does.
+func (f *File) Stage(ref string) *Stage {
+	if i, err := strconv.Atoi(ref); err == nil {
+		if i >= 0 && i < len(f.Stages) {
+			return f.Stages[i]
+		}
+		return nil
+	}
+	ref = strings.ToLower(ref)
+	for _, s := range f.Stages {
+		if s.Name == ref {
+			return s
+		}
+	}
+	return nil
+}
+
+// ParseFile reads and parses the Dockerfile at path.
+func ParseFile(path string) (*File, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	f, err := Parse(fh)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	f.Path = path
+	return f, nil
+}
+
+// Parse parses a Dockerfile from r.
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+	escape := `\`
+	directives := true
+
+	var (
+		buf   strings.Builder
+		start int
+		n     int
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if buf.Len() == 0 {
+			if trimmed == "" {
+				directives = false
+				continue
+			}
+			if strings.HasPrefix(trimmed, "#") {
+				// Parser directives are only honoured before anything else
+				if directives {
+					if v, ok := directive(trimmed, "escape"); ok {
+						if v != `\` && v != "`" {
+							return nil, fmt.Errorf("line %d: invalid escape directive %q", n, v)
+						}
+						escape = v
+					}
+				}
+				continue
+			}
+			directives = false
+			start = n
+		} else if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			// Comments and blank lines inside a continuation are dropped
+			continue
+		}
+
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if strings.HasSuffix(line, escape) {
+			buf.WriteString(strings.TrimSuffix(line, escape))
+			buf.WriteString(" ")
+			continue
+		}
+		buf.WriteString(line)
+		if err := f.add(start, buf.String()); err != nil {
+			return nil, err
+		}
+		buf.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if buf.Len() > 0 {
+		if err := f.add(start, buf.String()); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func directive(comment, name string) (string, bool) {
+	k, v, ok := strings.Cut(strings.TrimSpace(strings.TrimPrefix(comment, "#")), "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(k), name) {
+		return "", false
+	}
+	return strings.TrimSpace(v), true
+}
+
+// add parses one logical line and attaches it to the current stage.
+func (f *File) add(line int, text string) error {
+	text = strings.TrimSpace(text)
+	keyword, rest, _ := strings.Cut(text, " ")
+	inst := Instruction{
+		Line:  line,
+		Cmd:   strings.ToUpper(keyword),
+		Flags: map[string]string{},
+		Raw:   strings.TrimSpace(rest),
+	}
+
+	rest = inst.Raw
+	for strings.HasPrefix(rest, "--") {
+		flag, tail, _ := strings.Cut(rest, " ")
+		name, value, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		inst.Flags[strings.ToLower(name)] = value
+		rest = strings.TrimSpace(tail)
+	}
+
+	if strings.HasPrefix(rest, "[") {
+		var args []string
+		if err := json.Unmarshal([]byte(rest), &args); err == nil {
+			inst.Args = args
+			inst.JSON = true
+		}
+	}
+	if !inst.JSON {
+		inst.Args = strings.Fields(rest)
+	}
+
+	f.Instructions = append(f.Instructions, inst)
+
+	if inst.Cmd == "FROM" {
+		if len(inst.Args) == 0 {
+			return fmt.Errorf("line %d: FROM requires an image", line)
+		}
+		stage := &Stage{Index: len(f.Stages), Base: inst.Args[0], Line: line}
+		if len(inst.Args) >= 3 && strings.EqualFold(inst.Args[1], "AS") {
+			stage.Name = strings.ToLower(inst.Args[2])
+		}
+		f.Stages = append(f.Stages, stage)
+		return nil
+	}
+
+	if len(f.Stages) == 0 {
+		if inst.Cmd == "ARG" {
+			f.GlobalArgs = append(f.GlobalArgs, inst)
+		}
+		return nil
+	}
+	stage := f.Stages[len(f.Stages)-1]
+	stage.Instructions = append(stage.Instructions, inst)
+	return nil
+}
+
+// KeyValues splits an ARG, ENV or LABEL instruction into its assignments.
+// Quotes are removed from values. The legacy "ENV KEY value" form yields a
+// single assignment.
+func (i Instruction) KeyValues() []KeyValue {
+	words := splitWords(i.Raw)
+	if len(words) == 0 {
+		return nil
+	}
+
+	if i.Cmd != "ARG" && !strings.Contains(words[0], "=") {
+		key, value, _ := strings.Cut(i.Raw, " ")
+		return []KeyValue{{Key: key, Value: unquote(strings.TrimSpace(value)), HasValue: true}}
+	}
+
+	kvs := make([]KeyValue, 0, len(words))
+	for _, w := range words {
+		key, value, ok := strings.Cut(w, "=")
+		kvs = append(kvs, KeyValue{Key: unquote(key), Value: unquote(value), HasValue: ok})
+	}
+	return kvs
+}
+
+// splitWords splits s on unquoted whitespace, keeping quotes in the words.
+func splitWords(s string) []string {
+	var (
+		words []string
+		word  strings.Builder
+		quote rune
+		esc   bool
+	)
+	for _, r := range s {
+		switch {
+		case esc:
+			esc = false
+		case r == '\\' && quote != '\'':
+			esc = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case unicode.IsSpace(r):
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+			continue
+		}
+		word.WriteRune(r)
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// unquote removes double and single quotes and backslash escapes from s.
+func unquote(s string) string {
+	var (
+		out   strings.Builder
+		quote rune
+		esc   bool
+	)
+	for _, r := range s {
+		switch {
+		case esc:
+			esc = false
+		case r == '\\' && quote != '\'':
+			esc = true
+			continue
+		case quote != 0 && r == quote:
+			quote = 0
+			continue
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+			continue
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// References returns the names of the variables referenced as $NAME or
+// ${NAME...} in s, in order of first use.
+func References(s string) []string {
+	var refs []string
+	seen := map[string]bool{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			continue
+		}
+		j := i + 1
+		if s[j] == '{' {
+			j++
+		}
+		k := j
+		for k < len(s) && (s[k] == '_' || unicode.IsLetter(rune(s[k])) || (k > j && unicode.IsDigit(rune(s[k])))) {
+			k++
+		}
+		if name := s[j:k]; name != "" && !seen[name] {
+			seen[name] = true
+			refs = append(refs, name)
+		}
+		i = k - 1
+	}
+	return refs
+}
@@ -0,0 +1,111 @@
+package dockerfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(`# escape=\
+ARG UBUNTU_VERSION=22.04
+FROM ubuntu:${UBUNTU_VERSION} AS Build
+# comment
+RUN apt-get update \
+    # dropped inside the continuation
+    && apt-get install -y curl
+
+FROM scratch
+COPY --from=build --chown=1001:1001 /out /app
+CMD ["/app/run", "--flag"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.GlobalArgs) != 1 || f.GlobalArgs[0].Raw != "UBUNTU_VERSION=22.04" {
+		t.Fatalf("GlobalArgs = %+v", f.GlobalArgs)
+	}
+	if len(f.Stages) != 2 {
+		t.Fatalf("got %d stages, want 2", len(f.Stages))
+	}
+	build := f.Stage("build")
+	if build == nil || build.Index != 0 || build.Base != "ubuntu:${UBUNTU_VERSION}" || build.Line != 3 {
+		t.Fatalf("Stage(build) = %+v", build)
+	}
+	if f.Stage("0") != build || f.Stage("2") != nil || f.Stage("nope") != nil {
+		t.Fatal("Stage by index or unknown name")
+	}
+
+	run := build.Instructions[0]
+	if run.Cmd != "RUN" || run.Line != 5 || !strings.Contains(run.Raw, "&& apt-get install -y curl") || strings.Contains(run.Raw, "dropped") {
+		t.Fatalf("RUN = %+v", run)
+	}
+
+	final := f.FinalStage()
+	copyInst, cmd := final.Instructions[0], final.Instructions[1]
+	if want := map[string]string{"from": "build", "chown": "1001:1001"}; !reflect.DeepEqual(copyInst.Flags, want) {
+		t.Fatalf("COPY flags = %v, want %v", copyInst.Flags, want)
+	}
+	if want := []string{"/out", "/app"}; !reflect.DeepEqual(copyInst.Args, want) || copyInst.JSON {
+		t.Fatalf("COPY args = %q (JSON %v), want %q", copyInst.Args, copyInst.JSON, want)
+	}
+	if want := []string{"/app/run", "--flag"}; !reflect.DeepEqual(cmd.Args, want) || !cmd.JSON {
+		t.Fatalf("CMD args = %q (JSON %v), want %q in exec form", cmd.Args, cmd.JSON, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, content string
+	}{
+		{"invalid escape", "# escape=x\nFROM scratch\n"},
+		{"FROM without image", "FROM\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.content)); err == nil {
+				t.Fatal("Parse succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestKeyValues(t *testing.T) {
+	tests := []struct {
+		line string
+		want []KeyValue
+	}{
+		{"ARG GO_VERSION", []KeyValue{{Key: "GO_VERSION"}}},
+		{"ARG GO_VERSION=1.22.7 NODE_VERSION=20", []KeyValue{{"GO_VERSION", "1.22.7", true}, {"NODE_VERSION", "20", true}}},
+		{`ENV PATH="/opt/go/bin:$PATH" LANG=C.UTF-8`, []KeyValue{{"PATH", "/opt/go/bin:$PATH", true}, {"LANG", "C.UTF-8", true}}},
+		{"ENV JAVA_HOME /usr/lib/jvm/default java", []KeyValue{{"JAVA_HOME", "/usr/lib/jvm/default java", true}}},
+		{`LABEL description="Go runner" org.opencontainers.image.go.version='1.22'`, []KeyValue{{"description", "Go runner", true}, {"org.opencontainers.image.go.version", "1.22", true}}},
+		{`LABEL escaped="a \"quoted\" word"`, []KeyValue{{"escaped", `a "quoted" word`, true}}},
+	}
+	for _, tt := range tests {
+		f, err := Parse(strings.NewReader("FROM scratch\n" + tt.line + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.FinalStage().Instructions[0].KeyValues(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: KeyValues = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"curl https://go.dev/dl/go${GO_VERSION}.tar.gz", []string{"GO_VERSION"}},
+		{"$A_1 ${B:-x} $A_1 ${C}", []string{"A_1", "B", "C"}},
+		{"echo $$ $1 costs $", nil},
+	}
+	for _, tt := range tests {
+		if got := References(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("References(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Package dockerlint checks the runner Dockerfiles against the rules of the
+// base / language pack / composite layout: every composite copies from pack
+// images built first, every image hands control back to the runner user, and
+// toolchain versions agree between ARGs, ENVs and labels.
+package dockerlint
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/subhead/github-runners/tools/internal/dockerfile"
+)
+
+// ImagePrefix is the repository every locally built runner image is tagged into.
+const ImagePrefix = "gh-runner:"
+
+// BaseImage is the tag of the image built from docker/linux/base.
+const BaseImage = "linux-base"
+
+// Severity of a finding.
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Finding is one rule violation.
+type Finding struct {
+	Path     string
+	Line     int
+	Rule     string
+	Severity Severity
+	Message  string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s [%s]", f.Path, f.Line, f.Severity, f.Message, f.Rule)
+}
+
+// Rule checks one Dockerfile; the Linter gives it access to the whole tree.
+type Rule struct {
+	Name  string
+	Doc   string
+	Check func(l *Linter, f *dockerfile.File) []Finding
+}
+
+// Rules lists every rule in the order findings are reported.
+var Rules = []Rule{
+	{"instruction", "instructions are known keywords and COPY/ADD arguments contain no shell syntax", checkInstructions},
+	{"image-ref", "FROM and COPY --from name a stage, an external image or a gh-runner pack target", checkImageRefs},
+	{"user", "the final stage ends as USER runner", checkUser},
+	{"apt-lists", "RUN instructions using apt-get remove /var/lib/apt/lists", checkAptLists},
+	{"version-args", "*_VERSION(S) ARG and ENV values agree across files and declared ARGs are used", checkVersionArgs},
+	{"label-version", "org.opencontainers.image.<tool>.version labels match the ARG values", checkLabels},
+}
+
+// versionDef is one place a *_VERSION(S) variable gets a literal value.
+type versionDef struct {
+	path  string
+	line  int
+	value string
+}
+
+// Linter holds every Dockerfile under a directory so rules can check
+// references between files.
+type Linter struct {
+	Root  string
+	Files []*dockerfile.File
+
+	images   map[string]*dockerfile.File // gh-runner tag -> Dockerfile
+	versions map[string][]versionDef     // ARG name -> defaults, in path order
+}
+
+// Load parses every Dockerfile* under dir. Paths in findings are relative to root.
+func Load(root, dir string) (*Linter, error) {
+	l := &Linter{
+		Root:     root,
+		images:   map[string]*dockerfile.File{},
+		versions: map[string][]versionDef{},
+	}
+
+	err := filepath.WalkDir(filepath.Join(root, dir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasPrefix(d.Name(), "Dockerfile") {
+			return nil
+		}
+		f, err := dockerfile.ParseFile(path)
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(root, path); err == nil {
+			f.Path = filepath.ToSlash(rel)
+		}
+		l.Files = append(l.Files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(l.Files, func(i, j int) bool { return l.Files[i].Path < l.Files[j].Path })
+
+	for _, f := range l.Files {
+		l.index(f)
+	}
+	return l, nil
+}
+
+// index records the images a file provides and the version defaults it sets.
+func (l *Linter) index(f *dockerfile.File) {
+	switch {
+	case strings.Contains(f.Path, "/base/"):
+		l.images[BaseImage] = f
+	case strings.Contains(f.Path, "/language-packs/"):
+		if s := f.FinalStage(); s != nil && s.Name != "" {
+			l.images[s.Name] = f
+		}
+	}
+
+	for _, inst := range f.Instructions {
+		if inst.Cmd != "ARG" {
+			continue
+		}
+		for _, kv := range inst.KeyValues() {
+			if isVersionVar(kv.Key) && kv.HasValue {
+				l.versions[kv.Key] = append(l.versions[kv.Key], versionDef{f.Path, inst.Line, kv.Value})
+			}
+		}
+	}
+}
+
+// Run applies every rule to every file.
+func (l *Linter) Run() []Finding {
+	var findings []Finding
+	for _, f := range l.Files {
+		for _, r := range Rules {
+			for _, finding := range r.Check(l, f) {
+				finding.Path = f.Path
+				finding.Rule = r.Name
+				findings = append(findings, finding)
+			}
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Path != findings[j].Path {
+			return findings[i].Path < findings[j].Path
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings
+}
+
+// Image returns the Dockerfile that builds gh-runner:<tag>, or nil.
+func (l *Linter) Image(tag string) *dockerfile.File {
+	return l.images[tag]
+}
+
+// File returns the parsed Dockerfile at path (relative to Root), or nil.
+func (l *Linter) File(path string) *dockerfile.File {
+	for _, f := range l.Files {
+		if f.Path == path {
+			return f
+		}
+	}
+	return nil
+}
+
+// Requires returns the gh-runner image tags f builds on, through FROM or
+// COPY --from, in order of first use.
+func (l *Linter) Requires(f *dockerfile.File) []string {
+	var tags []string
+	seen := map[string]bool{}
+	add := func(ref string) {
+		if tag, ok := strings.CutPrefix(ref, ImagePrefix); ok && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	for _, stage := range f.Stages {
+		add(stage.Base)
+		for _, inst := range stage.Instructions {
+			if inst.Cmd == "COPY" {
+				add(inst.Flags["from"])
+			}
+		}
+	}
+	return tags
+}
+
+// canonicalVersion returns the value most files give a version ARG, preferring
+// the earliest definition on ties.
+func (l *Linter) canonicalVersion(name string) (versionDef, bool) {
+	defs := l.versions[name]
+	if len(defs) == 0 {
+		return versionDef{}, false
+	}
+	counts := map[string]int{}
+	best := defs[0]
+	for _, d := range defs {
+		counts[d.value]++
+		if counts[d.value] > counts[best.value] {
+			best = d
+		}
+	}
+	for _, d := range defs {
+		if d.value == best.value {
+			return d, true
+		}
+	}
+	return best, true
+}
+
+// inheritedEnv returns the ENV names a stage inherits from gh-runner parent images.
+func (l *Linter) inheritedEnv(base string, seen map[string]bool) map[string]bool {
+	env := map[string]bool{}
+	tag, ok := strings.CutPrefix(base, ImagePrefix)
+	if !ok || seen[tag] {
+		return env
+	}
+	seen[tag] = true
+
+	f := l.images[tag]
+	if f == nil || f.FinalStage() == nil {
+		return env
+	}
+	final := f.FinalStage()
+	for name := range l.inheritedEnv(final.Base, seen) {
+		env[name] = true
+	}
+	for _, inst := range final.Instructions {
+		if inst.Cmd == "ENV" {
+			for _, kv := range inst.KeyValues() {
+				env[kv.Key] = true
+			}
+		}
+	}
+	return env
+}
+
+// isVersionVar reports whether name holds a version, or a space-separated
+// list of them (GO_CACHE_VERSIONS).
+func isVersionVar(name string) bool {
+	return strings.HasSuffix(name, "_VERSION") || strings.HasSuffix(name, "_VERSIONS")
+}
+
+func errorf(line int, format string, args ...any) Finding {
+	return Finding{Line: line, Severity: Error, Message: fmt.Sprintf(format, args...)}
+}
+
+func warnf(line int, format string, args ...any) Finding {
+	return Finding{Line: line, Severity: Warning, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,144 @@
+package dockerlint
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// tree is a minimal base / language pack layout the composites under test
+// build on. Two packs set GO_VERSION, so the tree agrees on 1.22.7.
+var tree = map[string]string{
+	"docker/linux/base/Dockerfile": `FROM ubuntu:22.04
+RUN apt-get update && apt-get install -y curl && rm -rf /var/lib/apt/lists/*
+USER runner
+`,
+	"docker/linux/language-packs/go/Dockerfile.go": `FROM gh-runner:linux-base AS go-pack
+ARG GO_VERSION=1.22.7
+ENV GO_VERSION=${GO_VERSION}
+RUN curl -fsSL https://go.dev/dl/go${GO_VERSION}.linux-amd64.tar.gz | tar -C /usr/local -xz
+LABEL org.opencontainers.image.go.version="${GO_VERSION}"
+`,
+	"docker/linux/language-packs/web/Dockerfile.web": `FROM gh-runner:linux-base AS web-pack
+ARG GO_VERSION=1.22.7
+RUN curl -fsSL https://go.dev/dl/go${GO_VERSION}.linux-amd64.tar.gz | tar -C /usr/local -xz
+`,
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		composite string
+		want      []string // rule of each finding, in order
+	}{
+		{name: "clean", composite: `FROM gh-runner:linux-base
+COPY --from=gh-runner:go-pack /usr/local/go /usr/local/go
+`},
+		{name: "unknown pack", composite: `FROM gh-runner:linux-base
+COPY --from=gh-runner:rust-pack /usr/local/cargo /usr/local/cargo
+`, want: []string{"image-ref"}},
+		{name: "stage defined later", composite: `FROM gh-runner:linux-base
+COPY --from=tools /bin/x /bin/x
+FROM gh-runner:linux-base AS tools
+`, want: []string{"image-ref"}},
+		{name: "shell syntax in COPY", composite: `FROM gh-runner:linux-base
+COPY /etc/optional /etc/optional 2>/dev/null || true
+`, want: []string{"instruction"}},
+		{name: "ends as root", composite: `FROM gh-runner:linux-base
+USER root
+RUN true
+`, want: []string{"user"}},
+		{name: "no USER on an external base", composite: `FROM ubuntu:22.04
+RUN true
+`, want: []string{"user"}},
+		{name: "apt lists left behind", composite: `FROM gh-runner:linux-base
+USER root
+RUN apt-get update && apt-get install -y jq
+USER runner
+`, want: []string{"apt-lists"}},
+		{name: "apt cache mount", composite: `FROM gh-runner:linux-base
+USER root
+RUN --mount=type=cache,target=/var/lib/apt apt-get update && apt-get install -y jq
+USER runner
+`},
+		{name: "version disagrees", composite: `FROM gh-runner:linux-base
+ARG GO_VERSION=1.21.0
+RUN echo ${GO_VERSION}
+`, want: []string{"version-args"}},
+		{name: "global ARG not redeclared", composite: `ARG NODE_VERSION=20
+FROM gh-runner:linux-base
+RUN echo ${NODE_VERSION}
+`, want: []string{"version-args"}},
+		{name: "unused version ARG", composite: `FROM gh-runner:linux-base
+ARG NODE_VERSION=20
+`, want: []string{"version-args"}},
+		{name: "inherited ENV", composite: `FROM gh-runner:go-pack
+RUN echo ${GO_VERSION}
+`},
+		{name: "label disagrees", composite: `FROM gh-runner:linux-base
+LABEL org.opencontainers.image.go.version="1.21"
+`, want: []string{"label-version"}},
+		{name: "label wildcard", composite: `FROM gh-runner:linux-base
+LABEL org.opencontainers.image.go.version="1.x"
+`},
+		{name: "label hard-codes the ARG", composite: `FROM gh-runner:linux-base
+ARG GO_VERSION=1.22.7
+RUN echo ${GO_VERSION}
+LABEL org.opencontainers.image.go.version="1.22.7"
+`, want: []string{"label-version"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			files := map[string]string{"docker/linux/composite/Dockerfile.test": tt.composite}
+			for path, content := range tree {
+				files[path] = content
+			}
+			for path, content := range files {
+				path = filepath.Join(root, path)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			l, err := Load(root, "docker")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range l.Run() {
+				if f.Path != "docker/linux/composite/Dockerfile.test" {
+					t.Errorf("finding in the fixture tree: %s", f)
+					continue
+				}
+				got = append(got, f.Rule)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("findings %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionMatches(t *testing.T) {
+	tests := []struct {
+		label, version string
+		want           bool
+	}{
+		{"1.22.7", "1.22.7", true},
+		{"1.x", "1.22.7", true},
+		{"1.22.x", "1.22.7", true},
+		{"1.2.x", "1.22.7", false},
+		{"2.x", "1.22.7", false},
+		{"1.22", "1.22.7", false},
+	}
+	for _, tt := range tests {
+		if got := versionMatches(tt.label, tt.version); got != tt.want {
+			t.Errorf("versionMatches(%q, %q) = %v, want %v", tt.label, tt.version, got, tt.want)
+		}
+	}
+}
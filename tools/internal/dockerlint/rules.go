@@ -0,0 +1,322 @@
+package dockerlint
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/subhead/github-runners/tools/internal/dockerfile"
+)
+
+// runnerUsers are the USER values that hand the image back to the runner account.
+var runnerUsers = map[string]bool{
+	"runner":        true,
+	"runner:runner": true,
+	"1001":          true,
+	"1001:1001":     true,
+}
+
+// shellTokens never belong in COPY/ADD arguments; they show up when a RUN
+// idiom such as "2>/dev/null || true" is pasted onto a COPY line.
+var shellTokens = []string{"||", "&&", "|", ";", ">", ">>", "<"}
+
+func isShellToken(arg string) bool {
+	for _, t := range shellTokens {
+		if arg == t {
+			return true
+		}
+	}
+	return strings.HasPrefix(arg, "2>") || strings.HasPrefix(arg, "1>") || strings.HasPrefix(arg, ">")
+}
+
+func checkInstructions(_ *Linter, f *dockerfile.File) []Finding {
+	var findings []Finding
+	for _, inst := range f.Instructions {
+		if !dockerfile.Instructions[inst.Cmd] {
+			findings = append(findings, errorf(inst.Line, "unknown instruction %s", inst.Cmd))
+			continue
+		}
+
+		switch inst.Cmd {
+		case "COPY", "ADD":
+			if len(inst.Args) < 2 {
+				findings = append(findings, errorf(inst.Line, "%s needs at least one source and a destination", inst.Cmd))
+				continue
+			}
+			for _, arg := range inst.Args {
+				if isShellToken(arg) {
+					findings = append(findings, errorf(inst.Line,
+						"%s does not run a shell; %q would be treated as a path (drop the shell redirection/fallback)", inst.Cmd, arg))
+					break
+				}
+			}
+		case "MAINTAINER":
+			findings = append(findings, warnf(inst.Line, "MAINTAINER is deprecated; use LABEL org.opencontainers.image.authors"))
+		}
+	}
+	return findings
+}
+
+func checkImageRefs(l *Linter, f *dockerfile.File) []Finding {
+	var findings []Finding
+	for _, stage := range f.Stages {
+		if err := l.checkImageRef(f, stage, stage.Base); err != "" {
+			findings = append(findings, errorf(stage.Line, "FROM %s: %s", stage.Base, err))
+		}
+
+		for _, inst := range stage.Instructions {
+			from, ok := inst.Flags["from"]
+			if inst.Cmd != "COPY" || !ok {
+				continue
+			}
+			if err := l.checkImageRef(f, stage, from); err != "" {
+				findings = append(findings, errorf(inst.Line, "COPY --from=%s: %s", from, err))
+			}
+		}
+	}
+	return findings
+}
+
+// checkImageRef returns why ref cannot be used from stage, or "" if it can.
+func (l *Linter) checkImageRef(f *dockerfile.File, stage *dockerfile.Stage, ref string) string {
+	if strings.Contains(ref, "$") || strings.EqualFold(ref, "scratch") {
+		return ""
+	}
+	if s := f.Stage(ref); s != nil {
+		if s.Index >= stage.Index {
+			return "stage is defined later in the file"
+		}
+		return ""
+	}
+
+	tag, ok := strings.CutPrefix(ref, ImagePrefix)
+	if !ok {
+		// External image such as ubuntu:22.04
+		return ""
+	}
+	if l.images[tag] != nil {
+		return ""
+	}
+
+	known := make([]string, 0, len(l.images))
+	for t := range l.images {
+		known = append(known, t)
+	}
+	sort.Strings(known)
+	return "no language pack builds this image (known: " + strings.Join(known, ", ") + ")"
+}
+
+func checkUser(_ *Linter, f *dockerfile.File) []Finding {
+	final := f.FinalStage()
+	if final == nil {
+		return nil
+	}
+
+	var last *dockerfile.Instruction
+	for i := range final.Instructions {
+		if final.Instructions[i].Cmd == "USER" {
+			last = &final.Instructions[i]
+		}
+	}
+
+	if last == nil {
+		if strings.HasPrefix(final.Base, ImagePrefix) || f.Stage(final.Base) != nil {
+			// Inherits the runner user from the parent
+			return nil
+		}
+		return []Finding{errorf(final.Line, "final stage never sets USER runner, so jobs would run as root")}
+	}
+
+	user := ""
+	if len(last.Args) > 0 {
+		user = last.Args[0]
+	}
+	if !runnerUsers[user] {
+		return []Finding{errorf(last.Line, "image ends as USER %s; switch back to USER runner after privileged steps", user)}
+	}
+	return nil
+}
+
+func checkAptLists(_ *Linter, f *dockerfile.File) []Finding {
+	var findings []Finding
+	for _, inst := range f.Instructions {
+		if inst.Cmd != "RUN" || !usesApt(inst.Raw) {
+			continue
+		}
+		if strings.Contains(inst.Flags["mount"], "/var/lib/apt") {
+			// Cache mounts never end up in the image
+			continue
+		}
+		if !strings.Contains(inst.Raw, "rm -rf /var/lib/apt/lists") {
+			findings = append(findings, errorf(inst.Line,
+				"apt-get leaves package lists in the layer; end the RUN with && rm -rf /var/lib/apt/lists/*"))
+		}
+	}
+	return findings
+}
+
+func usesApt(script string) bool {
+	for _, cmd := range []string{"apt-get update", "apt-get install", "apt update", "apt install"} {
+		if strings.Contains(script, cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkVersionArgs(l *Linter, f *dockerfile.File) []Finding {
+	var findings []Finding
+
+	// Literal values must agree with the rest of the tree
+	for _, inst := range f.Instructions {
+		if inst.Cmd != "ARG" && inst.Cmd != "ENV" {
+			continue
+		}
+		for _, kv := range inst.KeyValues() {
+			if !isVersionVar(kv.Key) || !kv.HasValue || strings.Contains(kv.Value, "$") {
+				continue
+			}
+			want, ok := l.canonicalVersion(kv.Key)
+			if !ok || kv.Value == want.value {
+				continue
+			}
+			findings = append(findings, errorf(inst.Line, "%s %s=%s disagrees with %s:%d, which sets %s",
+				inst.Cmd, kv.Key, kv.Value, want.path, want.line, want.value))
+		}
+	}
+
+	global := map[string]bool{}
+	for _, inst := range f.GlobalArgs {
+		for _, kv := range inst.KeyValues() {
+			global[kv.Key] = true
+		}
+	}
+
+	for _, stage := range f.Stages {
+		inScope := l.inheritedEnv(stage.Base, map[string]bool{})
+		declared := map[string]int{}
+		used := map[string]bool{}
+
+		for _, inst := range stage.Instructions {
+			for _, ref := range dockerfile.References(inst.Raw) {
+				if !isVersionVar(ref) {
+					continue
+				}
+				used[ref] = true
+				// Labels are checked by the label-version rule
+				if inScope[ref] || inst.Cmd == "LABEL" {
+					continue
+				}
+				if global[ref] {
+					findings = append(findings, errorf(inst.Line,
+						"${%s} is declared before FROM but not redeclared in this stage, so it is empty here; add ARG %s", ref, ref))
+				} else {
+					findings = append(findings, errorf(inst.Line, "${%s} is not declared in this stage", ref))
+				}
+				inScope[ref] = true
+			}
+
+			if inst.Cmd != "ARG" && inst.Cmd != "ENV" {
+				continue
+			}
+			for _, kv := range inst.KeyValues() {
+				inScope[kv.Key] = true
+				if inst.Cmd == "ARG" && isVersionVar(kv.Key) {
+					declared[kv.Key] = inst.Line
+				}
+			}
+		}
+
+		for name, line := range declared {
+			if !used[name] {
+				findings = append(findings, warnf(line, "ARG %s is declared but never used", name))
+			}
+		}
+	}
+	return findings
+}
+
+func checkLabels(l *Linter, f *dockerfile.File) []Finding {
+	var findings []Finding
+
+	globalDefaults := map[string]string{}
+	for _, inst := range f.GlobalArgs {
+		for _, kv := range inst.KeyValues() {
+			globalDefaults[kv.Key] = kv.Value
+		}
+	}
+
+	for _, stage := range f.Stages {
+		inScope := l.inheritedEnv(stage.Base, map[string]bool{})
+		args := map[string]string{}
+
+		for _, inst := range stage.Instructions {
+			switch inst.Cmd {
+			case "ARG":
+				for _, kv := range inst.KeyValues() {
+					inScope[kv.Key] = true
+					if kv.HasValue {
+						args[kv.Key] = kv.Value
+					} else if v, ok := globalDefaults[kv.Key]; ok {
+						args[kv.Key] = v
+					}
+				}
+			case "ENV":
+				for _, kv := range inst.KeyValues() {
+					inScope[kv.Key] = true
+				}
+			case "LABEL":
+				for _, kv := range inst.KeyValues() {
+					findings = append(findings, l.checkLabel(inst.Line, kv, inScope, args)...)
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// checkLabel checks one org.opencontainers.image.<tool>.version label.
+func (l *Linter) checkLabel(line int, kv dockerfile.KeyValue, inScope map[string]bool, args map[string]string) []Finding {
+	tool, ok := strings.CutPrefix(kv.Key, "org.opencontainers.image.")
+	if !ok {
+		return nil
+	}
+	tool, ok = strings.CutSuffix(tool, ".version")
+	if !ok || tool == "" {
+		return nil
+	}
+
+	if refs := dockerfile.References(kv.Value); len(refs) > 0 {
+		var findings []Finding
+		for _, ref := range refs {
+			if !inScope[ref] {
+				findings = append(findings, errorf(line, "label %s uses ${%s}, which is not set in this stage", kv.Key, ref))
+			}
+		}
+		return findings
+	}
+
+	arg := strings.ToUpper(strings.ReplaceAll(tool, "-", "_")) + "_VERSION"
+	if want, ok := args[arg]; ok {
+		if !versionMatches(kv.Value, want) {
+			return []Finding{errorf(line, "label %s=%q but ARG %s=%s; use ${%s}", kv.Key, kv.Value, arg, want, arg)}
+		}
+		return []Finding{warnf(line, "label %s hard-codes %q; use ${%s} so it follows the ARG", kv.Key, kv.Value, arg)}
+	}
+
+	if want, ok := l.canonicalVersion(arg); ok && !versionMatches(kv.Value, want.value) {
+		return []Finding{errorf(line, "label %s=%q but %s:%d builds %s=%s", kv.Key, kv.Value, want.path, want.line, arg, want.value)}
+	}
+	return nil
+}
+
+// versionMatches reports whether a label value describes version; "3.x"
+// matches any 3.* version.
+func versionMatches(label, version string) bool {
+	if label == version {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(label, "x"); ok && strings.HasSuffix(prefix, ".") {
+		return strings.HasPrefix(version+".", prefix)
+	}
+	return false
+}
@@ -0,0 +1,657 @@
+package dockerproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxBody caps the request bodies the proxy reads to check or rewrite.
+const maxBody = 4 << 20
+
+// maxDepth caps the nesting of request bodies; Docker's own are a few levels deep.
+const maxDepth = 64
+
+// Host namespaces and security options that give a container the host, or
+// enough of it to escape, and the capabilities containers may add: Docker's
+// default set, which they may drop and add back, but nothing beyond it.
+var (
+	hostModes       = []string{"host"}
+	allowedCaps     = []string{"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD", "NET_BIND_SERVICE", "NET_RAW", "SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT"}
+	deniedSecOpts   = []string{"apparmor=unconfined", "apparmor:unconfined", "seccomp=unconfined", "seccomp:unconfined", "label=disable", "label:disable", "systempaths=unconfined"}
+	builtinNetworks = []string{"", "default", "bridge", "none"}
+	bridgeNetworks  = []string{"", "default", "bridge"} // the daemon's default bridge, which routes straight out
+)
+
+type mount struct {
+	Type          string
+	Source        string
+	VolumeOptions struct {
+		DriverConfig struct {
+			Options map[string]string
+		}
+	}
+}
+
+// containerConfig is the part of POST /containers/create the policy checks.
+type containerConfig struct {
+	HostConfig struct {
+		Privileged        bool
+		NetworkMode       string
+		PidMode           string
+		IpcMode           string
+		UTSMode           string
+		UsernsMode        string
+		CgroupnsMode      string
+		CapAdd            []string
+		SecurityOpt       []string
+		Devices           []json.RawMessage
+		DeviceCgroupRules []string
+		Binds             []string
+		Mounts            []mount
+		VolumesFrom       []string
+	}
+	NetworkingConfig struct {
+		EndpointsConfig map[string]json.RawMessage
+	}
+}
+
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxBody {
+		return nil, deny("request body larger than %d bytes", maxBody)
+	}
+	if err := checkKeys(body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// checkKeys refuses bodies with a key twice in one object, also when the
+// spellings only differ in case. Go's encoding/json, in the proxy and in the
+// daemon, matches keys to fields case-insensitively, and the two may pick
+// different duplicates: the check would see {"Privileged":false} where the
+// daemon sees {"privileged":true}.
+func checkKeys(body []byte) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := checkValue(dec, 0); err != nil {
+		var denied deniedError
+		if errors.As(err, &denied) {
+			return err
+		}
+		return deny("invalid request body: %v", err)
+	}
+	return nil
+}
+
+func checkValue(dec *json.Decoder, depth int) error {
+	if depth > maxDepth {
+		return deny("request body nested deeper than %d levels", maxDepth)
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		seen := map[string]string{}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := tok.(string)
+			if prev, ok := seen[foldKey(key)]; ok {
+				return deny("request body has both %q and %q in one object", prev, key)
+			}
+			seen[foldKey(key)] = key
+			if err := checkValue(dec, depth+1); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		for dec.More() {
+			if err := checkValue(dec, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+	_, err = dec.Token() // the closing '}' or ']'
+	return err
+}
+
+// foldKey maps every rune of key to the smallest rune it case-folds with, so
+// keys encoding/json treats as the same field ("SecurityOpt", "securityopt",
+// "\u017fecurityOpt") fold to the same string.
+func foldKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		smallest := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			smallest = min(smallest, f)
+		}
+		return smallest
+	}, key)
+}
+
+// member returns the value of the key in obj that encoding/json matches to
+// name, and that key; name itself if obj has none.
+func member(obj map[string]any, name string) (any, string) {
+	for key, value := range obj {
+		if foldKey(key) == foldKey(name) {
+			return value, key
+		}
+	}
+	return nil, name
+}
+
+// object returns the object under name in obj, adding an empty one if there
+// is none.
+func object(obj map[string]any, name string) map[string]any {
+	value, key := member(obj, name)
+	child, ok := value.(map[string]any)
+	if !ok {
+		child = map[string]any{}
+		obj[key] = child
+	}
+	return child
+}
+
+func setBody(r *http.Request, body []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
+// decodeObject decodes a JSON object keeping numbers exactly as sent.
+func decodeObject(body []byte) (map[string]any, error) {
+	obj := map[string]any{}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return obj, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return nil, deny("invalid request body: %v", err)
+	}
+	return obj, nil
+}
+
+// addLabel sets the runner label in obj["Labels"].
+func (p *Proxy) addLabel(obj map[string]any) {
+	labels, _ := obj["Labels"].(map[string]any)
+	if labels == nil {
+		labels = map[string]any{}
+	}
+	labels[RunnerLabel] = p.policy.Runner
+	obj["Labels"] = labels
+}
+
+// labels returns the labels of a container, network or volume, or ok=false
+// if it does not exist.
+func (p *Proxy) labels(ctx context.Context, kind, id string) (map[string]string, bool, error) {
+	endpoint := "/" + kind + "/" + url.PathEscape(id)
+	if kind == "containers" || kind == "exec" {
+		endpoint += "/json"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.base+endpoint, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, false, nil
+	case resp.StatusCode >= 300:
+		return nil, false, fmt.Errorf("GET %s: %s", endpoint, resp.Status)
+	}
+
+	var obj struct {
+		Labels      map[string]string
+		ContainerID string
+		Config      struct {
+			Labels map[string]string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return nil, false, err
+	}
+	switch kind {
+	case "containers":
+		return obj.Config.Labels, true, nil
+	case "exec":
+		return map[string]string{"ContainerID": obj.ContainerID}, true, nil
+	}
+	return obj.Labels, true, nil
+}
+
+// requireOwned refuses access to objects another runner (or nobody) created.
+func (p *Proxy) requireOwned(ctx context.Context, kind, id string) error {
+	labels, ok, err := p.labels(ctx, kind, id)
+	if err != nil {
+		return err
+	}
+	singular := strings.TrimSuffix(kind, "s")
+	if !ok {
+		return deny("no such %s %q", singular, id)
+	}
+	if labels[RunnerLabel] != p.policy.Runner {
+		return deny("%s %q was not created by a job on runner %s", singular, id, p.policy.Runner)
+	}
+	return nil
+}
+
+func (p *Proxy) requireOwnedExec(ctx context.Context, id string) error {
+	exec, ok, err := p.labels(ctx, "exec", id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return deny("no such exec instance %q", id)
+	}
+	return p.requireOwned(ctx, "containers", exec["ContainerID"])
+}
+
+// restrictFilters adds the runner label to the filters of a list or prune
+// request, so jobs only see and prune their runner's objects.
+func (p *Proxy) restrictFilters(r *http.Request) error {
+	query := r.URL.Query()
+	filters := map[string]map[string]bool{}
+
+	if raw := query.Get("filters"); raw != "" {
+		var generic map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(raw), &generic); err != nil {
+			return deny("invalid filters: %v", err)
+		}
+		for key, value := range generic {
+			// Both {"label": {"a=b": true}} and {"label": ["a=b"]} are accepted
+			set := map[string]bool{}
+			var list []string
+			if err := json.Unmarshal(value, &list); err == nil {
+				for _, v := range list {
+					set[v] = true
+				}
+			} else if err := json.Unmarshal(value, &set); err != nil {
+				return deny("invalid filter %q: %v", key, err)
+			}
+			filters[key] = set
+		}
+	}
+	if filters["label"] == nil {
+		filters["label"] = map[string]bool{}
+	}
+	filters["label"][RunnerLabel+"="+p.policy.Runner] = true
+
+	encoded, err := json.Marshal(filters)
+	if err != nil {
+		return err
+	}
+	query.Set("filters", string(encoded))
+	r.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// rewriteContainerCreate checks a container config against the policy,
+// points daemon socket binds at the runner's proxy socket and labels it.
+func (p *Proxy) rewriteContainerCreate(r *http.Request) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	var cfg containerConfig
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		return deny("invalid container config: %v", err)
+	}
+	if err := p.checkContainer(r.Context(), cfg); err != nil {
+		return err
+	}
+
+	obj, err := decodeObject(body)
+	if err != nil {
+		return err
+	}
+	p.addLabel(obj)
+	hostConfig, _ := member(obj, "HostConfig")
+	if hostConfig, ok := hostConfig.(map[string]any); ok {
+		p.rewriteSocketBinds(hostConfig)
+	}
+	p.rewriteNetworks(obj)
+
+	rewritten, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	setBody(r, rewritten)
+	return nil
+}
+
+func (p *Proxy) checkContainer(ctx context.Context, cfg containerConfig) error {
+	hc := cfg.HostConfig
+	if hc.Privileged {
+		return deny("privileged containers are not allowed")
+	}
+	for name, mode := range map[string]string{
+		"network": hc.NetworkMode, "pid": hc.PidMode, "ipc": hc.IpcMode,
+		"uts": hc.UTSMode, "userns": hc.UsernsMode, "cgroupns": hc.CgroupnsMode,
+	} {
+		if slices.Contains(hostModes, mode) {
+			return deny("the host %s namespace is not allowed", name)
+		}
+	}
+	// Another container's namespaces only if it is one of the runner's: not
+	// the runner's own container, and not another runner's job container
+	// (the network namespace is checked with the networks below)
+	for _, mode := range []string{hc.PidMode, hc.IpcMode, hc.UTSMode} {
+		if id, ok := strings.CutPrefix(mode, "container:"); ok {
+			if err := p.requireOwned(ctx, "containers", id); err != nil {
+				return err
+			}
+		}
+	}
+	for _, c := range hc.CapAdd {
+		if !slices.Contains(allowedCaps, strings.TrimPrefix(strings.ToUpper(c), "CAP_")) {
+			return deny("capability %s is not allowed", c)
+		}
+	}
+	for _, opt := range hc.SecurityOpt {
+		if slices.Contains(deniedSecOpts, opt) {
+			return deny("security option %s is not allowed", opt)
+		}
+	}
+	if len(hc.Devices) > 0 || len(hc.DeviceCgroupRules) > 0 {
+		return deny("host devices are not allowed")
+	}
+
+	for _, bind := range hc.Binds {
+		// "/host/path:/dst" is a bind, "name:/dst" a named volume
+		source, _, _ := strings.Cut(bind, ":")
+		if err := p.checkMountSource(ctx, "volume", source); err != nil {
+			return err
+		}
+	}
+	for _, m := range hc.Mounts {
+		switch m.Type {
+		case "bind", "volume":
+			if m.VolumeOptions.DriverConfig.Options["device"] != "" {
+				return deny("volume driver options with a device are not allowed")
+			}
+			if err := p.checkMountSource(ctx, m.Type, m.Source); err != nil {
+				return err
+			}
+		case "tmpfs", "":
+		default:
+			return deny("%s mounts are not allowed", m.Type)
+		}
+	}
+
+	for _, from := range hc.VolumesFrom {
+		id, _, _ := strings.Cut(from, ":")
+		if err := p.requireOwned(ctx, "containers", id); err != nil {
+			return err
+		}
+	}
+
+	if err := p.checkNetwork(ctx, hc.NetworkMode); err != nil {
+		return err
+	}
+	for name := range cfg.NetworkingConfig.EndpointsConfig {
+		if err := p.checkNetwork(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMountSource allows host paths under AllowedBinds, the daemon socket
+// (which becomes the proxy socket) and named volumes that are not another
+// runner's.
+func (p *Proxy) checkMountSource(ctx context.Context, kind, source string) error {
+	if kind == "bind" || path.IsAbs(source) {
+		if p.allowedBind(source) {
+			return nil
+		}
+		return deny("bind mount of host path %s is not allowed (allowed: %s)",
+			source, strings.Join(p.policy.AllowedBinds, ", "))
+	}
+	if source == "" {
+		return nil
+	}
+	labels, ok, err := p.labels(ctx, "volumes", source)
+	if err != nil || !ok {
+		return err
+	}
+	if labels[RunnerLabel] != p.policy.Runner {
+		return deny("volume %q was not created by a job on runner %s", source, p.policy.Runner)
+	}
+	return nil
+}
+
+func (p *Proxy) allowedBind(source string) bool {
+	source = path.Clean(source)
+	if p.policy.Socket != "" && slices.Contains(HostSockets, source) {
+		return true
+	}
+	for _, prefix := range p.policy.AllowedBinds {
+		if source == prefix || prefix == "/" || strings.HasPrefix(source, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteSocketBinds replaces binds of the daemon socket with the runner's
+// proxy socket.
+func (p *Proxy) rewriteSocketBinds(hostConfig map[string]any) {
+	if p.policy.Socket == "" {
+		return
+	}
+	value, _ := member(hostConfig, "Binds")
+	if binds, ok := value.([]any); ok {
+		for i, b := range binds {
+			bind, _ := b.(string)
+			source, rest, _ := strings.Cut(bind, ":")
+			if slices.Contains(HostSockets, path.Clean(source)) {
+				binds[i] = p.policy.Socket + ":" + rest
+			}
+		}
+	}
+	value, _ = member(hostConfig, "Mounts")
+	if mounts, ok := value.([]any); ok {
+		for _, m := range mounts {
+			mount, _ := m.(map[string]any)
+			value, sourceKey := member(mount, "Source")
+			source, _ := value.(string)
+			if kind, _ := member(mount, "Type"); kind == "bind" && slices.Contains(HostSockets, path.Clean(source)) {
+				mount[sourceKey] = p.policy.Socket
+			}
+		}
+	}
+}
+
+// rewriteNetworks keeps containers behind the egress proxy when the runner
+// has a job network: containers on the default bridge, which routes straight
+// out, move to the job network, and containers on a job-created network,
+// which is internal (see internalNetwork), join it as well to reach the proxy.
+func (p *Proxy) rewriteNetworks(obj map[string]any) {
+	if p.policy.JobNetwork == "" {
+		return
+	}
+	hostConfig := object(obj, "HostConfig")
+	endpoints := object(object(obj, "NetworkingConfig"), "EndpointsConfig")
+
+	value, key := member(hostConfig, "NetworkMode")
+	mode, _ := value.(string)
+	if mode == "none" || strings.HasPrefix(mode, "container:") {
+		return
+	}
+	if slices.Contains(bridgeNetworks, mode) {
+		hostConfig[key] = p.policy.JobNetwork
+	}
+	for name, endpoint := range endpoints {
+		if slices.Contains(bridgeNetworks, name) {
+			delete(endpoints, name)
+			endpoints[p.policy.JobNetwork] = endpoint
+		}
+	}
+	if _, ok := endpoints[p.policy.JobNetwork]; !ok {
+		endpoints[p.policy.JobNetwork] = map[string]any{}
+	}
+}
+
+// internalNetwork makes job-created networks internal when the runner has a
+// job network, so they cannot route around the egress proxy either.
+func (p *Proxy) internalNetwork(obj map[string]any) error {
+	if p.policy.JobNetwork != "" {
+		_, key := member(obj, "Internal")
+		obj[key] = true
+	}
+	return nil
+}
+
+// checkNetwork allows the default networks, the job network and networks the
+// runner's jobs created.
+func (p *Proxy) checkNetwork(ctx context.Context, mode string) error {
+	if slices.Contains(builtinNetworks, mode) || (mode != "" && mode == p.policy.JobNetwork) {
+		return nil
+	}
+	if id, ok := strings.CutPrefix(mode, "container:"); ok {
+		return p.requireOwned(ctx, "containers", id)
+	}
+	if slices.Contains(hostModes, mode) {
+		return deny("the host network is not allowed")
+	}
+	return p.requireOwned(ctx, "networks", mode)
+}
+
+func (p *Proxy) checkExecCreate(r *http.Request) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	setBody(r, body)
+
+	var exec struct{ Privileged bool }
+	if err := json.Unmarshal(body, &exec); err != nil {
+		return deny("invalid exec config: %v", err)
+	}
+	if exec.Privileged {
+		return deny("privileged exec is not allowed")
+	}
+	return nil
+}
+
+// checkNetworkConnect requires the container in a connect or disconnect
+// request to be the runner's.
+func (p *Proxy) checkNetworkConnect(r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return nil
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	setBody(r, body)
+
+	var req struct{ Container string }
+	if err := json.Unmarshal(body, &req); err != nil {
+		return deny("invalid network request: %v", err)
+	}
+	return p.requireOwned(r.Context(), "containers", req.Container)
+}
+
+// labelBody runs check on a create request body and adds the runner label.
+func (p *Proxy) labelBody(r *http.Request, check func(obj map[string]any) error) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	obj, err := decodeObject(body)
+	if err != nil {
+		return err
+	}
+	if check != nil {
+		if err := check(obj); err != nil {
+			return err
+		}
+	}
+	p.addLabel(obj)
+
+	rewritten, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	setBody(r, rewritten)
+	return nil
+}
+
+// checkVolumeCreate refuses local volumes backed by a host path or device
+// (docker volume create -o type=none -o o=bind -o device=/).
+func checkVolumeCreate(obj map[string]any) error {
+	opts, _ := obj["DriverOpts"].(map[string]any)
+	if _, ok := opts["device"]; ok {
+		return deny("volumes backed by a host path or device are not allowed")
+	}
+	if o, _ := opts["o"].(string); strings.Contains(o, "bind") {
+		return deny("volumes backed by a host path or device are not allowed")
+	}
+	return nil
+}
+
+// rewriteBuild refuses BuildKit builds and RUN steps on networks containers
+// could not use, moves steps off the default bridge like containers (see
+// rewriteNetworks) and labels the image.
+func (p *Proxy) rewriteBuild(r *http.Request) error {
+	query := r.URL.Query()
+	if version := query.Get("version"); version != "" && version != "1" {
+		return deny("BuildKit builds are not allowed; build with DOCKER_BUILDKIT=0")
+	}
+	mode := query.Get("networkmode")
+	if err := p.checkNetwork(r.Context(), mode); err != nil {
+		return err
+	}
+	if p.policy.JobNetwork != "" && slices.Contains(bridgeNetworks, mode) {
+		query.Set("networkmode", p.policy.JobNetwork)
+	}
+
+	labels := map[string]string{}
+	if raw := query.Get("labels"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &labels); err != nil {
+			return deny("invalid build labels: %v", err)
+		}
+	}
+	labels[RunnerLabel] = p.policy.Runner
+	encoded, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	query.Set("labels", string(encoded))
+	r.URL.RawQuery = query.Encode()
+	return nil
+}
@@ -0,0 +1,130 @@
+// Package dockerproxy is a filtering proxy in front of the Docker daemon
+// socket. Each listener belongs to one runner: requests outside the API that
+// builds, runs and pulls are refused, container create requests are checked
+// for privileged settings and host mounts, and every container, network and
+// volume a job creates is labelled with the runner's name so the post-job
+// scrub can find it.
+package dockerproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/subhead/github-runners/tools/internal/docker"
+)
+
+// RunnerLabel holds the name of the runner whose job created an object.
+const RunnerLabel = "gh-runner.runner"
+
+// HostSockets are the daemon socket paths a job may bind-mount into its
+// containers. The proxy mounts the runner's own proxy socket instead, so job
+// containers (and the runner's container jobs) stay behind the same policy.
+var HostSockets = []string{"/var/run/docker.sock", "/run/docker.sock"}
+
+// Policy is what one runner's jobs may do.
+type Policy struct {
+	Runner       string   // value of RunnerLabel on everything the runner creates
+	AllowedBinds []string // host paths (and everything below them) containers may bind-mount
+	Socket       string   // host path of this runner's proxy socket; replaces binds of HostSockets
+	JobNetwork   string   // network containers join in place of the default bridge; job-created networks are internal when set
+}
+
+// Proxy forwards one runner's Docker API requests to the daemon.
+type Proxy struct {
+	policy Policy
+	client *http.Client // ownership lookups
+	base   string
+	proxy  *httputil.ReverseProxy
+	log    *log.Logger
+}
+
+// deniedError is a request the policy refuses, as opposed to a failed lookup.
+type deniedError string
+
+func (e deniedError) Error() string { return string(e) }
+
+func deny(format string, args ...any) error {
+	return deniedError(fmt.Sprintf(format, args...))
+}
+
+// New returns a proxy that sends allowed requests to the daemon at upstream
+// (a unix:// or tcp:// address).
+func New(upstream string, policy Policy, logger *log.Logger) (*Proxy, error) {
+	if policy.Runner == "" {
+		return nil, errors.New("policy needs a runner name")
+	}
+	for i, p := range policy.AllowedBinds {
+		if !path.IsAbs(p) {
+			return nil, fmt.Errorf("allowed bind %q is not an absolute path", p)
+		}
+		policy.AllowedBinds[i] = path.Clean(p)
+	}
+
+	transport, base, err := docker.Transport(upstream)
+	if err != nil {
+		return nil, err
+	}
+	target, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{
+		policy: policy,
+		client: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		base:   base,
+		log:    logger,
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.Host = target.Host
+		},
+		Transport: transport,
+		// Logs, events, pulls and attach stream until the client hangs up
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			p.log.Printf("runner=%s ERROR %s %s: %v", p.policy.Runner, r.Method, r.URL.Path, err)
+			writeError(w, http.StatusBadGateway, "docker proxy: "+err.Error())
+		},
+	}
+	return p, nil
+}
+
+// versionPrefix is the optional /v1.43 in front of every API path.
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+(\.[0-9]+)*`)
+
+// ServeHTTP checks a request against the policy, rewrites it where needed
+// and forwards it to the daemon.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	apiPath := versionPrefix.ReplaceAllString(r.URL.Path, "")
+
+	err := p.filter(r, apiPath)
+	var denied deniedError
+	switch {
+	case errors.As(err, &denied):
+		p.log.Printf("runner=%s DENY %s %s: %v", p.policy.Runner, r.Method, apiPath, denied)
+		writeError(w, http.StatusForbidden, "docker proxy: "+denied.Error())
+		return
+	case err != nil:
+		p.log.Printf("runner=%s ERROR %s %s: %v", p.policy.Runner, r.Method, apiPath, err)
+		writeError(w, http.StatusBadGateway, "docker proxy: "+err.Error())
+		return
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+// writeError answers in the daemon's error format, which the docker CLI prints.
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
@@ -0,0 +1,373 @@
+package dockerproxy
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeDaemon answers ownership lookups from labels and records the last
+// request the proxy forwarded.
+type fakeDaemon struct {
+	containers map[string]map[string]string // id -> labels
+	networks   map[string]map[string]string
+	volumes    map[string]map[string]string
+
+	forwarded *http.Request
+	body      string
+}
+
+func (d *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if r.Method == http.MethodGet && len(parts) >= 2 {
+		var objects map[string]map[string]string
+		switch parts[0] {
+		case "containers":
+			objects = d.containers
+		case "networks":
+			objects = d.networks
+		case "volumes":
+			objects = d.volumes
+		}
+		if labels, ok := objects[parts[1]]; ok && (parts[0] != "containers" || len(parts) == 3 && parts[2] == "json") {
+			if parts[0] == "containers" {
+				_ = json.NewEncoder(w).Encode(map[string]any{"Config": map[string]any{"Labels": labels}})
+			} else {
+				_ = json.NewEncoder(w).Encode(map[string]any{"Labels": labels})
+			}
+			return
+		}
+		if objects != nil && parts[1] != "json" {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	body, _ := io.ReadAll(r.Body)
+	d.forwarded, d.body = r, string(body)
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, "{}")
+}
+
+func newTestProxy(t *testing.T) (*Proxy, *fakeDaemon) {
+	t.Helper()
+	own := map[string]string{RunnerLabel: "runner-1"}
+	other := map[string]string{RunnerLabel: "runner-2"}
+	daemon := &fakeDaemon{
+		containers: map[string]map[string]string{"job": own, "other-job": other, "runner-1": {"service": "github-runner"}},
+		networks:   map[string]map[string]string{"job-net": own, "other-net": other},
+		volumes:    map[string]map[string]string{"job-vol": own, "other-vol": other},
+	}
+	server := httptest.NewServer(daemon)
+	t.Cleanup(server.Close)
+
+	p, err := New("tcp://"+server.Listener.Addr().String(), Policy{
+		Runner:       "runner-1",
+		AllowedBinds: []string{"/actions-runner/_work"},
+		Socket:       "/run/gh-runner-docker-proxy/runner-1/docker.sock",
+	}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, daemon
+}
+
+func TestProxy(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"ping", "GET", "/_ping", "", 200},
+		{"versioned path", "GET", "/v1.43/version", "", 200},
+		{"swarm", "POST", "/swarm/init", "{}", 403},
+		{"system prune", "POST", "/system/prune", "", 403},
+		{"plugin install", "POST", "/plugins/pull", "", 403},
+
+		{"plain container", "POST", "/containers/create", `{"Image":"alpine"}`, 200},
+		{"privileged", "POST", "/containers/create", `{"HostConfig":{"Privileged":true}}`, 403},
+		{"privileged lower case", "POST", "/containers/create", `{"HostConfig":{"privileged":true}}`, 403},
+		{"privileged hidden by a later key", "POST", "/containers/create", `{"HostConfig":{"privileged":true,"Privileged":false}}`, 403},
+		{"privileged hidden by an earlier key", "POST", "/containers/create", `{"HostConfig":{"Privileged":false,"privileged":true}}`, 403},
+		{"same key twice", "POST", "/containers/create", `{"HostConfig":{"Privileged":true,"Privileged":false}}`, 403},
+		{"duplicate HostConfig", "POST", "/containers/create", `{"hostconfig":{"Privileged":true},"HostConfig":{}}`, 403},
+		{"duplicate by unicode folding", "POST", "/containers/create", `{"HostConfig":{"SecurityOpt":[],"ſecurityOpt":["seccomp=unconfined"]}}`, 403},
+		{"duplicate inside an array", "POST", "/containers/create", `{"HostConfig":{"Mounts":[{"Type":"tmpfs","type":"bind","Source":"/"}]}}`, 403},
+		{"trailing object", "POST", "/containers/create", `{} {"HostConfig":{"Privileged":true}}`, 403},
+		{"too deep", "POST", "/containers/create", strings.Repeat(`{"a":`, 100) + "1" + strings.Repeat("}", 100), 403},
+
+		{"host pid", "POST", "/containers/create", `{"HostConfig":{"PidMode":"host"}}`, 403},
+		{"host network", "POST", "/containers/create", `{"HostConfig":{"NetworkMode":"host"}}`, 403},
+		{"host userns", "POST", "/containers/create", `{"HostConfig":{"UsernsMode":"host"}}`, 403},
+		{"pid of own job container", "POST", "/containers/create", `{"HostConfig":{"PidMode":"container:job"}}`, 200},
+		{"pid of the runner container", "POST", "/containers/create", `{"HostConfig":{"PidMode":"container:runner-1"}}`, 403},
+		{"pid of another runner's container", "POST", "/containers/create", `{"HostConfig":{"PidMode":"container:other-job"}}`, 403},
+		{"ipc of another runner's container", "POST", "/containers/create", `{"HostConfig":{"IpcMode":"container:other-job"}}`, 403},
+		{"uts of the runner container", "POST", "/containers/create", `{"HostConfig":{"UTSMode":"container:runner-1"}}`, 403},
+		{"pid of a missing container", "POST", "/containers/create", `{"HostConfig":{"PidMode":"container:nope"}}`, 403},
+		{"network of own job container", "POST", "/containers/create", `{"HostConfig":{"NetworkMode":"container:job"}}`, 200},
+		{"network of the runner container", "POST", "/containers/create", `{"HostConfig":{"NetworkMode":"container:runner-1"}}`, 403},
+
+		{"own network", "POST", "/containers/create", `{"HostConfig":{"NetworkMode":"job-net"}}`, 200},
+		{"other runner's network", "POST", "/containers/create", `{"HostConfig":{"NetworkMode":"other-net"}}`, 403},
+		{"other runner's network endpoint", "POST", "/containers/create", `{"NetworkingConfig":{"EndpointsConfig":{"other-net":{}}}}`, 403},
+
+		{"SYS_ADMIN", "POST", "/containers/create", `{"HostConfig":{"CapAdd":["CAP_SYS_ADMIN"]}}`, 403},
+		{"harmless capability", "POST", "/containers/create", `{"HostConfig":{"CapAdd":["NET_BIND_SERVICE"]}}`, 200},
+		{"default capability added back", "POST", "/containers/create", `{"HostConfig":{"CapDrop":["ALL"],"CapAdd":["cap_chown"]}}`, 200},
+		{"all capabilities", "POST", "/containers/create", `{"HostConfig":{"CapAdd":["ALL"]}}`, 403},
+		{"SYS_TIME", "POST", "/containers/create", `{"HostConfig":{"CapAdd":["SYS_TIME"]}}`, 403},
+		{"MAC_ADMIN", "POST", "/containers/create", `{"HostConfig":{"CapAdd":["mac_admin"]}}`, 403},
+		{"SYS_NICE", "POST", "/containers/create", `{"HostConfig":{"CapAdd":["CAP_SYS_NICE"]}}`, 403},
+		{"unconfined seccomp", "POST", "/containers/create", `{"HostConfig":{"SecurityOpt":["seccomp=unconfined"]}}`, 403},
+		{"device", "POST", "/containers/create", `{"HostConfig":{"Devices":[{"PathOnHost":"/dev/sda"}]}}`, 403},
+		{"bind of /etc", "POST", "/containers/create", `{"HostConfig":{"Binds":["/etc:/host-etc"]}}`, 403},
+		{"bind escaping the workspace", "POST", "/containers/create", `{"HostConfig":{"Binds":["/actions-runner/_work/../../etc:/x"]}}`, 403},
+		{"bind of the workspace", "POST", "/containers/create", `{"HostConfig":{"Binds":["/actions-runner/_work/repo:/src"]}}`, 200},
+		{"bind mount of /", "POST", "/containers/create", `{"HostConfig":{"Mounts":[{"Type":"bind","Source":"/","Target":"/host"}]}}`, 403},
+		{"own volume", "POST", "/containers/create", `{"HostConfig":{"Binds":["job-vol:/data"]}}`, 200},
+		{"other runner's volume", "POST", "/containers/create", `{"HostConfig":{"Binds":["other-vol:/data"]}}`, 403},
+		{"volumes from another runner", "POST", "/containers/create", `{"HostConfig":{"VolumesFrom":["other-job:ro"]}}`, 403},
+
+		{"own container", "GET", "/containers/job/json", "", 200},
+		{"other runner's container", "GET", "/containers/other-job/json", "", 403},
+		{"runner container", "POST", "/containers/runner-1/kill", "", 403},
+		{"exec in own container", "POST", "/containers/job/exec", `{"Cmd":["sh"]}`, 200},
+		{"privileged exec", "POST", "/containers/job/exec", `{"Privileged":true}`, 403},
+		{"privileged exec hidden by a duplicate", "POST", "/containers/job/exec", `{"privileged":true,"Privileged":false}`, 403},
+		{"exec in the runner container", "POST", "/containers/runner-1/exec", `{"Cmd":["sh"]}`, 403},
+
+		{"own network delete", "DELETE", "/networks/job-net", "", 200},
+		{"other runner's network delete", "DELETE", "/networks/other-net", "", 403},
+		{"connect another runner's container", "POST", "/networks/job-net/connect", `{"Container":"other-job"}`, 403},
+		{"host path volume", "POST", "/volumes/create", `{"Name":"x","DriverOpts":{"type":"none","o":"bind","device":"/"}}`, 403},
+		{"plain volume", "POST", "/volumes/create", `{"Name":"x"}`, 200},
+		{"build on the host network", "POST", "/build?networkmode=host", "", 403},
+		{"build on another runner's network", "POST", "/build?networkmode=other-net", "", 403},
+		{"build on a job network", "POST", "/build?networkmode=job-net", "", 200},
+		{"classic build", "POST", "/build?version=1", "", 200},
+		{"BuildKit build", "POST", "/build?version=2", "", 403},
+		{"BuildKit session", "POST", "/session", "", 403},
+		{"buildx over gRPC", "POST", "/grpc", "", 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, daemon := newTestProxy(t)
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusForbidden && daemon.forwarded != nil {
+				t.Fatalf("denied request reached the daemon: %s %s", daemon.forwarded.Method, daemon.forwarded.URL)
+			}
+		})
+	}
+}
+
+func TestContainerCreateRewrite(t *testing.T) {
+	p, daemon := newTestProxy(t)
+	body := `{"Image":"alpine","Labels":{"app":"x"},"HostConfig":{"Binds":["/var/run/docker.sock:/var/run/docker.sock:ro"],"Memory":1073741824123}}`
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("POST", "/v1.43/containers/create?name=c", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var got struct {
+		Labels     map[string]string
+		HostConfig struct {
+			Binds  []string
+			Memory json.Number
+		}
+	}
+	if err := json.Unmarshal([]byte(daemon.body), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Labels[RunnerLabel] != "runner-1" || got.Labels["app"] != "x" {
+		t.Errorf("labels = %v, want the job's plus %s=runner-1", got.Labels, RunnerLabel)
+	}
+	if want := "/run/gh-runner-docker-proxy/runner-1/docker.sock:/var/run/docker.sock:ro"; len(got.HostConfig.Binds) != 1 || got.HostConfig.Binds[0] != want {
+		t.Errorf("binds = %v, want [%s]", got.HostConfig.Binds, want)
+	}
+	if got.HostConfig.Memory != "1073741824123" {
+		t.Errorf("memory = %s, numbers must pass through unchanged", got.HostConfig.Memory)
+	}
+	if daemon.forwarded.URL.RawQuery != "name=c" {
+		t.Errorf("query = %q, want name=c", daemon.forwarded.URL.RawQuery)
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	p, daemon := newTestProxy(t)
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", `/containers/json?all=1&filters={"label":["app=x"],"status":{"running":true}}`, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var filters map[string]map[string]bool
+	if err := json.Unmarshal([]byte(daemon.forwarded.URL.Query().Get("filters")), &filters); err != nil {
+		t.Fatal(err)
+	}
+	if !filters["label"][RunnerLabel+"=runner-1"] || !filters["label"]["app=x"] || !filters["status"]["running"] {
+		t.Errorf("filters = %v, want the job's plus %s=runner-1", filters, RunnerLabel)
+	}
+}
+
+func TestFoldKey(t *testing.T) {
+	tests := []struct{ a, b string }{
+		{"Privileged", "privileged"},
+		{"SecurityOpt", "ſecurityopt"}, // long s
+		{"Kind", "KIND"},               // Kelvin sign
+	}
+	for _, tt := range tests {
+		if foldKey(tt.a) != foldKey(tt.b) {
+			t.Errorf("foldKey(%q) != foldKey(%q)", tt.a, tt.b)
+		}
+	}
+	if foldKey("Binds") == foldKey("Mounts") {
+		t.Error("different keys fold to the same string")
+	}
+}
+
+func TestSocketBindRewriteAnyCase(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"binds", `{"hostconfig":{"binds":["/var/run/docker.sock:/var/run/docker.sock"]}}`},
+		{"mounts", `{"hostconfig":{"mounts":[{"type":"bind","source":"/var/run/docker.sock","target":"/var/run/docker.sock"}]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, daemon := newTestProxy(t)
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, httptest.NewRequest("POST", "/containers/create", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+			}
+			if strings.Contains(daemon.body, `"/var/run/docker.sock:`) || strings.Contains(daemon.body, `"source":"/var/run/docker.sock"`) {
+				t.Errorf("daemon socket reached the daemon: %s", daemon.body)
+			}
+		})
+	}
+}
+
+func TestJobNetwork(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantMode      string
+		wantEndpoints []string
+	}{
+		{"default network", `{"Image":"alpine"}`, "runner-egress", []string{"runner-egress"}},
+		{"bridge", `{"HostConfig":{"NetworkMode":"bridge"}}`, "runner-egress", []string{"runner-egress"}},
+		{"bridge in lower case", `{"hostconfig":{"networkmode":"bridge"}}`, "runner-egress", []string{"runner-egress"}},
+		{"default endpoint", `{"HostConfig":{"NetworkMode":"default"},"NetworkingConfig":{"EndpointsConfig":{"default":{"Aliases":["db"]}}}}`, "runner-egress", []string{"runner-egress"}},
+		{"job network itself", `{"HostConfig":{"NetworkMode":"runner-egress"}}`, "runner-egress", []string{"runner-egress"}},
+		{"job-created network", `{"HostConfig":{"NetworkMode":"job-net"},"NetworkingConfig":{"EndpointsConfig":{"job-net":{}}}}`, "job-net", []string{"job-net", "runner-egress"}},
+		{"no network", `{"HostConfig":{"NetworkMode":"none"}}`, "none", nil},
+		{"own job container's network", `{"HostConfig":{"NetworkMode":"container:job"}}`, "container:job", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, daemon := newTestProxy(t)
+			p.policy.JobNetwork = "runner-egress"
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, httptest.NewRequest("POST", "/containers/create", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+			}
+
+			// Decoded like the daemon does, matching keys in any case
+			var got struct {
+				HostConfig       struct{ NetworkMode string }
+				NetworkingConfig struct {
+					EndpointsConfig map[string]struct{ Aliases []string }
+				}
+			}
+			if err := json.Unmarshal([]byte(daemon.body), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.HostConfig.NetworkMode != tt.wantMode {
+				t.Errorf("network mode = %q, want %q", got.HostConfig.NetworkMode, tt.wantMode)
+			}
+			var endpoints []string
+			for name := range got.NetworkingConfig.EndpointsConfig {
+				endpoints = append(endpoints, name)
+			}
+			slices.Sort(endpoints)
+			if !slices.Equal(endpoints, tt.wantEndpoints) {
+				t.Errorf("endpoints = %v, want %v", endpoints, tt.wantEndpoints)
+			}
+			if aliases := got.NetworkingConfig.EndpointsConfig["runner-egress"].Aliases; strings.Contains(tt.body, "Aliases") && !slices.Equal(aliases, []string{"db"}) {
+				t.Errorf("aliases = %v, want the default endpoint's [db]", aliases)
+			}
+		})
+	}
+}
+
+func TestJobNetworkBuild(t *testing.T) {
+	tests := []struct {
+		name, query, want string
+	}{
+		{"default network", "", "runner-egress"},
+		{"bridge", "networkmode=bridge", "runner-egress"},
+		{"job-created network", "networkmode=job-net", "job-net"},
+		{"no network", "networkmode=none", "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, daemon := newTestProxy(t)
+			p.policy.JobNetwork = "runner-egress"
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, httptest.NewRequest("POST", "/build?"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+			}
+			if got := daemon.forwarded.URL.Query().Get("networkmode"); got != tt.want {
+				t.Errorf("network mode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobNetworkCreate(t *testing.T) {
+	tests := []struct {
+		name       string
+		jobNetwork string
+		body       string
+		want       bool
+	}{
+		{"with a job network", "runner-egress", `{"Name":"n"}`, true},
+		{"asked for external", "runner-egress", `{"Name":"n","Internal":false}`, true},
+		{"asked for external in lower case", "runner-egress", `{"Name":"n","internal":false}`, true},
+		{"without a job network", "", `{"Name":"n"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, daemon := newTestProxy(t)
+			p.policy.JobNetwork = tt.jobNetwork
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, httptest.NewRequest("POST", "/networks/create", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+			}
+			var got struct{ Internal bool }
+			if err := json.Unmarshal([]byte(daemon.body), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Internal != tt.want {
+				t.Errorf("internal = %v, want %v: %s", got.Internal, tt.want, daemon.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package dockerproxy
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// action is what the proxy does with a request that matches a route.
+type action int
+
+const (
+	pass            action = iota // forward unchanged
+	filterList                    // list or prune: only the runner's own objects
+	createContainer               // check the container config, add the runner label
+	createExec                    // the container must be the runner's; no privileged exec
+	ownContainer                  // the container must be the runner's
+	ownExec                       // the exec instance must belong to one of the runner's containers
+	createNetwork                 // add the runner label; internal with a job network
+	ownNetwork                    // the network must be the runner's
+	createVolume                  // no host-path volumes; add the runner label
+	ownVolume                     // the volume must be the runner's
+	build                         // classic builder on an allowed network; label the image
+)
+
+type route struct {
+	methods string // space-separated
+	pattern *regexp.Regexp
+	action  action
+}
+
+func allow(methods, pattern string, a action) route {
+	return route{methods: methods, pattern: regexp.MustCompile("^" + pattern + "$"), action: a}
+}
+
+// routes is the API jobs may use, first match wins. Anything else (swarm,
+// plugins, system prune, daemon configuration ...) is refused.
+var routes = []route{
+	allow("GET HEAD", `/_ping`, pass),
+	allow("GET", `/version`, pass),
+	allow("GET", `/info`, pass),
+	allow("GET", `/events`, pass),
+	allow("POST", `/auth`, pass),
+
+	// Pull, build, push and inspect images
+	allow("GET", `/images/json`, pass),
+	allow("POST", `/images/create`, pass),
+	allow("POST", `/images/load`, pass),
+	allow("GET", `/images/get`, pass),
+	allow("GET", `/images/search`, pass),
+	allow("GET", `/images/.+/(json|history|get)`, pass),
+	allow("POST", `/images/.+/(tag|push)`, pass),
+	allow("DELETE", `/images/.+`, pass),
+	allow("GET", `/distribution/.+/json`, pass),
+	// Classic builder only: BuildKit (/session, /grpc) lets steps pick their
+	// own network (RUN --network=host), which the daemon allows by default
+	allow("POST", `/build`, build),
+
+	// Run containers
+	allow("GET", `/containers/json`, filterList),
+	allow("POST", `/containers/prune`, filterList),
+	allow("POST", `/containers/create`, createContainer),
+	allow("POST", `/containers/[^/]+/exec`, createExec),
+	allow("GET HEAD POST PUT DELETE", `/containers/[^/]+(/.*)?`, ownContainer),
+	allow("GET POST", `/exec/[^/]+/(json|start|resize)`, ownExec),
+
+	allow("GET", `/networks`, filterList),
+	allow("POST", `/networks/prune`, filterList),
+	allow("POST", `/networks/create`, createNetwork),
+	allow("GET", `/networks/[^/]+`, pass),
+	allow("DELETE", `/networks/[^/]+`, ownNetwork),
+	allow("POST", `/networks/[^/]+/(connect|disconnect)`, ownNetwork),
+
+	allow("GET", `/volumes`, filterList),
+	allow("POST", `/volumes/prune`, filterList),
+	allow("POST", `/volumes/create`, createVolume),
+	allow("GET", `/volumes/[^/]+`, pass),
+	allow("DELETE", `/volumes/[^/]+`, ownVolume),
+}
+
+// match returns the route for a request, or false if the API is not allowed.
+func match(method, apiPath string) (route, bool) {
+	for _, rt := range routes {
+		if !strings.Contains(" "+rt.methods+" ", " "+method+" ") {
+			continue
+		}
+		if rt.pattern.MatchString(apiPath) {
+			return rt, true
+		}
+	}
+	return route{}, false
+}
+
+// objectID returns the id or name after /containers/, /exec/, /networks/ or
+// /volumes/ in an API path.
+func objectID(apiPath string) string {
+	parts := strings.SplitN(strings.TrimPrefix(apiPath, "/"), "/", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// filter applies the route's checks and rewrites to r before it is forwarded.
+func (p *Proxy) filter(r *http.Request, apiPath string) error {
+	rt, ok := match(r.Method, apiPath)
+	if !ok {
+		return deny("%s %s is not allowed for runner jobs", r.Method, apiPath)
+	}
+
+	ctx := r.Context()
+	switch rt.action {
+	case filterList:
+		return p.restrictFilters(r)
+	case createContainer:
+		return p.rewriteContainerCreate(r)
+	case createExec:
+		if err := p.requireOwned(ctx, "containers", objectID(apiPath)); err != nil {
+			return err
+		}
+		return p.checkExecCreate(r)
+	case ownContainer:
+		return p.requireOwned(ctx, "containers", objectID(apiPath))
+	case ownExec:
+		return p.requireOwnedExec(ctx, objectID(apiPath))
+	case createNetwork:
+		return p.labelBody(r, p.internalNetwork)
+	case ownNetwork:
+		if err := p.requireOwned(ctx, "networks", objectID(apiPath)); err != nil {
+			return err
+		}
+		return p.checkNetworkConnect(r)
+	case createVolume:
+		return p.labelBody(r, checkVolumeCreate)
+	case ownVolume:
+		return p.requireOwned(ctx, "volumes", objectID(apiPath))
+	case build:
+		return p.rewriteBuild(r)
+	}
+	return nil
+}
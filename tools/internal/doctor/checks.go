@@ -0,0 +1,486 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/subhead/github-runners/tools/internal/config"
+	"github.com/subhead/github-runners/tools/internal/docker"
+	"github.com/subhead/github-runners/tools/internal/dockerfile"
+	"github.com/subhead/github-runners/tools/internal/dockerlint"
+	"github.com/subhead/github-runners/tools/internal/github"
+)
+
+// runnerUID is the runner user baked into the base image.
+const runnerUID = 1001
+
+func (d *Doctor) checkConfig(context.Context) Result {
+	r := Result{Name: "Configuration"}
+
+	composeData, err := os.ReadFile(d.opts.ComposeFile)
+	if err != nil {
+		r.Status, r.Detail = Fail, err.Error()
+		return r
+	}
+
+	// Validate what compose will actually see: .env overridden by the shell
+	entries := make([]config.Entry, 0, len(d.env))
+	lines := map[string]int{}
+	for _, e := range d.entries {
+		lines[e.Name] = e.Line
+	}
+	for _, e := range d.entries {
+		if v, ok := d.env[e.Name]; ok {
+			e.Value = v
+		}
+		entries = append(entries, e)
+	}
+	for name, value := range d.env {
+		if _, ok := lines[name]; !ok {
+			entries = append(entries, config.Entry{Name: name, Value: value})
+		}
+	}
+
+	problems := config.Validate(entries, config.Options{
+		ComposeFiles: map[string]string{d.rel(d.opts.ComposeFile): string(composeData)},
+	})
+
+	source := "environment"
+	if d.opts.EnvFile != "" {
+		source = d.rel(d.opts.EnvFile) + " and environment"
+	}
+	r.Detail = fmt.Sprintf("%d variable(s) from %s", len(entries), source)
+	for _, p := range problems {
+		p.Path = source
+		r.Hints = append(r.Hints, p.String())
+		if p.Warning {
+			r.Status = max(r.Status, Warn)
+		} else {
+			r.Status = Fail
+		}
+	}
+	if r.Status == Fail {
+		r.Hints = append(r.Hints, "See docs/ENVIRONMENT_VARIABLES.md for every supported variable")
+	}
+	return r
+}
+
+func (d *Doctor) checkDocker(ctx context.Context) Result {
+	r := Result{Name: "Docker daemon"}
+
+	client, err := docker.NewClient(d.opts.DockerHost)
+	if err == nil {
+		err = client.Ping(ctx)
+	}
+	if err != nil {
+		r.Status, r.Detail = Fail, err.Error()
+		r.Hints = []string{
+			"Start Docker: sudo systemctl start docker",
+			"Allow your user to use it: sudo usermod -aG docker $USER (then log in again)",
+			"Or point DOCKER_HOST at a reachable daemon",
+		}
+		return r
+	}
+
+	d.docker = client
+	v, err := client.Version(ctx)
+	if err != nil {
+		r.Status, r.Detail = Warn, "reachable, but GET /version failed: "+err.Error()
+		return r
+	}
+	r.Detail = fmt.Sprintf("Docker %s (API %s) at %s", v.Version, v.APIVersion, client.Host)
+	return r
+}
+
+// buildOrder returns the gh-runner images the service needs, dependencies first.
+func (d *Doctor) buildOrder() ([]string, map[string]string, map[string][]string) {
+	files := map[string]string{} // tag -> Dockerfile
+	deps := map[string][]string{}
+	var order []string
+	seen := map[string]bool{}
+
+	var visit func(tag string, f *dockerfile.File)
+	visit = func(tag string, f *dockerfile.File) {
+		if seen[tag] {
+			return
+		}
+		seen[tag] = true
+		if f != nil {
+			files[tag] = f.Path
+			for _, dep := range d.lint.Requires(f) {
+				deps[tag] = append(deps[tag], dep)
+				visit(dep, d.lint.Image(dep))
+			}
+		}
+		order = append(order, tag)
+	}
+
+	tag := strings.TrimPrefix(d.service.Image, dockerlint.ImagePrefix)
+	visit(tag, d.lint.File(d.dockerfile()))
+	return order, files, deps
+}
+
+// dockerfile returns the service's Dockerfile relative to the repository root.
+func (d *Doctor) dockerfile() string {
+	if d.service.Dockerfile == "" {
+		return ""
+	}
+	abs := filepath.Join(filepath.Dir(d.opts.ComposeFile), d.service.Context, d.service.Dockerfile)
+	return filepath.ToSlash(d.rel(abs))
+}
+
+func (d *Doctor) checkImages(ctx context.Context) Result {
+	r := Result{Name: "Images"}
+	if d.docker == nil {
+		r.Status, r.Detail = Skip, "Docker daemon not reachable"
+		return r
+	}
+	if !strings.HasPrefix(d.service.Image, dockerlint.ImagePrefix) {
+		r.Detail = d.service.Image + " is not built from this repository"
+		return r
+	}
+
+	order, files, deps := d.buildOrder()
+	names := make([]string, len(order))
+	for i, tag := range order {
+		names[i] = dockerlint.ImagePrefix + tag
+	}
+	r.Detail = "build order: " + strings.Join(names, " -> ")
+
+	for _, tag := range order {
+		img, err := d.docker.ImageInspect(ctx, dockerlint.ImagePrefix+tag)
+		switch {
+		case errors.Is(err, docker.ErrNotFound):
+			d.missing = append(d.missing, tag)
+			r.Status = Fail
+			if f, ok := files[tag]; ok {
+				r.Hints = append(r.Hints, fmt.Sprintf("Missing %s%s: docker build -f %s -t %s%s .", dockerlint.ImagePrefix, tag, f, dockerlint.ImagePrefix, tag))
+			} else {
+				r.Hints = append(r.Hints, fmt.Sprintf("Missing %s%s and no Dockerfile in docker/linux builds it", dockerlint.ImagePrefix, tag))
+			}
+		case err != nil:
+			r.Status, r.Detail = Fail, err.Error()
+			return r
+		default:
+			d.images[tag] = img
+		}
+	}
+
+	// An image older than something it copies from still has the old contents
+	for _, tag := range order {
+		img, ok := d.images[tag]
+		if !ok {
+			continue
+		}
+		for _, dep := range deps[tag] {
+			if depImg, ok := d.images[dep]; ok && depImg.Created.After(img.Created) {
+				r.Status = max(r.Status, Warn)
+				r.Hints = append(r.Hints, fmt.Sprintf("%s%s was rebuilt after %s%s; rebuild %s%s to pick up the change: docker build -f %s -t %s%s .",
+					dockerlint.ImagePrefix, dep, dockerlint.ImagePrefix, tag, dockerlint.ImagePrefix, tag, files[tag], dockerlint.ImagePrefix, tag))
+			}
+		}
+	}
+	if r.Status == Fail {
+		r.Hints = append(r.Hints, "Or build everything in order: docker compose -f docker-compose/build-all.yml build")
+	}
+	return r
+}
+
+var sizePattern = regexp.MustCompile(`~?([0-9.]+)\s*(MB|GB)`)
+
+// estimateMB returns the documented size of the image a Dockerfile builds,
+// from its org.opencontainers.image.size label or "# Size:" header comment.
+func (d *Doctor) estimateMB(path string) int64 {
+	if f := d.lint.File(path); f != nil && f.FinalStage() != nil {
+		for _, inst := range f.FinalStage().Instructions {
+			if inst.Cmd != "LABEL" {
+				continue
+			}
+			for _, kv := range inst.KeyValues() {
+				if kv.Key == "org.opencontainers.image.size" {
+					if mb := parseMB(kv.Value); mb > 0 {
+						return mb
+					}
+				}
+			}
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(d.opts.Root, path))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, "# Size:"); ok {
+			return parseMB(rest)
+		}
+	}
+	return 0
+}
+
+func parseMB(s string) int64 {
+	m := sizePattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0
+	}
+	if m[2] == "GB" {
+		n *= 1024
+	}
+	return int64(n)
+}
+
+func (d *Doctor) checkDisk(ctx context.Context) Result {
+	r := Result{Name: "Disk space"}
+
+	path := d.opts.Root
+	if d.docker != nil {
+		if info, err := d.docker.Info(ctx); err == nil && info.DockerRootDir != "" {
+			if _, err := os.Stat(info.DockerRootDir); err == nil {
+				path = info.DockerRootDir
+			}
+		}
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		r.Status, r.Detail = Warn, fmt.Sprintf("cannot stat %s: %v", path, err)
+		return r
+	}
+	freeMB := int64(st.Bavail) * int64(st.Bsize) / (1024 * 1024)
+
+	// Images still to be built, plus room for job workspaces
+	_, files, _ := d.buildOrder()
+	var needMB int64
+	for _, tag := range d.missing {
+		if f, ok := files[tag]; ok {
+			needMB += d.estimateMB(f)
+		}
+	}
+	needMB += d.opts.MinFreeMB
+
+	r.Detail = fmt.Sprintf("%d MB free at %s, need about %d MB", freeMB, path, needMB)
+	if len(d.missing) > 0 {
+		r.Detail += fmt.Sprintf(" (%d image(s) to build + %d MB for workspaces)", len(d.missing), d.opts.MinFreeMB)
+	}
+	if freeMB < needMB {
+		r.Status = Fail
+		r.Hints = []string{
+			"Free space with: docker system prune (add -a to remove unused images)",
+			"Or move Docker's data-root to a larger disk (/etc/docker/daemon.json)",
+		}
+	}
+	return r
+}
+
+func (d *Doctor) github() *github.Client {
+	return github.NewClient(d.opts.GitHubAPI, d.runner["GITHUB_TOKEN"])
+}
+
+func (d *Doctor) checkToken(ctx context.Context) Result {
+	r := Result{Name: "GitHub token"}
+	if d.opts.Offline {
+		r.Status, r.Detail = Skip, "offline"
+		return r
+	}
+	token := d.runner["GITHUB_TOKEN"]
+	if token == "" && d.runner["GITHUB_TOKEN_FILE"] != "" {
+		r.Status, r.Detail = Skip, "token is read from "+d.runner["GITHUB_TOKEN_FILE"]+" inside the container"
+		return r
+	}
+	if token == "" {
+		r.Status, r.Detail = Fail, "GITHUB_TOKEN is not set"
+		r.Hints = []string{"Set GITHUB_TOKEN in .env or the shell before docker compose up"}
+		return r
+	}
+
+	repo, owner := d.runner["GITHUB_REPOSITORY"], d.runner["GITHUB_OWNER"]
+	target, scope := "organization "+owner, "admin:org"
+	if repo != "" {
+		target, scope = "repository "+repo, "repo"
+	}
+
+	client := d.github()
+	user, err := client.User(ctx)
+	var apiErr *github.APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Status == 401:
+		r.Status, r.Detail = Fail, "token rejected: "+apiErr.Message
+		r.Hints = []string{"The token is invalid, expired or revoked; create a new one"}
+		return r
+	case errors.As(err, &apiErr) && apiErr.Status == 403:
+		// Installation tokens cannot call /user; the runners call below decides
+		r.Detail = "token cannot read /user (GitHub App installation token?)"
+	case err != nil:
+		r.Status, r.Detail = Fail, "cannot reach the GitHub API: "+err.Error()
+		r.Hints = []string{"Check network access to " + client.BaseURL + ", or use -offline"}
+		return r
+	default:
+		r.Detail = "authenticated as " + user.Login
+	}
+
+	if user.Scopes != nil {
+		if !hasScope(user.Scopes, scope) {
+			r.Status = Fail
+			r.Detail += fmt.Sprintf("; classic token scopes: %s", strings.Join(user.Scopes, ", "))
+			r.Hints = append(r.Hints, fmt.Sprintf("Registering a runner for the %s needs the %q scope", target, scope))
+			return r
+		}
+		r.Detail += fmt.Sprintf("; has %q scope", scope)
+	}
+
+	runners, err := client.Runners(ctx, github.RunnersPath(repo, owner))
+	switch {
+	case errors.As(err, &apiErr) && (apiErr.Status == 403 || apiErr.Status == 401):
+		r.Status = Fail
+		r.Detail += "; cannot manage self-hosted runners for the " + target
+		r.Hints = append(r.Hints, "Fine-grained tokens need \"Administration: Read and write\" (repository) or \"Self-hosted runners: Read and write\" (organization)")
+	case errors.As(err, &apiErr) && apiErr.Status == 404:
+		r.Status = Fail
+		r.Detail += "; " + target + " not found or not visible to this token"
+		r.Hints = append(r.Hints, "Check GITHUB_REPOSITORY / GITHUB_OWNER and that the token can access it")
+	case err != nil:
+		r.Status = Fail
+		r.Detail += "; listing runners failed: " + err.Error()
+	default:
+		d.runners, d.listed = runners, true
+		r.Detail += fmt.Sprintf("; can manage runners for the %s", target)
+	}
+	return r
+}
+
+// hasScope reports whether scopes grant want; admin:org implies the runner
+// permissions of manage_runners:org.
+func hasScope(scopes []string, want string) bool {
+	for _, s := range scopes {
+		if s == want || (want == "admin:org" && s == "manage_runners:org") {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Doctor) checkRunnerName(context.Context) Result {
+	r := Result{Name: "Runner name"}
+	name := d.runner["RUNNER_NAME"]
+	if name == "" {
+		r.Status, r.Detail = Fail, "RUNNER_NAME resolves to an empty value"
+		return r
+	}
+	if !d.listed {
+		r.Status, r.Detail = Skip, name+": runner list not available"
+		return r
+	}
+
+	var existing *github.Runner
+	for i := range d.runners {
+		if strings.EqualFold(d.runners[i].Name, name) {
+			existing = &d.runners[i]
+		}
+	}
+	if existing == nil {
+		r.Detail = name + " is not registered yet"
+		return r
+	}
+
+	// The entrypoint reuses a registration found in the mounted runner directory
+	for _, v := range d.service.Volumes {
+		if v.Bind() && v.Target == "/actions-runner" {
+			if _, err := os.Stat(filepath.Join(d.compose.HostPath(v), ".runner")); err == nil {
+				r.Detail = fmt.Sprintf("%s is registered (id %d, %s) by %s and will be reused", name, existing.ID, existing.Status, d.rel(d.compose.HostPath(v)))
+				return r
+			}
+		}
+	}
+
+	r.Detail = fmt.Sprintf("%s is already registered (id %d, %s)", name, existing.ID, existing.Status)
+	if d.runner["RUNNER_REPLACE_EXISTING"] == "true" {
+		r.Status = Warn
+		r.Detail += "; RUNNER_REPLACE_EXISTING=true will replace it"
+		if existing.Busy {
+			r.Hints = append(r.Hints, "It is running a job right now; replacing it will fail that job")
+		}
+		return r
+	}
+	r.Status = Fail
+	r.Hints = []string{
+		"Choose a different RUNNER_NAME",
+		"Or set RUNNER_REPLACE_EXISTING=true to take over the registration",
+		fmt.Sprintf("Or remove the stale runner in GitHub: Settings → Actions → Runners → %s", name),
+	}
+	return r
+}
+
+func (d *Doctor) checkMounts(context.Context) Result {
+	r := Result{Name: "Bind mounts"}
+	uid, gid := runnerUID, runnerUID
+	if u, g, ok := strings.Cut(d.service.User, ":"); d.service.User != "" {
+		uid, _ = strconv.Atoi(u)
+		gid = uid
+		if ok {
+			gid, _ = strconv.Atoi(g)
+		}
+	}
+	// Started as root, the entrypoint runs the runner and its jobs as runner
+	if uid == 0 && d.runner["RUNNER_AS_ROOT"] != "true" {
+		uid, gid = runnerUID, runnerUID
+	}
+
+	checked := 0
+	for _, v := range d.service.Volumes {
+		if !v.Bind() || v.ReadOnly {
+			continue
+		}
+		path := d.compose.HostPath(v)
+		fi, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			r.Status = Fail
+			r.Hints = append(r.Hints, fmt.Sprintf("%s does not exist; Docker would create it owned by root. Run: mkdir -p %s && sudo chown %d:%d %s",
+				d.rel(path), path, uid, gid, path))
+			continue
+		case err != nil:
+			r.Status = Fail
+			r.Hints = append(r.Hints, err.Error())
+			continue
+		case !fi.IsDir():
+			continue
+		}
+
+		checked++
+		if !writableBy(fi, uid, gid) {
+			r.Status = Fail
+			r.Hints = append(r.Hints, fmt.Sprintf("%s is not writable by UID %d. Run: sudo chown -R %d:%d %s", d.rel(path), uid, uid, gid, path))
+		}
+	}
+	r.Detail = fmt.Sprintf("%d writable bind mount(s) checked for UID %d", checked, uid)
+	return r
+}
+
+func writableBy(fi os.FileInfo, uid, gid int) bool {
+	if uid == 0 {
+		return true
+	}
+	mode := fi.Mode().Perm()
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return mode&0o002 != 0
+	}
+	switch {
+	case int(st.Uid) == uid:
+		return mode&0o200 != 0
+	case int(st.Gid) == gid:
+		return mode&0o020 != 0
+	}
+	return mode&0o002 != 0
+}
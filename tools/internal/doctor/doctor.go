@@ -0,0 +1,180 @@
+// Package doctor runs the preflight checks behind `doctor`: everything that
+// has to be true on a host before `docker compose up` can bring a runner
+// online, each reported with a remediation hint.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/subhead/github-runners/tools/internal/compose"
+	"github.com/subhead/github-runners/tools/internal/config"
+	"github.com/subhead/github-runners/tools/internal/docker"
+	"github.com/subhead/github-runners/tools/internal/dockerlint"
+	"github.com/subhead/github-runners/tools/internal/github"
+)
+
+// Status of a check.
+type Status int
+
+const (
+	OK Status = iota
+	Skip
+	Warn
+	Fail
+)
+
+func (s Status) String() string {
+	return [...]string{"OK", "SKIP", "WARN", "FAIL"}[s]
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name   string
+	Status Status
+	Detail string
+	Hints  []string
+}
+
+// Options select what the checks look at.
+type Options struct {
+	Root        string // repository root
+	ComposeFile string
+	Service     string // defaults to the first runner service (one setting RUNNER_NAME) in ComposeFile
+	EnvFile     string // .env used with the compose file; optional
+	DockerHost  string // defaults to DOCKER_HOST
+	GitHubAPI   string // GitHub API base URL; point at a stub to test offline
+	Offline     bool   // skip the GitHub checks
+	MinFreeMB   int64  // workspace headroom on top of the image size
+}
+
+// Doctor holds the state shared between checks.
+type Doctor struct {
+	opts    Options
+	compose *compose.File
+	service *compose.Service
+	env     map[string]string // .env values overridden by the process environment
+	runner  map[string]string // the service's container environment, interpolated
+	entries []config.Entry
+
+	lint    *dockerlint.Linter
+	docker  *docker.Client
+	images  map[string]docker.Image
+	missing []string
+	runners []github.Runner
+	listed  bool
+}
+
+// New loads the compose file and .env for opts.
+func New(opts Options) (*Doctor, error) {
+	cf, err := compose.Load(opts.ComposeFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(cf.Services) == 0 {
+		return nil, fmt.Errorf("%s defines no services", opts.ComposeFile)
+	}
+
+	name := opts.Service
+	if name == "" {
+		name = runnerService(cf)
+	}
+	svc, ok := cf.Services[name]
+	if !ok {
+		return nil, fmt.Errorf("%s has no service %q (services: %s)", opts.ComposeFile, name, strings.Join(cf.ServiceNames(), ", "))
+	}
+
+	d := &Doctor{
+		opts:    opts,
+		compose: cf,
+		service: svc,
+		env:     map[string]string{},
+		runner:  map[string]string{},
+		images:  map[string]docker.Image{},
+	}
+
+	if opts.EnvFile != "" {
+		fh, err := os.Open(opts.EnvFile)
+		switch {
+		case os.IsNotExist(err):
+			d.opts.EnvFile = ""
+		case err != nil:
+			return nil, err
+		default:
+			d.entries, _ = config.ParseEnv(fh)
+			fh.Close()
+			for _, e := range d.entries {
+				d.env[e.Name] = e.Value
+			}
+		}
+	}
+	// docker compose prefers the shell environment over .env
+	for _, name := range config.Names() {
+		if v, ok := os.LookupEnv(name); ok {
+			d.env[name] = v
+		}
+	}
+
+	lookup := func(name string) (string, bool) {
+		v, ok := d.env[name]
+		return v, ok
+	}
+	for _, kv := range svc.Environment {
+		k, v, _ := strings.Cut(kv, "=")
+		d.runner[k] = compose.Interpolate(v, lookup)
+	}
+	svc.Image = compose.Interpolate(svc.Image, lookup)
+
+	d.lint, err = dockerlint.Load(opts.Root, "docker/linux")
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// runnerService picks the first service that configures a runner, skipping
+// helpers such as docker-proxy.
+func runnerService(cf *compose.File) string {
+	for _, name := range cf.ServiceNames() {
+		for _, kv := range cf.Services[name].Environment {
+			if strings.HasPrefix(kv, "RUNNER_NAME=") {
+				return name
+			}
+		}
+	}
+	return cf.ServiceNames()[0]
+}
+
+// Service returns the name of the service being checked.
+func (d *Doctor) Service() string {
+	return d.service.Name
+}
+
+// Run executes every check in order.
+func (d *Doctor) Run(ctx context.Context) []Result {
+	checks := []func(context.Context) Result{
+		d.checkConfig,
+		d.checkDocker,
+		d.checkImages,
+		d.checkDisk,
+		d.checkToken,
+		d.checkRunnerName,
+		d.checkMounts,
+	}
+	results := make([]Result, 0, len(checks))
+	for _, check := range checks {
+		results = append(results, check(ctx))
+	}
+	return results
+}
+
+// rel returns path relative to the repository root for messages.
+func (d *Doctor) rel(path string) string {
+	if r, err := filepath.Rel(d.opts.Root, path); err == nil && !strings.HasPrefix(r, "..") {
+		return r
+	}
+	return path
+}
@@ -0,0 +1,256 @@
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// files is a repository with a two-service stack whose runner image copies
+// from one language pack.
+var files = map[string]string{
+	"docker-compose/linux-test.yml": `services:
+  docker-proxy:
+    image: gh-runner:docker-proxy
+  test-runner:
+    build:
+      context: ../
+      dockerfile: docker/linux/composite/Dockerfile.test
+    image: gh-runner:test
+    environment:
+      - GITHUB_TOKEN=${GITHUB_TOKEN}
+      - GITHUB_REPOSITORY=${GITHUB_REPOSITORY}
+      - RUNNER_NAME=${RUNNER_NAME:-test-runner-01}
+      - RUNNER_REPLACE_EXISTING=${RUNNER_REPLACE_EXISTING:-false}
+    volumes:
+      - ./data/test-runner:/actions-runner
+`,
+	"docker/linux/base/Dockerfile":                 "FROM ubuntu:22.04\nUSER runner\n",
+	"docker/linux/language-packs/go/Dockerfile.go": "# Size: ~1.5 GB\nFROM gh-runner:linux-base AS go-pack\n",
+	"docker/linux/composite/Dockerfile.test":       "FROM gh-runner:linux-base\nCOPY --from=gh-runner:go-pack /usr/local/go /usr/local/go\n",
+}
+
+func newTestDoctor(t *testing.T, env string, opts Options) *Doctor {
+	t.Helper()
+	root := t.TempDir()
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	envFile := filepath.Join(root, "docker-compose", ".env")
+	if err := os.WriteFile(envFile, []byte(env), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The shell environment wins over .env, so keep the test's own out
+	for _, name := range []string{"GITHUB_TOKEN", "GITHUB_TOKEN_FILE", "GITHUB_OWNER", "GITHUB_REPOSITORY", "RUNNER_NAME", "RUNNER_REPLACE_EXISTING"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	opts.Root = root
+	opts.ComposeFile = filepath.Join(root, "docker-compose", "linux-test.yml")
+	opts.EnvFile = envFile
+	d, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// githubStub answers /user with scopes (nil for a token without them) or
+// userStatus, and the repository's runner list with runners or runnersStatus.
+func githubStub(t *testing.T, userStatus int, scopes []string, runnersStatus int, runners string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user":
+			if userStatus != http.StatusOK {
+				w.WriteHeader(userStatus)
+				json.NewEncoder(w).Encode(map[string]string{"message": http.StatusText(userStatus)})
+				return
+			}
+			if scopes != nil {
+				w.Header().Set("X-OAuth-Scopes", strings.Join(scopes, ", "))
+			}
+			json.NewEncoder(w).Encode(map[string]string{"login": "octocat"})
+		case "/repos/o/r/actions/runners":
+			if runnersStatus != http.StatusOK {
+				w.WriteHeader(runnersStatus)
+				json.NewEncoder(w).Encode(map[string]string{"message": http.StatusText(runnersStatus)})
+				return
+			}
+			w.Write([]byte(runners))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestService(t *testing.T) {
+	d := newTestDoctor(t, "", Options{})
+	if got := d.Service(); got != "test-runner" {
+		t.Fatalf("Service() = %q, want the service that sets RUNNER_NAME", got)
+	}
+}
+
+func TestCheckToken(t *testing.T) {
+	const runners = `{"total_count":1,"runners":[{"id":7,"name":"other","status":"online"}]}`
+	tests := []struct {
+		name          string
+		env           string
+		userStatus    int
+		scopes        []string
+		runnersStatus int
+		want          Status
+		wantDetail    string
+	}{
+		{name: "classic token", env: "GITHUB_TOKEN=ghp_x\nGITHUB_REPOSITORY=o/r\n", userStatus: 200, scopes: []string{"repo", "workflow"}, runnersStatus: 200,
+			want: OK, wantDetail: "can manage runners for the repository o/r"},
+		{name: "fine-grained token", env: "GITHUB_TOKEN=github_pat_x\nGITHUB_REPOSITORY=o/r\n", userStatus: 200, runnersStatus: 200, want: OK},
+		{name: "installation token", env: "GITHUB_TOKEN=ghs_x\nGITHUB_REPOSITORY=o/r\n", userStatus: 403, runnersStatus: 200,
+			want: OK, wantDetail: "cannot read /user"},
+		{name: "revoked token", env: "GITHUB_TOKEN=ghp_x\nGITHUB_REPOSITORY=o/r\n", userStatus: 401, want: Fail, wantDetail: "token rejected"},
+		{name: "missing scope", env: "GITHUB_TOKEN=ghp_x\nGITHUB_REPOSITORY=o/r\n", userStatus: 200, scopes: []string{"read:org"}, want: Fail, wantDetail: "classic token scopes: read:org"},
+		{name: "no runner permission", env: "GITHUB_TOKEN=github_pat_x\nGITHUB_REPOSITORY=o/r\n", userStatus: 200, runnersStatus: 403, want: Fail, wantDetail: "cannot manage self-hosted runners"},
+		{name: "unknown repository", env: "GITHUB_TOKEN=ghp_x\nGITHUB_REPOSITORY=o/r\n", userStatus: 200, scopes: []string{"repo"}, runnersStatus: 404, want: Fail, wantDetail: "not found"},
+		{name: "no token", env: "GITHUB_REPOSITORY=o/r\n", want: Fail, wantDetail: "GITHUB_TOKEN is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := githubStub(t, tt.userStatus, tt.scopes, tt.runnersStatus, runners)
+			d := newTestDoctor(t, tt.env, Options{GitHubAPI: api})
+			r := d.checkToken(context.Background())
+			if r.Status != tt.want || !strings.Contains(r.Detail, tt.wantDetail) {
+				t.Fatalf("checkToken = %v %q, want %v with %q", r.Status, r.Detail, tt.want, tt.wantDetail)
+			}
+		})
+	}
+
+	t.Run("offline", func(t *testing.T) {
+		d := newTestDoctor(t, "GITHUB_TOKEN=ghp_x\n", Options{Offline: true})
+		if r := d.checkToken(context.Background()); r.Status != Skip {
+			t.Fatalf("checkToken = %v, want %v", r.Status, Skip)
+		}
+	})
+}
+
+func TestCheckRunnerName(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        string
+		runners    string
+		registered bool // the runner directory holds a registration
+		want       Status
+		wantDetail string
+	}{
+		{name: "new name", runners: `{"total_count":1,"runners":[{"id":7,"name":"other"}]}`, want: OK, wantDetail: "not registered yet"},
+		{name: "taken", runners: `{"total_count":1,"runners":[{"id":7,"name":"Test-Runner-01","status":"offline"}]}`, want: Fail, wantDetail: "already registered (id 7, offline)"},
+		{name: "replaced", env: "RUNNER_REPLACE_EXISTING=true\n", runners: `{"total_count":1,"runners":[{"id":7,"name":"test-runner-01","status":"online","busy":true}]}`,
+			want: Warn, wantDetail: "will replace it"},
+		{name: "reused", runners: `{"total_count":1,"runners":[{"id":7,"name":"test-runner-01","status":"offline"}]}`, registered: true,
+			want: OK, wantDetail: "will be reused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := githubStub(t, http.StatusOK, nil, http.StatusOK, tt.runners)
+			d := newTestDoctor(t, "GITHUB_TOKEN=github_pat_x\nGITHUB_REPOSITORY=o/r\n"+tt.env, Options{GitHubAPI: api})
+			if tt.registered {
+				dir := filepath.Join(d.opts.Root, "docker-compose", "data", "test-runner")
+				if err := os.MkdirAll(dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, ".runner"), []byte("{}"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if r := d.checkToken(context.Background()); r.Status != OK {
+				t.Fatalf("checkToken = %v %q", r.Status, r.Detail)
+			}
+			r := d.checkRunnerName(context.Background())
+			if r.Status != tt.want || !strings.Contains(r.Detail, tt.wantDetail) {
+				t.Fatalf("checkRunnerName = %v %q, want %v with %q", r.Status, r.Detail, tt.want, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestCheckImages(t *testing.T) {
+	older, newer := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		images   map[string]time.Time // gh-runner tag -> created
+		want     Status
+		wantHint string
+	}{
+		{name: "all built in order", images: map[string]time.Time{"linux-base": older, "go-pack": older, "test": newer}, want: OK},
+		{name: "pack missing", images: map[string]time.Time{"linux-base": older, "test": newer}, want: Fail,
+			wantHint: "docker build -f docker/linux/language-packs/go/Dockerfile.go -t gh-runner:go-pack ."},
+		{name: "pack rebuilt after the runner image", images: map[string]time.Time{"linux-base": older, "go-pack": newer, "test": older}, want: Warn,
+			wantHint: "gh-runner:go-pack was rebuilt after gh-runner:test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/_ping":
+					w.Write([]byte("OK"))
+				case r.URL.Path == "/version":
+					w.Write([]byte(`{"Version":"25.0.3","ApiVersion":"1.44"}`))
+				case strings.HasPrefix(r.URL.Path, "/images/gh-runner:"):
+					tag := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/images/gh-runner:"), "/json")
+					created, ok := tt.images[tag]
+					if !ok {
+						http.NotFound(w, r)
+						return
+					}
+					json.NewEncoder(w).Encode(map[string]any{"Id": "sha256:" + tag, "Created": created})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			t.Cleanup(daemon.Close)
+
+			d := newTestDoctor(t, "", Options{DockerHost: "tcp://" + strings.TrimPrefix(daemon.URL, "http://")})
+			if r := d.checkDocker(context.Background()); r.Status != OK {
+				t.Fatalf("checkDocker = %v %q", r.Status, r.Detail)
+			}
+			r := d.checkImages(context.Background())
+			if want := "build order: gh-runner:linux-base -> gh-runner:go-pack -> gh-runner:test"; r.Detail != want {
+				t.Fatalf("checkImages detail = %q, want %q", r.Detail, want)
+			}
+			if r.Status != tt.want || (tt.wantHint != "" && !strings.Contains(strings.Join(r.Hints, "\n"), tt.wantHint)) {
+				t.Fatalf("checkImages = %v %q, want %v with hint %q", r.Status, r.Hints, tt.want, tt.wantHint)
+			}
+		})
+	}
+}
+
+func TestParseMB(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+	}{
+		{"~600MB", 600},
+		{" ~1.5 GB (all toolchains)", 1536},
+		{"2GB", 2048},
+		{"small", 0},
+	}
+	for _, tt := range tests {
+		if got := parseMB(tt.s); got != tt.want {
+			t.Errorf("parseMB(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package egress
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// defaultPorts are the ports a rule without ":port" covers.
+var defaultPorts = []string{"80", "443"}
+
+type rule struct {
+	allow bool
+	host  string // path.Match pattern: "*.example.com" matches every subdomain
+	port  string // "" for defaultPorts, "*" for any
+}
+
+// Policy decides which hosts a runner's jobs may connect to. Deny rules win
+// over allow rules; a host no rule allows is refused.
+type Policy struct {
+	rules []rule
+}
+
+// LoadPolicy reads a policy file:
+//
+//	allow|deny <host>[:<port>]
+//	include <file>
+//
+// Host patterns use path.Match syntax, so "*.github.com" matches every
+// subdomain of github.com but not github.com itself. Without a port a rule
+// covers 80 and 443. Included files are relative to the including file.
+func LoadPolicy(file string) (*Policy, error) {
+	p := &Policy{}
+	if err := p.load(file, nil); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Policy) load(file string, stack []string) error {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	for _, f := range stack {
+		if f == abs {
+			return fmt.Errorf("%s: include cycle", file)
+		}
+	}
+	stack = append(stack, abs)
+
+	f, err := os.Open(abs)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: want \"allow|deny HOST[:PORT]\" or \"include FILE\"", file, n)
+		}
+		switch fields[0] {
+		case "include":
+			if err := p.load(filepath.Join(filepath.Dir(abs), fields[1]), stack); err != nil {
+				return err
+			}
+		case "allow", "deny":
+			if err := p.Add(fields[0] == "allow", fields[1]); err != nil {
+				return fmt.Errorf("%s:%d: %w", file, n, err)
+			}
+		default:
+			return fmt.Errorf("%s:%d: unknown directive %q", file, n, fields[0])
+		}
+	}
+	return scanner.Err()
+}
+
+// Add appends an allow or deny rule for HOST[:PORT].
+func (p *Policy) Add(allow bool, pattern string) error {
+	host, port := pattern, ""
+	if i := strings.LastIndexByte(pattern, ':'); i >= 0 {
+		host, port = pattern[:i], pattern[i+1:]
+		if port == "" {
+			return fmt.Errorf("empty port in %q", pattern)
+		}
+	}
+	host = normalizeHost(host)
+	if host == "" {
+		return fmt.Errorf("empty host in %q", pattern)
+	}
+	if _, err := path.Match(host, ""); err != nil {
+		return fmt.Errorf("bad host pattern %q: %w", pattern, err)
+	}
+	p.rules = append(p.rules, rule{allow: allow, host: host, port: port})
+	return nil
+}
+
+// Allows reports whether host:port may be reached, and if not, why.
+func (p *Policy) Allows(host, port string) (bool, string) {
+	host = normalizeHost(host)
+	allowed := false
+	for _, r := range p.rules {
+		if !r.matches(host, port) {
+			continue
+		}
+		if !r.allow {
+			return false, "denied by the egress policy"
+		}
+		allowed = true
+	}
+	if !allowed {
+		return false, "not in the egress policy"
+	}
+	return true, ""
+}
+
+func (r rule) matches(host, port string) bool {
+	if ok, _ := path.Match(r.host, host); !ok {
+		return false
+	}
+	switch r.port {
+	case "*":
+		return true
+	case "":
+		for _, p := range defaultPorts {
+			if p == port {
+				return true
+			}
+		}
+		return false
+	}
+	return r.port == port
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+}
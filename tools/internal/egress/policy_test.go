@@ -0,0 +1,79 @@
+package egress
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePolicy(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestPolicyAllows(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, "base.conf", "allow github.com\nallow *.github.com\n")
+	file := writePolicy(t, dir, "image.conf", `
+include base.conf
+allow pypi.org          # default ports
+allow files.example.com:8443
+allow registry.example.com:*
+deny  evil.github.com
+`)
+	p, err := LoadPolicy(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host, port string
+		want       bool
+	}{
+		{"github.com", "443", true},
+		{"api.github.com", "443", true},
+		{"GitHub.com.", "443", true},
+		{"notgithub.com", "443", false},
+		{"evil.github.com", "443", false},
+		{"pypi.org", "80", true},
+		{"pypi.org", "22", false},
+		{"files.example.com", "8443", true},
+		{"files.example.com", "443", false},
+		{"registry.example.com", "5000", true},
+		{"example.com", "443", false},
+	}
+	for _, tt := range tests {
+		if got, reason := p.Allows(tt.host, tt.port); got != tt.want {
+			t.Errorf("Allows(%s, %s) = %v (%s), want %v", tt.host, tt.port, got, reason, tt.want)
+		}
+	}
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown directive", "permit github.com\n", "unknown directive"},
+		{"missing host", "allow\n", "want"},
+		{"empty port", "allow github.com:\n", "empty port"},
+		{"bad pattern", "allow git[hub.com\n", "bad host pattern"},
+		{"include cycle", "include policy.conf\n", "include cycle"},
+		{"missing include", "include nope.conf\n", "nope.conf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writePolicy(t, t.TempDir(), "policy.conf", tt.content)
+			_, err := LoadPolicy(file)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("LoadPolicy error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
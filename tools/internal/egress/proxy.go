@@ -0,0 +1,283 @@
+// Package egress is the forward proxy runners use for all outbound traffic.
+// Each listener belongs to one runner: CONNECT tunnels and plain HTTP
+// requests reach only the hosts the runner image's policy allows, never
+// loopback, private or link-local addresses, and every denied request is
+// logged with the runner and the job it was running.
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/subhead/github-runners/tools/internal/controltoken"
+)
+
+// maxDenied bounds the distinct denied targets remembered for one job.
+const maxDenied = 200
+
+// Proxy forwards one runner's outbound requests.
+type Proxy struct {
+	runner string
+	policy *Policy
+	token  string // control token for /job (see controltoken); empty disables it
+	log    *log.Logger
+	dialer *net.Dialer
+	proxy  *httputil.ReverseProxy
+
+	mu     sync.Mutex
+	job    string
+	denied map[string]*deniedTarget
+}
+
+type deniedTarget struct {
+	reason string
+	count  int
+}
+
+// deniedError is a connection the policy refuses, as opposed to a failed one.
+type deniedError string
+
+func (e deniedError) Error() string { return string(e) }
+
+// New returns a proxy for runner's jobs whose job endpoint takes token.
+func New(runner string, policy *Policy, token string, logger *log.Logger) (*Proxy, error) {
+	if runner == "" {
+		return nil, errors.New("proxy needs a runner name")
+	}
+	p := &Proxy{
+		runner: runner,
+		policy: policy,
+		token:  token,
+		log:    logger,
+		denied: map[string]*deniedTarget{},
+	}
+	p.dialer = &net.Dialer{
+		Timeout: 30 * time.Second,
+		// Checked after DNS resolution, so an allowed name that resolves to
+		// the metadata service or the host's network is refused too
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !public(ip) {
+				return deniedError(fmt.Sprintf("%s is not a public address", host))
+			}
+			return nil
+		},
+	}
+	p.proxy = &httputil.ReverseProxy{
+		// The request already carries the absolute URL of the origin server
+		Rewrite: func(r *httputil.ProxyRequest) {},
+		Transport: &http.Transport{
+			DialContext:           p.dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			p.fail(w, r.Method, hostPort(r.URL.Host, r.URL.Scheme), err)
+		},
+	}
+	return p, nil
+}
+
+// public reports whether ip is a globally routable unicast address.
+func public(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// ServeHTTP tunnels CONNECT requests, forwards absolute-URL requests and
+// answers the job endpoints for origin-form requests to the proxy itself.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodConnect:
+		p.tunnel(w, r)
+	case r.URL.IsAbs():
+		target := hostPort(r.URL.Host, r.URL.Scheme)
+		if !p.check(w, r.Method, target) {
+			return
+		}
+		p.proxy.ServeHTTP(w, r)
+	default:
+		p.control(w, r)
+	}
+}
+
+// check applies the policy to target and answers 403 if it is refused.
+func (p *Proxy) check(w http.ResponseWriter, method, target string) bool {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		http.Error(w, "egress proxy: bad target "+target, http.StatusBadRequest)
+		return false
+	}
+	if ok, reason := p.policy.Allows(host, port); !ok {
+		p.fail(w, method, target, deniedError(reason))
+		return false
+	}
+	return true
+}
+
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	target := r.Host
+	if !p.check(w, r.Method, target) {
+		return
+	}
+
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", target)
+	if err != nil {
+		p.fail(w, r.Method, target, err)
+		return
+	}
+	defer upstream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "egress proxy: cannot tunnel this connection", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// Anything the client sent after the CONNECT headers is already buffered
+		_, _ = io.Copy(upstream, buffered)
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, upstream)
+		closeWrite(client)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+func closeWrite(c net.Conn) {
+	if tcp, ok := c.(interface{ CloseWrite() error }); ok {
+		_ = tcp.CloseWrite()
+	}
+}
+
+// fail answers a request the proxy could not complete and remembers denials
+// for the running job.
+func (p *Proxy) fail(w http.ResponseWriter, method, target string, err error) {
+	var denied deniedError
+	if !errors.As(err, &denied) {
+		p.log.Printf("runner=%s job=%q ERROR %s %s: %v", p.runner, p.currentJob(), method, target, err)
+		http.Error(w, "egress proxy: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	p.mu.Lock()
+	job := p.job
+	if d, ok := p.denied[target]; ok {
+		d.count++
+	} else if len(p.denied) < maxDenied {
+		p.denied[target] = &deniedTarget{reason: string(denied), count: 1}
+	}
+	p.mu.Unlock()
+
+	p.log.Printf("runner=%s job=%q DENY %s %s: %s", p.runner, job, method, target, denied)
+	http.Error(w, fmt.Sprintf("egress proxy: %s: %s (runner %s)", target, denied, p.runner), http.StatusForbidden)
+}
+
+func (p *Proxy) currentJob() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.job
+}
+
+// control serves the job endpoints the runner's supervisor calls for its
+// hooks, with the control token:
+//
+//	PUT /job     start attributing requests to the job named in the body
+//	DELETE /job  end the job and return what was denied, one target per line
+func (p *Proxy) control(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/job" {
+		http.Error(w, "egress proxy: only CONNECT and absolute-URL requests are proxied", http.StatusBadRequest)
+		return
+	}
+	if !controltoken.Authorized(r, p.token) {
+		http.Error(w, "egress proxy: the job endpoint needs the control token", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(r.Body, 512))
+		if err != nil {
+			http.Error(w, "egress proxy: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		job := strings.Join(strings.Fields(strings.Map(printable, string(body))), " ")
+		p.mu.Lock()
+		p.job = job
+		p.denied = map[string]*deniedTarget{}
+		p.mu.Unlock()
+		p.log.Printf("runner=%s job=%q START", p.runner, job)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		p.mu.Lock()
+		job, denied := p.job, p.denied
+		p.job, p.denied = "", map[string]*deniedTarget{}
+		p.mu.Unlock()
+
+		targets := make([]string, 0, len(denied))
+		for t := range denied {
+			targets = append(targets, t)
+		}
+		sort.Strings(targets)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, t := range targets {
+			fmt.Fprintf(w, "%s (%d request(s)): %s\n", t, denied[t].count, denied[t].reason)
+		}
+		p.log.Printf("runner=%s job=%q END %d denied target(s)", p.runner, job, len(targets))
+	default:
+		w.Header().Set("Allow", "PUT, DELETE")
+		http.Error(w, "egress proxy: method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func printable(r rune) rune {
+	if r < ' ' || r == 0x7f {
+		return ' '
+	}
+	return r
+}
+
+// hostPort adds the scheme's default port to host if it has none.
+func hostPort(host, scheme string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	port := "80"
+	if scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
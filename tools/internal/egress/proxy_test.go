@@ -0,0 +1,159 @@
+package egress
+
+import (
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testToken = "control-token"
+
+func newTestProxy(t *testing.T, rules ...string) *Proxy {
+	t.Helper()
+	policy := &Policy{}
+	for _, rule := range rules {
+		allow, pattern, _ := strings.Cut(rule, " ")
+		if err := policy.Add(allow == "allow", pattern); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := New("runner-1", policy, testToken, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// serve sends one request straight to the proxy's handler.
+func serve(p *Proxy, method, target, body, auth string) (int, string) {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if method == http.MethodConnect {
+		r.Host = target
+		r.URL.Host = target
+	}
+	if auth != "" {
+		r.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	return w.Code, w.Body.String()
+}
+
+func TestJobEndpoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		auth   string
+		want   int
+	}{
+		{name: "start", method: http.MethodPut, path: "/job", auth: "Bearer " + testToken, want: http.StatusNoContent},
+		{name: "end", method: http.MethodDelete, path: "/job", auth: "Bearer " + testToken, want: http.StatusOK},
+		{name: "start without token", method: http.MethodPut, path: "/job", want: http.StatusForbidden},
+		{name: "end without token", method: http.MethodDelete, path: "/job", want: http.StatusForbidden},
+		{name: "end with wrong token", method: http.MethodDelete, path: "/job", auth: "Bearer guess", want: http.StatusForbidden},
+		{name: "other method", method: http.MethodGet, path: "/job", auth: "Bearer " + testToken, want: http.StatusMethodNotAllowed},
+		{name: "other path", method: http.MethodGet, path: "/", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProxy(t)
+			if status, body := serve(p, tt.method, tt.path, "o/r run 1 job build", tt.auth); status != tt.want {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.path, status, body, tt.want)
+			}
+		})
+	}
+
+	t.Run("no token configured", func(t *testing.T) {
+		p, err := New("runner-1", &Policy{}, "", log.New(io.Discard, "", 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status, body := serve(p, http.MethodDelete, "/job", "", "Bearer "); status != http.StatusForbidden {
+			t.Fatalf("DELETE /job = %d %s, want 403", status, body)
+		}
+	})
+}
+
+func TestPolicyEnforced(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "reached")
+	}))
+	t.Cleanup(upstream.Close)
+	_, upstreamPort, _ := net.SplitHostPort(strings.TrimPrefix(upstream.URL, "http://"))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   string // substring of the 403 answer
+	}{
+		{name: "denied host", method: http.MethodGet, target: "http://denied.example.com/", want: "not in the egress policy"},
+		{name: "denied by rule", method: http.MethodGet, target: "http://blocked.example.org/", want: "denied by the egress policy"},
+		{name: "denied tunnel", method: http.MethodConnect, target: "denied.example.com:443", want: "not in the egress policy"},
+		{name: "allowed host on another port", method: http.MethodConnect, target: "allowed.example.org:22", want: "not in the egress policy"},
+		{name: "allowed address that is not public", method: http.MethodGet, target: upstream.URL + "/", want: "not a public address"},
+		{name: "allowed tunnel to an address that is not public", method: http.MethodConnect, target: "127.0.0.1:" + upstreamPort, want: "not a public address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProxy(t, "allow *.example.org", "deny blocked.example.org", "allow 127.0.0.1:*")
+			status, body := serve(p, tt.method, tt.target, "", "")
+			if status != http.StatusForbidden || !strings.Contains(body, tt.want) {
+				t.Fatalf("%s %s = %d %q, want 403 with %q", tt.method, tt.target, status, body, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeniedReport(t *testing.T) {
+	p := newTestProxy(t, "allow github.com")
+	control := "Bearer " + testToken
+
+	serve(p, http.MethodGet, "http://before.example.com/", "", "")
+	if status, body := serve(p, http.MethodPut, "/job", "o/r run 1 job build", control); status != http.StatusNoContent {
+		t.Fatalf("start = %d %s", status, body)
+	}
+	serve(p, http.MethodConnect, "denied.example.com:443", "", "")
+	serve(p, http.MethodConnect, "denied.example.com:443", "", "")
+	serve(p, http.MethodGet, "http://other.example.com/", "", "")
+
+	status, body := serve(p, http.MethodDelete, "/job", "", control)
+	want := "denied.example.com:443 (2 request(s)): not in the egress policy\n" +
+		"other.example.com:80 (1 request(s)): not in the egress policy\n"
+	if status != http.StatusOK || body != want {
+		t.Fatalf("end = %d %q, want 200 %q", status, body, want)
+	}
+	if _, body = serve(p, http.MethodDelete, "/job", "", control); body != "" {
+		t.Fatalf("second end = %q, want an empty report", body)
+	}
+}
+
+func TestPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"140.82.112.3", true},
+		{"2606:50c0:8000::153", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.17.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := public(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("public(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
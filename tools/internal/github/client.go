@@ -0,0 +1,142 @@
+// Package github is a minimal GitHub REST client for the self-hosted runner
+// endpoints the tools need. BaseURL can point at a stub server for testing.
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the public GitHub API.
+const DefaultBaseURL = "https://api.github.com"
+
+// Client calls the GitHub API with one token.
+type Client struct {
+	BaseURL string
+	Token   string
+	HTTP    *http.Client
+}
+
+// NewClient returns a client for baseURL (DefaultBaseURL when empty).
+func NewClient(baseURL, token string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Token:   token,
+		HTTP:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// APIError is a non-2xx response.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("GitHub API %d: %s", e.Status, e.Message)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, out any) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+c.Token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var body struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &body) != nil || body.Message == "" {
+			body.Message = resp.Status
+		}
+		return resp.Header, &APIError{Status: resp.StatusCode, Message: body.Message}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.Header, err
+		}
+	}
+	return resp.Header, nil
+}
+
+// User is the authenticated account and the scopes of a classic token.
+type User struct {
+	Login string
+	// Scopes is nil for fine-grained and installation tokens, which do not
+	// report scopes
+	Scopes []string
+}
+
+// User returns the account the token belongs to.
+func (c *Client) User(ctx context.Context) (User, error) {
+	var body struct {
+		Login string `json:"login"`
+	}
+	header, err := c.do(ctx, http.MethodGet, "/user", &body)
+	if err != nil {
+		return User{}, err
+	}
+
+	u := User{Login: body.Login}
+	if raw, ok := header["X-Oauth-Scopes"]; ok {
+		u.Scopes = []string{}
+		for _, s := range strings.Split(strings.Join(raw, ","), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				u.Scopes = append(u.Scopes, s)
+			}
+		}
+	}
+	return u, nil
+}
+
+// Runner is a registered self-hosted runner.
+type Runner struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"` // online or offline
+	Busy   bool   `json:"busy"`
+}
+
+// RunnersPath returns the API path of the runners of a repository
+// ("owner/repo") or, when repository is empty, of an organization.
+func RunnersPath(repository, owner string) string {
+	if repository != "" {
+		return "/repos/" + repository + "/actions/runners"
+	}
+	return "/orgs/" + owner + "/actions/runners"
+}
+
+// Runners lists every runner registered under path (see RunnersPath).
+func (c *Client) Runners(ctx context.Context, path string) ([]Runner, error) {
+	var runners []Runner
+	for page := 1; ; page++ {
+		var body struct {
+			TotalCount int      `json:"total_count"`
+			Runners    []Runner `json:"runners"`
+		}
+		if _, err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s?per_page=100&page=%d", path, page), &body); err != nil {
+			return nil, err
+		}
+		runners = append(runners, body.Runners...)
+		if len(body.Runners) == 0 || len(runners) >= body.TotalCount {
+			return runners, nil
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		scopes     []string // X-OAuth-Scopes values, nil for no header
+		status     int
+		wantScopes []string
+		wantStatus int // APIError status, 0 for success
+	}{
+		{name: "classic token", scopes: []string{"repo, admin:org"}, status: 200, wantScopes: []string{"repo", "admin:org"}},
+		{name: "classic token without scopes", scopes: []string{""}, status: 200, wantScopes: []string{}},
+		{name: "fine-grained token", status: 200},
+		{name: "bad credentials", status: 401, wantStatus: 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "token secret" {
+					t.Errorf("Authorization = %q", got)
+				}
+				for _, s := range tt.scopes {
+					w.Header().Add("X-OAuth-Scopes", s)
+				}
+				w.WriteHeader(tt.status)
+				if tt.status == 200 {
+					fmt.Fprint(w, `{"login":"octocat"}`)
+				} else {
+					fmt.Fprint(w, `{"message":"Bad credentials"}`)
+				}
+			}))
+			defer srv.Close()
+
+			u, err := NewClient(srv.URL+"/", "secret").User(context.Background())
+			var apiErr *APIError
+			switch {
+			case tt.wantStatus != 0:
+				if !errors.As(err, &apiErr) || apiErr.Status != tt.wantStatus || apiErr.Message != "Bad credentials" {
+					t.Fatalf("User error = %v, want API error %d", err, tt.wantStatus)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case u.Login != "octocat" || !reflect.DeepEqual(u.Scopes, tt.wantScopes):
+				t.Fatalf("User = %+v, want scopes %#v", u, tt.wantScopes)
+			}
+		})
+	}
+}
+
+func TestRunnersPages(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/orgs/acme/actions/runners" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Query().Get("page") {
+		case "1":
+			fmt.Fprint(w, `{"total_count":3,"runners":[{"id":1,"name":"a"},{"id":2,"name":"b"}]}`)
+		case "2":
+			fmt.Fprint(w, `{"total_count":3,"runners":[{"id":3,"name":"c","status":"online","busy":true}]}`)
+		default:
+			t.Errorf("unexpected page %s", r.URL.Query().Get("page"))
+			fmt.Fprint(w, `{"total_count":3,"runners":[]}`)
+		}
+	}))
+	defer srv.Close()
+
+	runners, err := NewClient(srv.URL, "secret").Runners(context.Background(), RunnersPath("", "acme"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Runner{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}, {ID: 3, Name: "c", Status: "online", Busy: true}}
+	if !reflect.DeepEqual(runners, want) {
+		t.Fatalf("Runners = %+v, want %+v", runners, want)
+	}
+}
+
+func TestRunnersPath(t *testing.T) {
+	if got := RunnersPath("o/r", "o"); got != "/repos/o/r/actions/runners" {
+		t.Errorf("repository path = %q", got)
+	}
+	if got := RunnersPath("", "o"); got != "/orgs/o/actions/runners" {
+		t.Errorf("organization path = %q", got)
+	}
+}
@@ -0,0 +1,90 @@
+// Package imagesize works out how much of a set of images is shared. Docker
+// stores a layer once however many images use it, and images only share
+// layers through a common base: an image built FROM another starts with all
+// of that image's layers. The bytes an image adds over the largest other
+// image it starts with are its own; everything else is already on disk.
+package imagesize
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Image is one local image and its layers, base first.
+type Image struct {
+	Name   string
+	ID     string
+	Size   int64
+	Layers []string
+}
+
+// Row is an image in a Report.
+type Row struct {
+	Image
+	// Base is the image whose layers this one starts with, "" for none
+	Base string
+	// Own is what the image adds on top of Base
+	Own int64
+}
+
+// Report is the result of Analyze.
+type Report struct {
+	Rows []Row
+	// Separate is the sum of the image sizes: the disk (and pull) cost if no
+	// layers were shared
+	Separate int64
+	// Stored is the sum of the own bytes: what the images take on disk
+	Stored int64
+}
+
+// Saved is the number of bytes layer sharing saves.
+func (r Report) Saved() int64 {
+	return r.Separate - r.Stored
+}
+
+// Analyze finds each image's base among images and what it adds. Tags of the
+// same image are counted once, under the first name.
+func Analyze(images []Image) Report {
+	var unique []Image
+	seen := map[string]bool{}
+	for _, img := range images {
+		if img.ID != "" && seen[img.ID] {
+			continue
+		}
+		seen[img.ID] = true
+		unique = append(unique, img)
+	}
+	// Bases first, so a row's base is listed above it
+	sort.SliceStable(unique, func(i, j int) bool { return len(unique[i].Layers) < len(unique[j].Layers) })
+
+	var r Report
+	for i, img := range unique {
+		row := Row{Image: img, Own: img.Size}
+		var base *Image
+		for j := range unique {
+			other := &unique[j]
+			if j == i || len(other.Layers) == 0 || len(other.Layers) >= len(img.Layers) || !slices.Equal(other.Layers, img.Layers[:len(other.Layers)]) {
+				continue
+			}
+			if base == nil || len(other.Layers) > len(base.Layers) {
+				base = other
+			}
+		}
+		if base != nil {
+			row.Base, row.Own = base.Name, img.Size-base.Size
+		}
+		r.Rows = append(r.Rows, row)
+		r.Separate += img.Size
+		r.Stored += row.Own
+	}
+	return r
+}
+
+// Format prints a byte count in MB below 1 GB, otherwise in GB.
+func Format(n int64) string {
+	if n < 1<<30 {
+		return fmt.Sprintf("%.0f MB", float64(n)/(1<<20))
+	}
+	return fmt.Sprintf("%.2f GB", float64(n)/(1<<30))
+}
@@ -0,0 +1,72 @@
+package imagesize
+
+import "testing"
+
+func TestAnalyze(t *testing.T) {
+	const mb = 1 << 20
+	base := Image{Name: "base", ID: "sha256:b", Size: 500 * mb, Layers: []string{"l1", "l2"}}
+	node := Image{Name: "node", ID: "sha256:n", Size: 700 * mb, Layers: []string{"l1", "l2", "n1"}}
+	full := Image{Name: "full", ID: "sha256:f", Size: 900 * mb, Layers: []string{"l1", "l2", "n1", "f1"}}
+	other := Image{Name: "other", ID: "sha256:o", Size: 100 * mb, Layers: []string{"x1"}}
+	forked := Image{Name: "forked", ID: "sha256:k", Size: 600 * mb, Layers: []string{"l1", "l2", "k1"}}
+	latest := base
+	latest.Name = "base:latest"
+
+	tests := []struct {
+		name      string
+		images    []Image
+		wantBases map[string]string // image name to its base
+		wantSaved int64
+	}{
+		{name: "unrelated", images: []Image{other, base},
+			wantBases: map[string]string{"other": "", "base": ""}},
+		{name: "one base", images: []Image{node, base},
+			wantBases: map[string]string{"base": "", "node": "base"}, wantSaved: 500 * mb},
+		{name: "largest base wins", images: []Image{full, base, node},
+			wantBases: map[string]string{"base": "", "node": "base", "full": "node"}, wantSaved: 500*mb + 700*mb},
+		{name: "siblings share only the base", images: []Image{base, node, forked},
+			wantBases: map[string]string{"base": "", "node": "base", "forked": "base"}, wantSaved: 2 * 500 * mb},
+		{name: "tags counted once", images: []Image{base, latest, node},
+			wantBases: map[string]string{"base": "", "node": "base"}, wantSaved: 500 * mb},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Analyze(tt.images)
+			if len(r.Rows) != len(tt.wantBases) {
+				t.Fatalf("Analyze = %d row(s), want %d", len(r.Rows), len(tt.wantBases))
+			}
+			listed := map[string]bool{}
+			for _, row := range r.Rows {
+				want, ok := tt.wantBases[row.Name]
+				if !ok || row.Base != want {
+					t.Errorf("%s base = %q, want %q", row.Name, row.Base, want)
+				}
+				if row.Base != "" && !listed[row.Base] {
+					t.Errorf("%s is listed above its base %s", row.Name, row.Base)
+				}
+				listed[row.Name] = true
+			}
+			if r.Saved() != tt.wantSaved {
+				t.Fatalf("Saved = %d, want %d", r.Saved(), tt.wantSaved)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 MB"},
+		{512 << 20, "512 MB"},
+		{1023 << 20, "1023 MB"},
+		{1 << 30, "1.00 GB"},
+		{5<<30 + 512<<20, "5.50 GB"},
+	}
+	for _, tt := range tests {
+		if got := Format(tt.n); got != tt.want {
+			t.Errorf("Format(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+// Package pkgcache is the caching proxy runners fetch packages through.
+// Each registry is served under its own path prefix (/pypi/, /npm/, /go/,
+// /gems/, /pub/) of one endpoint. Published artifacts are kept on disk for
+// good, metadata is refetched after a TTL and served stale while the
+// registry is unreachable, and the least recently used files are evicted
+// once the cache outgrows its size limit.
+package pkgcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Options configures a Cache.
+type Options struct {
+	Dir         string        // where responses are stored
+	MetadataTTL time.Duration // how long metadata is served without refetching
+	MaxBytes    int64         // size the cache is pruned to; 0 disables eviction
+	Logger      *log.Logger
+}
+
+// Cache serves registries from a disk cache, filling it from upstream.
+type Cache struct {
+	opts       Options
+	registries map[string]*Registry
+	client     *http.Client
+
+	hits, misses, stale, errors atomic.Int64
+}
+
+// meta is stored next to every cached body.
+type meta struct {
+	URL         string    `json:"url"`
+	ContentType string    `json:"content_type"`
+	Fetched     time.Time `json:"fetched"`
+}
+
+// New returns a cache for registries, creating its directory.
+func New(registries []*Registry, opts Options) (*Cache, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("cache needs a directory")
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		opts:       opts,
+		registries: map[string]*Registry{},
+		client: &http.Client{
+			Timeout: 10 * time.Minute,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				ForceAttemptHTTP2:   true,
+				MaxIdleConnsPerHost: 16,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+		},
+	}
+	for _, r := range registries {
+		c.registries[r.Name] = r
+	}
+	return c, nil
+}
+
+// ServeHTTP answers /<registry>/<path> from the cache or the registry, plus
+// /healthz and /stats.
+func (c *Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/healthz":
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case "/stats":
+		c.serveStats(w)
+		return
+	}
+
+	name, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	reg, ok := c.registries[name]
+	if !ok {
+		http.Error(w, "package cache: unknown registry "+name, http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		// Searches, audits and publishes are not cacheable; pass them on
+		c.forward(w, r, reg, "/"+rest)
+		return
+	}
+	c.serve(w, r, reg, "/"+rest)
+}
+
+func (c *Cache) serve(w http.ResponseWriter, r *http.Request, reg *Registry, p string) {
+	upstream := reg.Origin.JoinPath(p)
+	upstream.RawQuery = r.URL.RawQuery
+	// npm and PyPI answer the same URL in different formats by Accept
+	key := cacheKey(reg.Name, upstream.String(), r.Header.Get("Accept"))
+	immutable := reg.Immutable(p)
+
+	m, body, err := c.lookup(key)
+	fresh := err == nil && (immutable || time.Since(m.Fetched) < c.opts.MetadataTTL)
+	if fresh {
+		c.hits.Add(1)
+		c.touch(key)
+		c.respond(w, r, reg, m, body, "HIT")
+		return
+	}
+
+	fetched, fetchErr := c.fetch(r, upstream.String(), key)
+	var status statusError
+	clientError := errors.As(fetchErr, &status) && status < 500
+	switch {
+	case fetchErr == nil:
+		c.misses.Add(1)
+		m, body, err = c.lookup(key)
+		if err == nil {
+			c.respond(w, r, reg, fetched, body, "MISS")
+			return
+		}
+		fetchErr = err
+	case err == nil && !clientError:
+		// The registry is down or erroring: old metadata beats none
+		c.stale.Add(1)
+		c.opts.Logger.Printf("STALE %s %s: %v", reg.Name, p, fetchErr)
+		c.respond(w, r, reg, m, body, "STALE")
+		return
+	}
+
+	if errors.As(fetchErr, &status) {
+		http.Error(w, fmt.Sprintf("package cache: %s answered %d", upstream.Host, int(status)), int(status))
+		return
+	}
+	c.errors.Add(1)
+	c.opts.Logger.Printf("ERROR %s %s: %v", reg.Name, p, fetchErr)
+	http.Error(w, "package cache: "+fetchErr.Error(), http.StatusBadGateway)
+}
+
+// statusError is a non-200 answer from the registry, passed on to the client.
+type statusError int
+
+func (e statusError) Error() string { return "upstream answered " + strconv.Itoa(int(e)) }
+
+// fetch downloads url into the cache under key.
+func (c *Cache) fetch(r *http.Request, url, key string) (meta, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		return meta{}, err
+	}
+	for _, h := range []string{"Accept", "User-Agent", "Npm-Command"} {
+		if v := r.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return meta{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return meta{}, statusError(resp.StatusCode)
+	}
+
+	bodyPath, metaPath := c.paths(key)
+	if err := os.MkdirAll(filepath.Dir(bodyPath), 0o755); err != nil {
+		return meta{}, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(bodyPath), ".fetch-*")
+	if err != nil {
+		return meta{}, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return meta{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return meta{}, err
+	}
+
+	m := meta{URL: url, ContentType: resp.Header.Get("Content-Type"), Fetched: time.Now()}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return meta{}, err
+	}
+	if err := os.WriteFile(metaPath, data, 0o644); err != nil {
+		return meta{}, err
+	}
+	// Concurrent fetches of one key each rename a complete file into place
+	if err := os.Rename(tmp.Name(), bodyPath); err != nil {
+		return meta{}, err
+	}
+	return m, nil
+}
+
+// forward passes a request the cache does not store straight to the registry.
+func (c *Cache) forward(w http.ResponseWriter, r *http.Request, reg *Registry, p string) {
+	upstream := reg.Origin.JoinPath(p)
+	upstream.RawQuery = r.URL.RawQuery
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, upstream.String(), r.Body)
+	if err != nil {
+		http.Error(w, "package cache: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Header = r.Header.Clone()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.errors.Add(1)
+		http.Error(w, "package cache: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// respond writes a cached body, pointing URLs in metadata back at this cache.
+func (c *Cache) respond(w http.ResponseWriter, r *http.Request, reg *Registry, m meta, body *os.File, result string) {
+	defer body.Close()
+	w.Header().Set("X-Cache", result)
+	if m.ContentType != "" {
+		w.Header().Set("Content-Type", m.ContentType)
+	}
+
+	if len(reg.Rewrite) == 0 || reg.Immutable(strings.TrimPrefix(r.URL.Path, "/"+reg.Name)) {
+		if info, err := body.Stat(); err == nil {
+			w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		}
+		if r.Method != http.MethodHead {
+			_, _ = io.Copy(w, body)
+		}
+		return
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, "package cache: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	base := "http://" + r.Host
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		base = proto + "://" + r.Host
+	}
+	text := string(data)
+	for origin, name := range reg.Rewrite {
+		text = strings.ReplaceAll(text, origin, base+"/"+name+"/")
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(text)))
+	if r.Method != http.MethodHead {
+		_, _ = io.WriteString(w, text)
+	}
+}
+
+func cacheKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// paths returns where a key's body and metadata are stored, fanned out over
+// 256 directories.
+func (c *Cache) paths(key string) (body, meta string) {
+	base := filepath.Join(c.opts.Dir, key[:2], key)
+	return base, base + ".json"
+}
+
+func (c *Cache) lookup(key string) (meta, *os.File, error) {
+	bodyPath, metaPath := c.paths(key)
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return meta{}, nil, err
+	}
+	var m meta
+	if err := json.Unmarshal(data, &m); err != nil {
+		return meta{}, nil, err
+	}
+	body, err := os.Open(bodyPath)
+	if err != nil {
+		return meta{}, nil, err
+	}
+	return m, body, nil
+}
+
+// touch records a hit; eviction removes the least recently used files first.
+func (c *Cache) touch(key string) {
+	bodyPath, _ := c.paths(key)
+	now := time.Now()
+	_ = os.Chtimes(bodyPath, now, now)
+}
+
+func (c *Cache) serveStats(w http.ResponseWriter) {
+	size, files := c.usage()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int64{
+		"hits":      c.hits.Load(),
+		"misses":    c.misses.Load(),
+		"stale":     c.stale.Load(),
+		"errors":    c.errors.Load(),
+		"files":     files,
+		"bytes":     size,
+		"max_bytes": c.opts.MaxBytes,
+	})
+}
+
+type cachedFile struct {
+	path string
+	size int64
+	used time.Time
+}
+
+// files lists the cached bodies.
+func (c *Cache) files() []cachedFile {
+	var out []cachedFile
+	_ = filepath.WalkDir(c.opts.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(p, ".json") || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			out = append(out, cachedFile{path: p, size: info.Size(), used: info.ModTime()})
+		}
+		return nil
+	})
+	return out
+}
+
+func (c *Cache) usage() (size, count int64) {
+	for _, f := range c.files() {
+		size += f.size
+		count++
+	}
+	return size, count
+}
+
+// Evict removes the least recently used files until the cache fits in
+// MaxBytes, and returns how many it removed.
+func (c *Cache) Evict() int {
+	if c.opts.MaxBytes <= 0 {
+		return 0
+	}
+	files := c.files()
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].used.Before(files[j].used) })
+
+	removed := 0
+	for _, f := range files {
+		if total <= c.opts.MaxBytes {
+			break
+		}
+		if os.Remove(f.path) == nil {
+			_ = os.Remove(f.path + ".json")
+			total -= f.size
+			removed++
+		}
+	}
+	if removed > 0 {
+		c.opts.Logger.Printf("EVICT %d file(s), %d bytes left (limit %d)", removed, total, c.opts.MaxBytes)
+	}
+	return removed
+}
@@ -0,0 +1,234 @@
+package pkgcache
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// upstream is a registry that counts requests and can be made to fail.
+type upstream struct {
+	*httptest.Server
+	requests atomic.Int64
+	status   atomic.Int64 // answer with this status instead when set
+}
+
+func newUpstream(t *testing.T) *upstream {
+	t.Helper()
+	u := &upstream{}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.requests.Add(1)
+		if status := u.status.Load(); status != 0 {
+			w.WriteHeader(int(status))
+			return
+		}
+		switch {
+		case r.URL.Path == "/missing":
+			http.NotFound(w, r)
+		case r.Method == http.MethodPost:
+			body, _ := io.ReadAll(r.Body)
+			fmt.Fprintf(w, "posted %s", body)
+		case strings.HasSuffix(r.URL.Path, ".tgz"):
+			w.Header().Set("Content-Type", "application/octet-stream")
+			fmt.Fprintf(w, "tarball %s", r.URL.Path)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"n":%d,"tarball":"%s/pkg/-/pkg-1.0.0.tgz"}`, u.requests.Load(), u.URL)
+		}
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+func newTestCache(t *testing.T, u *upstream, ttl time.Duration) *httptest.Server {
+	t.Helper()
+	reg := &Registry{
+		Name:      "npm",
+		Origin:    mustParse(u.URL + "/"),
+		Immutable: func(p string) bool { return strings.Contains(p, "/-/") && hasSuffix(p, ".tgz") },
+		Rewrite:   map[string]string{u.URL + "/": "npm"},
+	}
+	c, err := New([]*Registry{reg}, Options{Dir: t.TempDir(), MetadataTTL: ttl, Logger: log.New(io.Discard, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, method, url string) (int, string, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header.Get("X-Cache"), string(body)
+}
+
+func TestServe(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		ttl        time.Duration
+		down       bool // the registry fails before the second request
+		wantSecond string
+		wantCalls  int64 // upstream requests for both
+	}{
+		{name: "metadata within the TTL", path: "/npm/pkg", ttl: time.Hour, wantSecond: "HIT", wantCalls: 1},
+		{name: "metadata after the TTL", path: "/npm/pkg", wantSecond: "MISS", wantCalls: 2},
+		{name: "stale metadata while the registry is down", path: "/npm/pkg", down: true, wantSecond: "STALE", wantCalls: 2},
+		{name: "tarball after the TTL", path: "/npm/pkg/-/pkg-1.0.0.tgz", wantSecond: "HIT", wantCalls: 1},
+		{name: "tarball while the registry is down", path: "/npm/pkg/-/pkg-1.0.0.tgz", down: true, wantSecond: "HIT", wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newUpstream(t)
+			srv := newTestCache(t, u, tt.ttl)
+
+			status, cache, first := get(t, http.MethodGet, srv.URL+tt.path)
+			if status != http.StatusOK || cache != "MISS" {
+				t.Fatalf("first GET = %d %s", status, cache)
+			}
+			if tt.down {
+				u.status.Store(http.StatusServiceUnavailable)
+			}
+			status, cache, second := get(t, http.MethodGet, srv.URL+tt.path)
+			if status != http.StatusOK || cache != tt.wantSecond {
+				t.Fatalf("second GET = %d %s, want 200 %s", status, cache, tt.wantSecond)
+			}
+			if tt.wantSecond != "MISS" && second != first {
+				t.Fatalf("second GET = %q, want the cached %q", second, first)
+			}
+			if got := u.requests.Load(); got != tt.wantCalls {
+				t.Fatalf("upstream saw %d request(s), want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestServeRewrite(t *testing.T) {
+	u := newUpstream(t)
+	srv := newTestCache(t, u, time.Hour)
+
+	_, _, body := get(t, http.MethodGet, srv.URL+"/npm/pkg")
+	if want := `"tarball":"` + srv.URL + `/npm/pkg/-/pkg-1.0.0.tgz"`; !strings.Contains(body, want) {
+		t.Fatalf("metadata = %s, want the tarball URL pointing at the cache (%s)", body, want)
+	}
+	_, _, body = get(t, http.MethodGet, srv.URL+"/npm/pkg/-/pkg-1.0.0.tgz")
+	if body != "tarball /pkg/-/pkg-1.0.0.tgz" {
+		t.Fatalf("tarball = %q", body)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	u := newUpstream(t)
+	srv := newTestCache(t, u, time.Hour)
+
+	tests := []struct {
+		name, method, path string
+		want               int
+		wantBody           string
+	}{
+		{name: "unknown registry", method: http.MethodGet, path: "/maven/x", want: http.StatusNotFound},
+		{name: "missing package", method: http.MethodGet, path: "/npm/missing", want: http.StatusNotFound},
+		{name: "publish is forwarded", method: http.MethodPost, path: "/npm/-/v1/search", want: http.StatusOK, wantBody: "posted data"},
+		{name: "health", method: http.MethodGet, path: "/healthz", want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := get(t, tt.method, srv.URL+tt.path)
+			if status != tt.want || !strings.Contains(body, tt.wantBody) {
+				t.Fatalf("%s %s = %d %q, want %d %q", tt.method, tt.path, status, body, tt.want, tt.wantBody)
+			}
+		})
+	}
+
+	// A missing package is not cached as the registry's error
+	get(t, http.MethodGet, srv.URL+"/npm/missing")
+	if got := u.requests.Load(); got != 3 {
+		t.Fatalf("upstream saw %d request(s), want 3", got)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(nil, Options{Dir: dir, MaxBytes: 10, Logger: log.New(io.Discard, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, key := range []string{"aa01", "bb02", "cc03"} {
+		body, metaPath := c.paths(key)
+		if err := os.MkdirAll(dir+"/"+key[:2], 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(body, []byte("12345"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(metaPath, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		used := now.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(body, used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if removed := c.Evict(); removed != 1 {
+		t.Fatalf("Evict removed %d file(s), want 1", removed)
+	}
+	for key, want := range map[string]bool{"aa01": false, "bb02": true, "cc03": true} {
+		body, metaPath := c.paths(key)
+		if _, err := os.Stat(body); (err == nil) != want {
+			t.Errorf("%s kept = %v, want %v", key, err == nil, want)
+		}
+		if _, err := os.Stat(metaPath); (err == nil) != want {
+			t.Errorf("%s metadata kept = %v, want %v", key, err == nil, want)
+		}
+	}
+}
+
+func TestRegistriesImmutable(t *testing.T) {
+	registries := map[string]*Registry{}
+	for _, r := range Registries() {
+		registries[r.Name] = r
+	}
+	tests := []struct {
+		registry, path string
+		want           bool
+	}{
+		{"pypi", "/simple/requests/", false},
+		{"pypi-files", "/packages/ab/cd/requests-2.32.3-py3-none-any.whl", true},
+		{"npm", "/left-pad", false},
+		{"npm", "/left-pad/-/left-pad-1.3.0.tgz", true},
+		{"npm", "/@types%2fnode", false},
+		{"go", "/golang.org/x/mod/@v/list", false},
+		{"go", "/golang.org/x/mod/@latest", false},
+		{"go", "/golang.org/x/mod/@v/v0.20.0.zip", true},
+		{"go", "/golang.org/x/mod/@v/v0.20.0.mod", true},
+		{"gems", "/api/v1/dependencies", false},
+		{"gems", "/gems/rake-13.2.1.gem", true},
+		{"gems", "/quick/Marshal.4.8/rake-13.2.1.gemspec.rz", true},
+		{"pub", "/api/packages/http", false},
+		{"pub", "/api/archives/http-1.2.2.tar.gz", true},
+	}
+	for _, tt := range tests {
+		if got := registries[tt.registry].Immutable(tt.path); got != tt.want {
+			t.Errorf("%s Immutable(%s) = %v, want %v", tt.registry, tt.path, got, tt.want)
+		}
+	}
+}
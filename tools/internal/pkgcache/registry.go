@@ -0,0 +1,92 @@
+package pkgcache
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Registry is one upstream the cache serves under /<Name>/.
+type Registry struct {
+	Name   string
+	Origin *url.URL
+
+	// Immutable reports whether a path (below the prefix) names content
+	// that never changes once published; it is cached without expiry.
+	// Everything else is metadata and is refetched after the TTL.
+	Immutable func(p string) bool
+
+	// Rewrite lists absolute URLs in metadata that must be fetched through
+	// the cache too, mapped to the registry name that serves them.
+	Rewrite map[string]string
+}
+
+func mustParse(raw string) *url.URL {
+	u, err := url.Parse(raw)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func hasSuffix(p string, suffixes ...string) bool {
+	for _, s := range suffixes {
+		if strings.HasSuffix(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Registries returns the package registries the runners use: PyPI, npm,
+// the Go module proxy, RubyGems and pub.dev.
+func Registries() []*Registry {
+	return []*Registry{
+		{
+			Name:   "pypi",
+			Origin: mustParse("https://pypi.org/"),
+			// /simple/<project>/ lists files on files.pythonhosted.org
+			Immutable: func(string) bool { return false },
+			Rewrite:   map[string]string{"https://files.pythonhosted.org/": "pypi-files"},
+		},
+		{
+			Name:      "pypi-files",
+			Origin:    mustParse("https://files.pythonhosted.org/"),
+			Immutable: func(string) bool { return true },
+		},
+		{
+			Name:   "npm",
+			Origin: mustParse("https://registry.npmjs.org/"),
+			// Tarballs live at /<package>/-/<package>-<version>.tgz
+			Immutable: func(p string) bool { return strings.Contains(p, "/-/") && hasSuffix(p, ".tgz") },
+			Rewrite:   map[string]string{"https://registry.npmjs.org/": "npm"},
+		},
+		{
+			Name:   "go",
+			Origin: mustParse("https://proxy.golang.org/"),
+			// @v/list and @latest change; a published version's files do not
+			Immutable: func(p string) bool {
+				return strings.Contains(p, "/@v/") && hasSuffix(p, ".zip", ".mod", ".info")
+			},
+		},
+		{
+			Name:   "gems",
+			Origin: mustParse("https://rubygems.org/"),
+			Immutable: func(p string) bool {
+				return strings.HasPrefix(p, "/gems/") && hasSuffix(p, ".gem") ||
+					strings.HasPrefix(p, "/quick/") && hasSuffix(p, ".gemspec.rz")
+			},
+		},
+		{
+			Name:   "pub",
+			Origin: mustParse("https://pub.dev/"),
+			Immutable: func(p string) bool {
+				return strings.HasPrefix(p, "/api/archives/") || path.Ext(p) == ".gz" && strings.Contains(p, "/versions/")
+			},
+			Rewrite: map[string]string{
+				"https://pub.dev/":          "pub",
+				"https://pub.dartlang.org/": "pub",
+			},
+		},
+	}
+}